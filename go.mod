@@ -5,12 +5,14 @@ go 1.23
 toolchain go1.23.0
 
 require (
+	github.com/coreos/go-systemd/v22 v22.5.0
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/sessions v1.4.0
 	golang.org/x/crypto v0.31.0
 )
 
 require (
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/gorilla/securecookie v1.1.2 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/term v0.27.0 // indirect
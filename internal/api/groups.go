@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"orbit/internal/users"
+)
+
+func (h *Handler) handleGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := users.ListGroups()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, groups)
+}
+
+// handleGroupCreate adds a group. GID is optional; without it groupadd picks
+// the next free one.
+func (h *Handler) handleGroupCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string `json:"name"`
+		GID    *int   `json:"gid"`
+		System bool   `json:"system"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	gid := -1
+	if req.GID != nil {
+		if *req.GID < 0 {
+			h.writeError(w, "Invalid GID", http.StatusBadRequest)
+			return
+		}
+		gid = *req.GID
+	}
+	if err := users.CreateGroup(req.Name, gid, req.System); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleGroupDelete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.DeleteGroup(req.Name); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleGroupRename(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    string `json:"name"`
+		NewName string `json:"newName"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.RenameGroup(req.Name, req.NewName); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+type groupMemberRequest struct {
+	Group    string `json:"group"`
+	Username string `json:"username"`
+}
+
+func (h *Handler) handleGroupMemberAdd(w http.ResponseWriter, r *http.Request) {
+	var req groupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.AddMember(req.Group, req.Username); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleGroupMemberRemove(w http.ResponseWriter, r *http.Request) {
+	var req groupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.RemoveMember(req.Group, req.Username); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+// handleUserGroups sets a user's primary group and, when "groups" is present,
+// replaces its supplementary groups.
+func (h *Handler) handleUserGroups(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username     string   `json:"username"`
+		PrimaryGroup string   `json:"primaryGroup"`
+		Groups       []string `json:"groups"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.SetUserGroups(req.Username, req.PrimaryGroup, req.Groups); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
@@ -33,22 +33,73 @@ func NewHandler(webFS embed.FS, cfg *config.Config) http.Handler {
 	// API endpoints (protected)
 	api := h.router.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/system/summary", auth.RequireAuth(h.handleSystemSummary)).Methods("GET")
+	api.HandleFunc("/system/boot", auth.RequireAuth(h.handleSystemBoot)).Methods("GET")
 	api.HandleFunc("/packages", auth.RequireAuth(h.handlePackages)).Methods("GET")
 	api.HandleFunc("/packages/search", auth.RequireAuth(h.handlePackagesSearch)).Methods("GET")
+	api.HandleFunc("/packages/install/preview", auth.RequireAuth(h.handlePackagesInstallPreview)).Methods("POST")
 	api.HandleFunc("/packages/install", auth.RequireAuth(h.handlePackagesInstall)).Methods("POST")
+	api.HandleFunc("/packages/remove/preview", auth.RequireAuth(h.handlePackagesRemovePreview)).Methods("POST")
 	api.HandleFunc("/packages/remove", auth.RequireAuth(h.handlePackagesRemove)).Methods("POST")
 	api.HandleFunc("/packages/update", auth.RequireAuth(h.handlePackagesUpdate)).Methods("POST")
+	api.HandleFunc("/packages/upgradable", auth.RequireAuth(h.handlePackagesUpgradable)).Methods("GET")
+	api.HandleFunc("/packages/upgrade/simulate", auth.RequireAuth(h.handlePackagesUpgradeSimulate)).Methods("POST")
+	api.HandleFunc("/packages/upgrade", auth.RequireAuth(h.handlePackagesUpgrade)).Methods("POST")
+	api.HandleFunc("/packages/repos", auth.RequireAuth(h.handleRepos)).Methods("GET")
+	api.HandleFunc("/packages/repos", auth.RequireAuth(h.handleRepoSave)).Methods("POST")
+	api.HandleFunc("/packages/repos/{name}/delete", auth.RequireAuth(h.handleRepoDelete)).Methods("POST")
+	api.HandleFunc("/packages/repos/{name}/enable", auth.RequireAuth(h.handleRepoEnable)).Methods("POST")
+	api.HandleFunc("/packages/repos/{name}/disable", auth.RequireAuth(h.handleRepoDisable)).Methods("POST")
+	api.HandleFunc("/packages/keys", auth.RequireAuth(h.handleRepoKeys)).Methods("GET")
+	api.HandleFunc("/packages/keys", auth.RequireAuth(h.handleRepoKeyImport)).Methods("POST")
+	api.HandleFunc("/packages/keys/{name}/delete", auth.RequireAuth(h.handleRepoKeyDelete)).Methods("POST")
+	api.HandleFunc("/packages/holds", auth.RequireAuth(h.handlePackageHolds)).Methods("GET")
+	api.HandleFunc("/packages/holds", auth.RequireAuth(h.handlePackageHoldSet)).Methods("POST")
+	api.HandleFunc("/packages/pins", auth.RequireAuth(h.handlePackagePins)).Methods("GET")
+	api.HandleFunc("/packages/pins", auth.RequireAuth(h.handlePackagePinSave)).Methods("POST")
+	api.HandleFunc("/packages/pins/{name}/delete", auth.RequireAuth(h.handlePackagePinDelete)).Methods("POST")
+	api.HandleFunc("/packages/unattended", auth.RequireAuth(h.handleUnattended)).Methods("GET")
+	api.HandleFunc("/packages/unattended", auth.RequireAuth(h.handleUnattendedSave)).Methods("POST")
+	api.HandleFunc("/packages/unattended/run", auth.RequireAuth(h.handleUnattendedRun)).Methods("POST")
+	api.HandleFunc("/packages/sources", auth.RequireAuth(h.handlePackageSources)).Methods("GET")
+	api.HandleFunc("/packages/providers/{source}/install", auth.RequireAuth(h.handleProviderInstall)).Methods("POST")
+	api.HandleFunc("/packages/providers/{source}/remove", auth.RequireAuth(h.handleProviderRemove)).Methods("POST")
+	api.HandleFunc("/packages/providers/{source}/refresh", auth.RequireAuth(h.handleProviderRefresh)).Methods("POST")
+	api.HandleFunc("/packages/providers/{source}/channel", auth.RequireAuth(h.handleProviderChannel)).Methods("POST")
+	api.HandleFunc("/packages/vulns", auth.RequireAuth(h.handleVulns)).Methods("GET")
+	api.HandleFunc("/packages/vulns/databases", auth.RequireAuth(h.handleVulnDBs)).Methods("GET")
+	api.HandleFunc("/packages/vulns/databases", auth.RequireAuth(h.handleVulnDBImport)).Methods("POST")
+	api.HandleFunc("/packages/vulns/databases/{name}/delete", auth.RequireAuth(h.handleVulnDBDelete)).Methods("POST")
+	api.HandleFunc("/packages/history", auth.RequireAuth(h.handlePackagesHistory)).Methods("GET")
+	api.HandleFunc("/packages/owner", auth.RequireAuth(h.handlePackageOwner)).Methods("GET")
+	api.HandleFunc("/packages/info/{name}", auth.RequireAuth(h.handlePackageDetail)).Methods("GET")
 	api.HandleFunc("/services", auth.RequireAuth(h.handleServices)).Methods("GET")
+	api.HandleFunc("/services/events", auth.RequireAuth(h.handleServiceEvents)).Methods("GET")
+	api.HandleFunc("/services/create", auth.RequireAuth(h.handleServiceCreate)).Methods("POST")
+	api.HandleFunc("/services/preview", auth.RequireAuth(h.handleServicePreview)).Methods("POST")
+	api.HandleFunc("/services/{unit}", auth.RequireAuth(h.handleServiceDetail)).Methods("GET")
 	api.HandleFunc("/services/{unit}/start", auth.RequireAuth(h.handleServiceStart)).Methods("POST")
 	api.HandleFunc("/services/{unit}/stop", auth.RequireAuth(h.handleServiceStop)).Methods("POST")
 	api.HandleFunc("/services/{unit}/restart", auth.RequireAuth(h.handleServiceRestart)).Methods("POST")
 	api.HandleFunc("/services/{unit}/enable", auth.RequireAuth(h.handleServiceEnable)).Methods("POST")
 	api.HandleFunc("/services/{unit}/disable", auth.RequireAuth(h.handleServiceDisable)).Methods("POST")
+	api.HandleFunc("/services/{unit}/mask", auth.RequireAuth(h.handleServiceMask)).Methods("POST")
+	api.HandleFunc("/services/{unit}/unmask", auth.RequireAuth(h.handleServiceUnmask)).Methods("POST")
+	api.HandleFunc("/services/{unit}/reload", auth.RequireAuth(h.handleServiceReload)).Methods("POST")
+	api.HandleFunc("/services/{unit}/try-restart", auth.RequireAuth(h.handleServiceTryRestart)).Methods("POST")
+	api.HandleFunc("/services/{unit}/reset-failed", auth.RequireAuth(h.handleServiceResetFailed)).Methods("POST")
+	api.HandleFunc("/services/{unit}/kill", auth.RequireAuth(h.handleServiceKill)).Methods("POST")
+	api.HandleFunc("/services/{unit}/instance", auth.RequireAuth(h.handleServiceInstance)).Methods("GET")
+	api.HandleFunc("/services/{unit}/graph", auth.RequireAuth(h.handleServiceGraph)).Methods("GET")
+	api.HandleFunc("/services/{unit}/files", auth.RequireAuth(h.handleServiceFiles)).Methods("GET")
+	api.HandleFunc("/services/{unit}/dropin", auth.RequireAuth(h.handleServiceDropInWrite)).Methods("POST")
+	api.HandleFunc("/services/{unit}/dropin/delete", auth.RequireAuth(h.handleServiceDropInDelete)).Methods("POST")
+	api.HandleFunc("/services/{unit}/revert", auth.RequireAuth(h.handleServiceRevert)).Methods("POST")
 	api.HandleFunc("/network", auth.RequireAuth(h.handleNetwork)).Methods("GET")
 	api.HandleFunc("/network/firewall/enable", auth.RequireAuth(h.handleFirewallEnable)).Methods("POST")
 	api.HandleFunc("/network/firewall/disable", auth.RequireAuth(h.handleFirewallDisable)).Methods("POST")
 	api.HandleFunc("/network/firewall/allow", auth.RequireAuth(h.handleFirewallAllow)).Methods("POST")
 	api.HandleFunc("/network/firewall/deny", auth.RequireAuth(h.handleFirewallDeny)).Methods("POST")
+	api.HandleFunc("/network/firewall/rules", auth.RequireAuth(h.handleFirewallRule)).Methods("POST")
 	api.HandleFunc("/network/firewall/delete", auth.RequireAuth(h.handleFirewallDelete)).Methods("POST")
 	api.HandleFunc("/network/interface/up", auth.RequireAuth(h.handleInterfaceUp)).Methods("POST")
 	api.HandleFunc("/network/interface/down", auth.RequireAuth(h.handleInterfaceDown)).Methods("POST")
@@ -62,7 +113,32 @@ func NewHandler(webFS embed.FS, cfg *config.Config) http.Handler {
 	api.HandleFunc("/users/delete", auth.RequireAuth(h.handleUserDelete)).Methods("POST")
 	api.HandleFunc("/users/lock", auth.RequireAuth(h.handleUserLock)).Methods("POST")
 	api.HandleFunc("/users/unlock", auth.RequireAuth(h.handleUserUnlock)).Methods("POST")
+	api.HandleFunc("/users/groups", auth.RequireAuth(h.handleUserGroups)).Methods("POST")
+	api.HandleFunc("/users/import", auth.RequireAuth(h.handleUserImport)).Methods("POST")
+	api.HandleFunc("/users/sessions", auth.RequireAuth(h.handleSessions)).Methods("GET")
+	api.HandleFunc("/users/sessions/{id}/terminate", auth.RequireAuth(h.handleSessionTerminate)).Methods("POST")
+	api.HandleFunc("/users/logins", auth.RequireAuth(h.handleLoginHistory)).Methods("GET")
+	api.HandleFunc("/users/logins/failed", auth.RequireAuth(h.handleFailedLogins)).Methods("GET")
+	api.HandleFunc("/users/{name}", auth.RequireAuth(h.handleUserUpdate)).Methods("PATCH")
+	api.HandleFunc("/users/{name}/keys", auth.RequireAuth(h.handleUserKeys)).Methods("GET")
+	api.HandleFunc("/users/{name}/keys", auth.RequireAuth(h.handleUserKeyAdd)).Methods("POST")
+	api.HandleFunc("/users/{name}/keys/delete", auth.RequireAuth(h.handleUserKeyRemove)).Methods("POST")
+	api.HandleFunc("/quotas", auth.RequireAuth(h.handleQuotas)).Methods("GET")
+	api.HandleFunc("/quotas/set", auth.RequireAuth(h.handleQuotaSet)).Methods("POST")
+	api.HandleFunc("/quotas/grace", auth.RequireAuth(h.handleQuotaGrace)).Methods("POST")
+	api.HandleFunc("/sudo", auth.RequireAuth(h.handleSudo)).Methods("GET")
+	api.HandleFunc("/sudo/dropins", auth.RequireAuth(h.handleSudoersSave)).Methods("POST")
+	api.HandleFunc("/sudo/dropins/delete", auth.RequireAuth(h.handleSudoersDelete)).Methods("POST")
+	api.HandleFunc("/groups", auth.RequireAuth(h.handleGroups)).Methods("GET")
+	api.HandleFunc("/groups/create", auth.RequireAuth(h.handleGroupCreate)).Methods("POST")
+	api.HandleFunc("/groups/delete", auth.RequireAuth(h.handleGroupDelete)).Methods("POST")
+	api.HandleFunc("/groups/rename", auth.RequireAuth(h.handleGroupRename)).Methods("POST")
+	api.HandleFunc("/groups/members/add", auth.RequireAuth(h.handleGroupMemberAdd)).Methods("POST")
+	api.HandleFunc("/groups/members/remove", auth.RequireAuth(h.handleGroupMemberRemove)).Methods("POST")
+	api.HandleFunc("/jobs", auth.RequireAuth(h.handleJobs)).Methods("GET")
+	api.HandleFunc("/jobs/{id}", auth.RequireAuth(h.handleJob)).Methods("GET")
 	api.HandleFunc("/logs", auth.RequireAuth(h.handleLogs)).Methods("GET")
+	api.HandleFunc("/logs/stream", auth.RequireAuth(h.handleLogsStream)).Methods("GET")
 	api.HandleFunc("/config", auth.RequireAuth(h.handleConfigList)).Methods("GET")
 	api.HandleFunc("/config/{id}", auth.RequireAuth(h.handleConfigRead)).Methods("GET")
 	api.HandleFunc("/config/{id}", auth.RequireAuth(h.handleConfigWrite)).Methods("POST")
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+	"orbit/internal/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, jobs.List(r.URL.Query().Get("kind")))
+}
+
+func (h *Handler) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobs.Get(mux.Vars(r)["id"])
+	if !ok {
+		h.writeError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	h.writeJSON(w, job)
+}
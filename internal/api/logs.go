@@ -1,38 +1,94 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
-	"orbit/internal/services"
+	"orbit/internal/journal"
 )
 
 func (h *Handler) handleLogs(w http.ResponseWriter, r *http.Request) {
-	unit := r.URL.Query().Get("unit")
-	linesStr := r.URL.Query().Get("lines")
-	
-	// BUG FIX #1: Validate unit parameter is not empty
-	if unit == "" {
-		h.writeError(w, "Unit parameter is required", http.StatusBadRequest)
+	q, err := journalQuery(r)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	
-	lines := 50
-	if linesStr != "" {
-		if parsedLines, err := strconv.Atoi(linesStr); err == nil {
-			// BUG FIX #2: Validate lines is positive
-			if parsedLines > 0 && parsedLines <= 10000 {
-				lines = parsedLines
-			}
-		}
-	}
 
-	logs, err := services.GetLogs(unit, lines)
+	page, err := journal.Search(q)
 	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.writeJSON(w, page)
+}
+
+// handleLogsStream follows the journal and pushes entries as server-sent
+// events until the client disconnects.
+func (h *Handler) handleLogsStream(w http.ResponseWriter, r *http.Request) {
+	q, err := journalQuery(r)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
 
-	h.writeJSON(w, map[string]string{"logs": logs})
+	journal.Follow(r.Context(), q, func(e journal.Entry) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\ndata: %s\n\n", e.Cursor, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
 }
 
+// journalQuery builds a journal query from the request's URL parameters.
+func journalQuery(r *http.Request) (journal.Query, error) {
+	params := r.URL.Query()
+	q := journal.Query{
+		Unit:     params.Get("unit"),
+		Priority: params.Get("priority"),
+		BootID:   params.Get("boot"),
+		Grep:     params.Get("grep"),
+		Cursor:   params.Get("cursor"),
+	}
+
+	// "lines" is accepted for compatibility with older clients
+	limitStr := params.Get("limit")
+	if limitStr == "" {
+		limitStr = params.Get("lines")
+	}
+	if limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > 10000 {
+			return q, fmt.Errorf("invalid limit: %s", limitStr)
+		}
+		q.Limit = limit
+	}
+
+	var err error
+	if s := params.Get("since"); s != "" {
+		if q.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("invalid since time (expected RFC 3339): %s", s)
+		}
+	}
+	if s := params.Get("until"); s != "" {
+		if q.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("invalid until time (expected RFC 3339): %s", s)
+		}
+	}
+	return q, nil
+}
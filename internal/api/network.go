@@ -33,6 +33,16 @@ func (h *Handler) handleFirewallDisable(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *Handler) handleFirewallAllow(w http.ResponseWriter, r *http.Request) {
+	h.firewallPort(w, r, network.AllowPort)
+}
+
+func (h *Handler) handleFirewallDeny(w http.ResponseWriter, r *http.Request) {
+	h.firewallPort(w, r, network.DenyPort)
+}
+
+// firewallPort handles the plain port rules of /network/firewall/allow and
+// /network/firewall/deny.
+func (h *Handler) firewallPort(w http.ResponseWriter, r *http.Request, action func(port, protocol string) error) {
 	var req struct {
 		Port     string `json:"port"`
 		Protocol string `json:"protocol"`
@@ -42,25 +52,24 @@ func (h *Handler) handleFirewallAllow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := network.AllowPort(req.Port, req.Protocol); err != nil {
-		h.writeError(w, err.Error(), http.StatusInternalServerError)
+	if err := action(req.Port, req.Protocol); err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
-func (h *Handler) handleFirewallDeny(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Port     string `json:"port"`
-		Protocol string `json:"protocol"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+// handleFirewallRule adds a ufw rule, such as a rate-limited SSH port for a
+// subnet on one interface.
+func (h *Handler) handleFirewallRule(w http.ResponseWriter, r *http.Request) {
+	var rule network.FirewallRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
 		h.writeError(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	if err := network.DenyPort(req.Port, req.Protocol); err != nil {
-		h.writeError(w, err.Error(), http.StatusInternalServerError)
+	if err := network.AddRule(rule); err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
@@ -2,12 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"orbit/internal/packages"
+	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
 func (h *Handler) handlePackages(w http.ResponseWriter, r *http.Request) {
-	pkgs, err := packages.List()
+	pkgs, err := packages.List(r.URL.Query().Get("source"))
 	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -22,7 +26,7 @@ func (h *Handler) handlePackagesSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results, err := packages.Search(query)
+	results, err := packages.Search(query, r.URL.Query().Get("source"))
 	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -30,39 +34,90 @@ func (h *Handler) handlePackagesSearch(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, results)
 }
 
+type packageChangeRequest struct {
+	Package string `json:"package"`
+	Purge   bool   `json:"purge"`
+	Token   string `json:"token"`
+}
+
+func (h *Handler) handlePackagesInstallPreview(w http.ResponseWriter, r *http.Request) {
+	var req packageChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := packages.PreviewInstall(req.Package)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, plan)
+}
+
+// handlePackagesInstall runs an install only after the client confirmed the
+// token of the plan returned by the preview endpoint.
 func (h *Handler) handlePackagesInstall(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Package string `json:"package"`
+	var req packageChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		h.writeError(w, "Preview the install and confirm its plan token", http.StatusBadRequest)
+		return
 	}
+
+	if err := packages.ConfirmInstall(req.Package, req.Token); err != nil {
+		h.writePackageChangeError(w, err)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handlePackagesRemovePreview(w http.ResponseWriter, r *http.Request) {
+	var req packageChangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.writeError(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	if err := packages.Install(req.Package); err != nil {
+	plan, err := packages.PreviewRemove(req.Package, req.Purge)
+	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	h.writeJSON(w, map[string]bool{"success": true})
+	h.writeJSON(w, plan)
 }
 
 func (h *Handler) handlePackagesRemove(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Package string `json:"package"`
-		Purge   bool   `json:"purge"`
-	}
+	var req packageChangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.writeError(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	if req.Token == "" {
+		h.writeError(w, "Preview the removal and confirm its plan token", http.StatusBadRequest)
+		return
+	}
 
-	if err := packages.Remove(req.Package, req.Purge); err != nil {
-		h.writeError(w, err.Error(), http.StatusInternalServerError)
+	if err := packages.ConfirmRemove(req.Package, req.Purge, req.Token); err != nil {
+		h.writePackageChangeError(w, err)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
+func (h *Handler) writePackageChangeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, packages.ErrPlanChanged) {
+		h.writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	h.writeError(w, err.Error(), http.StatusInternalServerError)
+}
+
+// handlePackagesUpdate refreshes the package lists. Upgrades go through
+// /packages/upgrade/simulate and /packages/upgrade so their plan is confirmed.
 func (h *Handler) handlePackagesUpdate(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Upgrade bool `json:"upgrade"`
@@ -72,18 +127,174 @@ func (h *Handler) handlePackagesUpdate(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-
 	if req.Upgrade {
-		if err := packages.Upgrade(); err != nil {
-			h.writeError(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		if err := packages.Update(); err != nil {
-			h.writeError(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		h.writeError(w, "Simulate the upgrade and confirm its plan token", http.StatusBadRequest)
+		return
+	}
+
+	if err := packages.Update(); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
+func (h *Handler) handlePackagesUpgradable(w http.ResponseWriter, r *http.Request) {
+	upgrades, err := packages.ListUpgradable()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, upgrades)
+}
+
+type upgradeRequest struct {
+	Packages []string `json:"packages"`
+	Dist     bool     `json:"dist"`
+	Token    string   `json:"token"`
+}
+
+func (h *Handler) handlePackagesUpgradeSimulate(w http.ResponseWriter, r *http.Request) {
+	var req upgradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := packages.SimulateUpgrade(req.Packages, req.Dist)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, plan)
+}
+
+// handlePackagesUpgrade runs an upgrade only after the client confirmed the
+// token of the plan returned by the simulate endpoint.
+func (h *Handler) handlePackagesUpgrade(w http.ResponseWriter, r *http.Request) {
+	var req upgradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		h.writeError(w, "Simulate the upgrade and confirm its plan token", http.StatusBadRequest)
+		return
+	}
+
+	if err := packages.ConfirmUpgrade(req.Packages, req.Dist, req.Token); err != nil {
+		h.writePackageChangeError(w, err)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handlePackageDetail(w http.ResponseWriter, r *http.Request) {
+	details, err := packages.GetPackageInfo(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeError(w, err.Error(), packageErrorStatus(err))
+		return
+	}
+	h.writeJSON(w, details)
+}
+
+// packageErrorStatus maps an error looking up a package to an HTTP status.
+func packageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, packages.ErrInvalidPackage):
+		return http.StatusBadRequest
+	case errors.Is(err, packages.ErrPackageNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) handlePackageOwner(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		h.writeError(w, "Missing path parameter", http.StatusBadRequest)
+		return
+	}
+
+	owners, err := packages.Owner(path)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]interface{}{"path": path, "packages": owners})
+}
+
+func (h *Handler) handlePackagesHistory(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+
+	txs, err := packages.History(limit)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, txs)
+}
+
+// handlePackageSources lists the system package manager followed by the
+// optional providers available on this host.
+func (h *Handler) handlePackageSources(w http.ResponseWriter, r *http.Request) {
+	sources := []string{packages.Detect().Name()}
+	for _, p := range packages.Providers() {
+		sources = append(sources, p.Name())
+	}
+	h.writeJSON(w, sources)
+}
+
+type providerRequest struct {
+	Package string `json:"package"`
+	Channel string `json:"channel"`
+	Classic bool   `json:"classic"`
+}
+
+// providerAction decodes a request for a snap or flatpak operation and runs
+// it on the provider named in the path.
+func (h *Handler) providerAction(w http.ResponseWriter, r *http.Request, action func(packages.Provider, providerRequest) error) {
+	provider, err := packages.GetProvider(mux.Vars(r)["source"])
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var req providerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(provider, req); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleProviderInstall(w http.ResponseWriter, r *http.Request) {
+	h.providerAction(w, r, func(p packages.Provider, req providerRequest) error {
+		return p.Install(req.Package, req.Channel, req.Classic)
+	})
+}
+
+func (h *Handler) handleProviderRemove(w http.ResponseWriter, r *http.Request) {
+	h.providerAction(w, r, func(p packages.Provider, req providerRequest) error {
+		return p.Remove(req.Package)
+	})
+}
+
+func (h *Handler) handleProviderRefresh(w http.ResponseWriter, r *http.Request) {
+	h.providerAction(w, r, func(p packages.Provider, req providerRequest) error {
+		return p.Refresh(req.Package)
+	})
+}
+
+func (h *Handler) handleProviderChannel(w http.ResponseWriter, r *http.Request) {
+	h.providerAction(w, r, func(p packages.Provider, req providerRequest) error {
+		return p.SwitchChannel(req.Package, req.Channel)
+	})
+}
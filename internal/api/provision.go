@@ -0,0 +1,47 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"orbit/internal/users"
+)
+
+// handleUserImport creates accounts in bulk from a CSV or JSON body;
+// ?format= is detected when left out. With ?dryRun=true every row is only
+// checked. Otherwise the accounts are created in a background job, and the
+// generated one-time passwords are in this response only.
+func (h *Handler) handleUserImport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, users.MaxProvisionSize))
+	if err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	rows, err := users.ParseProvisionRows(data, query.Get("format"))
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("dryRun") == "true" {
+		results, err := users.CheckProvision(rows)
+		if err != nil {
+			h.writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		valid := true
+		for _, r := range results {
+			valid = valid && r.Status == "valid"
+		}
+		h.writeJSON(w, map[string]interface{}{"valid": valid, "rows": results})
+		return
+	}
+
+	job, credentials, err := users.Provision(rows)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, map[string]interface{}{"success": true, "job": job, "passwords": credentials})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"orbit/internal/users"
+)
+
+func (h *Handler) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	report, err := users.Quotas()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, report)
+}
+
+// handleQuotaSet sets the limits of a user or group; block limits are in KiB
+// and 0 means no limit.
+func (h *Handler) handleQuotaSet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Mount     string `json:"mount"`
+		SoftKB    int64  `json:"softKB"`
+		HardKB    int64  `json:"hardKB"`
+		SoftFiles int64  `json:"softFiles"`
+		HardFiles int64  `json:"hardFiles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := users.SetQuota(req.Type, req.Name, req.Mount, req.SoftKB, req.HardKB, req.SoftFiles, req.HardFiles); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleQuotaGrace(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type         string `json:"type"`
+		Mount        string `json:"mount"`
+		BlockSeconds int64  `json:"blockSeconds"`
+		FileSeconds  int64  `json:"fileSeconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := users.SetQuotaGrace(req.Type, req.Mount, req.BlockSeconds, req.FileSeconds); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"orbit/internal/packages"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleRepos(w http.ResponseWriter, r *http.Request) {
+	repos, err := packages.ListRepos()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, repos)
+}
+
+// handleRepoSave creates or replaces a repository file; a repository is
+// enabled unless "enabled" is false. The response carries the apt-get update
+// job started afterwards.
+func (h *Handler) handleRepoSave(w http.ResponseWriter, r *http.Request) {
+	repo := packages.Repo{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&repo); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	job, err := packages.SaveRepo(repo)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, map[string]interface{}{"success": true, "job": job})
+}
+
+func (h *Handler) handleRepoDelete(w http.ResponseWriter, r *http.Request) {
+	job, err := packages.DeleteRepo(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]interface{}{"success": true, "job": job})
+}
+
+func (h *Handler) handleRepoEnable(w http.ResponseWriter, r *http.Request) {
+	h.repoSetEnabled(w, r, true)
+}
+
+func (h *Handler) handleRepoDisable(w http.ResponseWriter, r *http.Request) {
+	h.repoSetEnabled(w, r, false)
+}
+
+func (h *Handler) repoSetEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	job, err := packages.SetRepoEnabled(mux.Vars(r)["name"], enabled)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]interface{}{"success": true, "job": job})
+}
+
+func (h *Handler) handleRepoKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := packages.ListKeys()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, keys)
+}
+
+// handleRepoKeyImport stores a signing key given inline (armored) or as an
+// https URL, and returns its fingerprints.
+func (h *Handler) handleRepoKeyImport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+		URL  string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	key, err := packages.ImportKey(req.Name, []byte(req.Key), req.URL)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, key)
+}
+
+func (h *Handler) handleRepoKeyDelete(w http.ResponseWriter, r *http.Request) {
+	if err := packages.DeleteKey(mux.Vars(r)["name"]); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handlePackageHolds(w http.ResponseWriter, r *http.Request) {
+	holds, err := packages.Holds()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, holds)
+}
+
+func (h *Handler) handlePackageHoldSet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Package string `json:"package"`
+		Held    bool   `json:"held"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := packages.SetHold(req.Package, req.Held); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handlePackagePins(w http.ResponseWriter, r *http.Request) {
+	pins, err := packages.ListPins()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, pins)
+}
+
+func (h *Handler) handlePackagePinSave(w http.ResponseWriter, r *http.Request) {
+	var pin packages.Pin
+	if err := json.NewDecoder(r.Body).Decode(&pin); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := packages.SavePin(pin); err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handlePackagePinDelete(w http.ResponseWriter, r *http.Request) {
+	if err := packages.DeletePin(mux.Vars(r)["name"]); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleUnattended(w http.ResponseWriter, r *http.Request) {
+	status, err := packages.GetUnattended()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, status)
+}
+
+func (h *Handler) handleUnattendedSave(w http.ResponseWriter, r *http.Request) {
+	var cfg packages.UnattendedConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := packages.SaveUnattended(cfg); err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleUnattendedRun(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DryRun bool `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	job, err := packages.RunUnattended(req.DryRun)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]interface{}{"success": true, "job": job})
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 
@@ -9,7 +12,13 @@ import (
 )
 
 func (h *Handler) handleServices(w http.ResponseWriter, r *http.Request) {
-	svcList, err := services.List()
+	var svcList []services.Service
+	var err error
+	if user := r.URL.Query().Get("user"); user != "" {
+		svcList, err = services.UserList(user)
+	} else {
+		svcList, err = services.List()
+	}
 	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -17,48 +26,224 @@ func (h *Handler) handleServices(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, svcList)
 }
 
-func (h *Handler) handleServiceStart(w http.ResponseWriter, r *http.Request) {
+// serviceAction runs a unit action on the system manager, or on a login
+// user's manager when the "user" query parameter is set.
+func (h *Handler) serviceAction(w http.ResponseWriter, r *http.Request, action string, system func(string) error) {
 	unit := mux.Vars(r)["unit"]
-	if err := services.Start(unit); err != nil {
+	var err error
+	if user := r.URL.Query().Get("user"); user != "" {
+		err = services.UserAction(user, action, unit)
+	} else {
+		err = system(unit)
+	}
+	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
+func (h *Handler) handleServiceDetail(w http.ResponseWriter, r *http.Request) {
+	unit := mux.Vars(r)["unit"]
+	detail, err := services.Detail(unit)
+	if err != nil {
+		h.writeError(w, err.Error(), unitErrorStatus(err))
+		return
+	}
+	h.writeJSON(w, detail)
+}
+
+// unitErrorStatus maps an error reading a unit to an HTTP status.
+func unitErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidUnit):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUnitNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) handleServiceStart(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "start", services.Start)
+}
+
 func (h *Handler) handleServiceStop(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "stop", services.Stop)
+}
+
+func (h *Handler) handleServiceRestart(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "restart", services.Restart)
+}
+
+func (h *Handler) handleServiceEnable(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "enable", services.Enable)
+}
+
+func (h *Handler) handleServiceDisable(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "disable", services.Disable)
+}
+
+func (h *Handler) handleServiceMask(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "mask", services.Mask)
+}
+
+func (h *Handler) handleServiceUnmask(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "unmask", services.Unmask)
+}
+
+func (h *Handler) handleServiceReload(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "reload", services.Reload)
+}
+
+func (h *Handler) handleServiceTryRestart(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "try-restart", services.TryRestart)
+}
+
+func (h *Handler) handleServiceResetFailed(w http.ResponseWriter, r *http.Request) {
+	h.serviceAction(w, r, "reset-failed", services.ResetFailed)
+}
+
+func (h *Handler) handleServiceKill(w http.ResponseWriter, r *http.Request) {
 	unit := mux.Vars(r)["unit"]
-	if err := services.Stop(unit); err != nil {
+	var req struct {
+		Signal string `json:"signal"`
+		Whom   string `json:"whom"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if user := r.URL.Query().Get("user"); user != "" {
+		err = services.UserKill(user, unit, req.Signal, req.Whom)
+	} else {
+		err = services.Kill(unit, req.Signal, req.Whom)
+	}
+	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
-func (h *Handler) handleServiceRestart(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleServiceInstance(w http.ResponseWriter, r *http.Request) {
+	unit := mux.Vars(r)["unit"]
+	instance := r.URL.Query().Get("instance")
+	name, err := services.InstanceName(unit, instance)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, map[string]string{"unit": name})
+}
+
+func (h *Handler) handleServiceFiles(w http.ResponseWriter, r *http.Request) {
+	unit := mux.Vars(r)["unit"]
+	files, err := services.Cat(unit)
+	if err != nil {
+		h.writeError(w, err.Error(), unitErrorStatus(err))
+		return
+	}
+	h.writeJSON(w, files)
+}
+
+func (h *Handler) handleServiceDropInWrite(w http.ResponseWriter, r *http.Request) {
 	unit := mux.Vars(r)["unit"]
-	if err := services.Restart(unit); err != nil {
+	var req struct {
+		Name    string `json:"name"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.WriteDropIn(unit, req.Name, req.Content); err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
-func (h *Handler) handleServiceEnable(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleServiceDropInDelete(w http.ResponseWriter, r *http.Request) {
 	unit := mux.Vars(r)["unit"]
-	if err := services.Enable(unit); err != nil {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.DeleteDropIn(unit, req.Name); err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
-func (h *Handler) handleServiceDisable(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleServiceRevert(w http.ResponseWriter, r *http.Request) {
 	unit := mux.Vars(r)["unit"]
-	if err := services.Disable(unit); err != nil {
+	if err := services.Revert(unit); err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
+func (h *Handler) handleServiceCreate(w http.ResponseWriter, r *http.Request) {
+	var spec services.ServiceSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.CreateService(spec); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleServicePreview(w http.ResponseWriter, r *http.Request) {
+	var spec services.ServiceSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	content, err := spec.Render()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, map[string]string{"content": content})
+}
+
+func (h *Handler) handleServiceGraph(w http.ResponseWriter, r *http.Request) {
+	unit := mux.Vars(r)["unit"]
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+
+	graph, err := services.Graph(unit, depth)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Units that never started have no critical chain; that is not an error here
+	chain, err := services.CriticalChain(graph.Root)
+	if err != nil {
+		chain = []services.ChainEntry{}
+	}
+	h.writeJSON(w, map[string]interface{}{
+		"graph":         graph,
+		"criticalChain": chain,
+	})
+}
+
+func (h *Handler) handleServiceEvents(w http.ResponseWriter, r *http.Request) {
+	unit := r.URL.Query().Get("unit")
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	h.writeJSON(w, services.Events(unit, limit))
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"orbit/internal/users"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := users.Sessions()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, sessions)
+}
+
+// handleSessionTerminate ends a logind session, for example to log a user
+// out before deleting the account.
+func (h *Handler) handleSessionTerminate(w http.ResponseWriter, r *http.Request) {
+	if err := users.TerminateSession(mux.Vars(r)["id"]); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleLoginHistory(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	logins, err := users.LoginHistory(limit)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, logins)
+}
+
+func (h *Handler) handleFailedLogins(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	logins, err := users.FailedLogins(limit)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, logins)
+}
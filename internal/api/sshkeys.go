@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"orbit/internal/users"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleUserKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := users.ListKeys(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, keys)
+}
+
+// handleUserKeyAdd appends one authorized_keys line and returns the parsed
+// key for the fingerprint to be checked.
+func (h *Handler) handleUserKeyAdd(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	key, err := users.AddKey(mux.Vars(r)["name"], req.Key)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, key)
+}
+
+func (h *Handler) handleUserKeyRemove(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Fingerprint string `json:"fingerprint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.RemoveKey(mux.Vars(r)["name"], req.Fingerprint); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"orbit/internal/users"
+)
+
+// handleSudo returns who may use sudo, resolved from /etc/sudoers, its
+// drop-ins and group membership.
+func (h *Handler) handleSudo(w http.ResponseWriter, r *http.Request) {
+	access, err := users.Sudo()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, access)
+}
+
+// handleSudoersSave creates or replaces a drop-in in /etc/sudoers.d. Content
+// that fails `visudo -cf` is rejected with visudo's message.
+func (h *Handler) handleSudoersSave(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    string `json:"name"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.SaveSudoers(req.Name, req.Content); err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
+
+func (h *Handler) handleSudoersDelete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.DeleteSudoers(req.Name); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
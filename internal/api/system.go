@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"orbit/internal/services"
 	"orbit/internal/system"
 )
 
@@ -14,3 +15,25 @@ func (h *Handler) handleSystemSummary(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, summary)
 }
 
+func (h *Handler) handleSystemBoot(w http.ResponseWriter, r *http.Request) {
+	bootTime, err := services.GetBootTime()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	blame, err := services.Blame()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chain, err := services.CriticalChain("")
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]interface{}{
+		"time":          bootTime,
+		"blame":         blame,
+		"criticalChain": chain,
+	})
+}
@@ -5,10 +5,13 @@ import (
 	"net/http"
 
 	"orbit/internal/users"
+
+	"github.com/gorilla/mux"
 )
 
+// handleUsers lists the local users; ?system=false hides system users.
 func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
-	userList, err := users.List()
+	userList, err := users.List(r.URL.Query().Get("system") != "false")
 	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -20,13 +23,14 @@ func (h *Handler) handleUserCreate(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		users.CreateOptions
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.writeError(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	if err := users.Create(req.Username, req.Password); err != nil {
+	if err := users.Create(req.Username, req.Password, req.CreateOptions); err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -81,3 +85,19 @@ func (h *Handler) handleUserUnlock(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, map[string]bool{"success": true})
 }
 
+// handleUserUpdate applies a partial update to a user: shell, comment, home
+// (moved with "moveHome"), UID, primary GID, expiry, password aging and a
+// password reset. Fields left out are not changed.
+func (h *Handler) handleUserUpdate(w http.ResponseWriter, r *http.Request) {
+	var req users.Update
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := users.Modify(mux.Vars(r)["name"], req); err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
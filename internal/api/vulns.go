@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"orbit/internal/packages"
+
+	"github.com/gorilla/mux"
+)
+
+// handleVulns matches the installed packages against the imported
+// vulnerability databases. ?format=csv or ?format=json returns the report
+// as a download.
+func (h *Handler) handleVulns(w http.ResponseWriter, r *http.Request) {
+	report, err := packages.ScanVulns()
+	if errors.Is(err, packages.ErrNoVulnDB) {
+		h.writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="vulnerabilities.csv"`)
+		packages.WriteVulnCSV(w, report)
+	case "json":
+		w.Header().Set("Content-Disposition", `attachment; filename="vulnerabilities.json"`)
+		h.writeJSON(w, report)
+	default:
+		h.writeJSON(w, report)
+	}
+}
+
+func (h *Handler) handleVulnDBs(w http.ResponseWriter, r *http.Request) {
+	dbs, err := packages.ListVulnDBs()
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, dbs)
+}
+
+// handleVulnDBImport imports a database given as the request body, or read
+// from ?path=, relative to the configured vuln_sync_dir on the server. ?name=
+// names it and ?format= (oval, security-tracker or osv) is detected when left
+// out.
+func (h *Handler) handleVulnDBImport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var src io.Reader = http.MaxBytesReader(w, r.Body, packages.MaxVulnDBSize)
+	if path := query.Get("path"); path != "" {
+		f, err := packages.OpenSyncedVulnDB(h.config.VulnSyncDir, path)
+		if err != nil {
+			h.writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		src = io.LimitReader(f, packages.MaxVulnDBSize)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		h.writeError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	db, err := packages.ImportVulnDB(query.Get("name"), query.Get("format"), data)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeJSON(w, db)
+}
+
+func (h *Handler) handleVulnDBDelete(w http.ResponseWriter, r *http.Request) {
+	err := packages.DeleteVulnDB(mux.Vars(r)["name"])
+	switch {
+	case errors.Is(err, packages.ErrInvalidVulnDB):
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, packages.ErrVulnDBNotFound):
+		h.writeError(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		h.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, map[string]bool{"success": true})
+}
@@ -1,6 +1,7 @@
 package audit
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -56,3 +57,28 @@ func Log(user, ip, method, path string, status int) {
 	defer f.Close()
 	fmt.Fprintf(f, "%s\n", data)
 }
+
+// Entries returns the recorded audit entries, oldest first.
+func Entries() ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
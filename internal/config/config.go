@@ -16,6 +16,9 @@ type Config struct {
 	TLSCert           string   `json:"tls_cert"`
 	TLSKey            string   `json:"tls_key"`
 	BindAddress       string   `json:"bind_address"`
+	CriticalUnits     []string `json:"critical_units"`
+	AlertWebhook      string   `json:"alert_webhook"`
+	VulnSyncDir       string   `json:"vuln_sync_dir"`
 }
 
 func Load(path string) (*Config, error) {
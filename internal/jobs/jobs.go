@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"orbit/internal/util"
+)
+
+// maxJobs is how many finished jobs are kept in memory.
+const maxJobs = 50
+
+// Job is a long-running operation started through the API. Status is
+// "running", "succeeded" or "failed"; Result holds whatever the job
+// returned, such as command output or per-item results.
+type Job struct {
+	ID       string      `json:"id"`
+	Kind     string      `json:"kind"`
+	Status   string      `json:"status"`
+	Started  time.Time   `json:"started"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+var (
+	mu   sync.Mutex
+	jobs []*Job
+)
+
+// Start runs fn in the background and returns the job tracking it.
+func Start(kind string, fn func() (interface{}, error)) Job {
+	job := &Job{
+		ID:      util.GenerateRandomString(16),
+		Kind:    kind,
+		Status:  "running",
+		Started: time.Now().UTC(),
+	}
+
+	mu.Lock()
+	jobs = append(jobs, job)
+	prune()
+	snapshot := *job
+	mu.Unlock()
+
+	go func() {
+		result, err := fn()
+		finished := time.Now().UTC()
+
+		mu.Lock()
+		defer mu.Unlock()
+		job.Finished = &finished
+		job.Result = result
+		job.Status = "succeeded"
+		if err != nil {
+			job.Status = "failed"
+			job.Error = err.Error()
+		}
+	}()
+	return snapshot
+}
+
+// Get returns the job with the given ID.
+func Get(id string) (Job, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, job := range jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// List returns the known jobs of a kind (all kinds when empty), newest first.
+func List(kind string) []Job {
+	mu.Lock()
+	defer mu.Unlock()
+	out := []Job{}
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if kind == "" || jobs[i].Kind == kind {
+			out = append(out, *jobs[i])
+		}
+	}
+	return out
+}
+
+// prune drops the oldest finished jobs beyond maxJobs. Running jobs are
+// always kept. Callers hold mu.
+func prune() {
+	excess := len(jobs) - maxJobs
+	if excess <= 0 {
+		return
+	}
+	kept := jobs[:0]
+	for _, job := range jobs {
+		if excess > 0 && job.Status != "running" {
+			excess--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	jobs = kept
+}
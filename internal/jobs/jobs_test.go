@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func wait(t *testing.T, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := Get(id); ok && job.Status != "running" {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestStart(t *testing.T) {
+	ok := Start("test", func() (interface{}, error) { return "done", nil })
+	if ok.Status != "running" || ok.ID == "" {
+		t.Fatalf("unexpected new job: %+v", ok)
+	}
+	if job := wait(t, ok.ID); job.Status != "succeeded" || job.Result != "done" || job.Finished == nil {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+
+	failed := Start("test", func() (interface{}, error) { return nil, errors.New("boom") })
+	if job := wait(t, failed.ID); job.Status != "failed" || job.Error != "boom" {
+		t.Fatalf("unexpected failed job: %+v", job)
+	}
+
+	if list := List("test"); len(list) < 2 || list[0].ID != failed.ID {
+		t.Fatalf("expected newest job first: %+v", list)
+	}
+	if len(List("other")) != 0 {
+		t.Fatal("expected no jobs of another kind")
+	}
+}
@@ -0,0 +1,277 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"orbit/internal/util"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 10000
+)
+
+// commandContext starts journalctl for Follow; tests replace it.
+var commandContext = util.CommandContext
+
+// Entry is a single journal record decoded from `journalctl -o json`.
+type Entry struct {
+	Cursor     string    `json:"cursor"`
+	Time       time.Time `json:"time"`
+	Priority   int       `json:"priority"`
+	Unit       string    `json:"unit"`
+	Identifier string    `json:"identifier"`
+	PID        string    `json:"pid"`
+	Hostname   string    `json:"hostname"`
+	BootID     string    `json:"bootId"`
+	Message    string    `json:"message"`
+}
+
+// Query selects journal entries. Empty fields are not filtered on.
+type Query struct {
+	Unit     string
+	Priority string
+	Since    time.Time
+	Until    time.Time
+	BootID   string
+	Grep     string
+	Cursor   string // continue after this entry (older entries for Search)
+	Limit    int
+}
+
+// Page is one batch of Search results, newest first.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	// NextCursor fetches the next (older) page when passed back as Query.Cursor.
+	NextCursor string `json:"nextCursor"`
+}
+
+var priorityNames = map[string]string{
+	"emerg": "0", "alert": "1", "crit": "2", "err": "3",
+	"warning": "4", "notice": "5", "info": "6", "debug": "7",
+}
+
+// Search returns one page of entries matching q, newest first.
+func Search(q Query) (*Page, error) {
+	args, err := q.args()
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	args = append(args, "--reverse", "-n", strconv.Itoa(limit))
+	if q.Cursor != "" {
+		args = append(args, "--after-cursor="+q.Cursor)
+	}
+
+	output, err := util.RunCommand("journalctl", args...)
+	if err != nil {
+		// journalctl exits 1 when --grep matches nothing
+		if strings.TrimSpace(output) == "" || strings.HasPrefix(output, "-- No entries --") {
+			return &Page{Entries: []Entry{}}, nil
+		}
+		return nil, fmt.Errorf("journalctl failed: %s", strings.TrimSpace(output))
+	}
+
+	page := &Page{Entries: []Entry{}}
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		entry, err := parseEntry([]byte(line))
+		if err != nil {
+			continue
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	if len(page.Entries) == limit {
+		page.NextCursor = page.Entries[len(page.Entries)-1].Cursor
+	}
+	return page, nil
+}
+
+// Follow streams new entries matching q to fn until ctx is cancelled or fn
+// returns an error. Query.Cursor and Query.Limit are ignored.
+func Follow(ctx context.Context, q Query, fn func(Entry) error) error {
+	args, err := q.args()
+	if err != nil {
+		return err
+	}
+	args = append(args, "--follow", "-n", "0")
+
+	cmd := commandContext(ctx, "journalctl", args...)
+	// sudo relays SIGTERM to journalctl, but the SIGKILL exec.CommandContext
+	// sends by default would only end sudo and leave journalctl running
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 5 * time.Second
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+	defer cmd.Wait()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, err := parseEntry(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			cmd.Cancel()
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// args validates the filters and converts them to journalctl arguments.
+func (q Query) args() ([]string, error) {
+	args := []string{"-o", "json", "--no-pager"}
+
+	if q.Unit != "" {
+		if !isValidUnitName(q.Unit) {
+			return nil, fmt.Errorf("invalid unit name: %s", q.Unit)
+		}
+		args = append(args, "-u", q.Unit)
+	}
+	if q.Priority != "" {
+		level, ok := priorityNames[q.Priority]
+		if !ok {
+			if len(q.Priority) != 1 || q.Priority[0] < '0' || q.Priority[0] > '7' {
+				return nil, fmt.Errorf("invalid priority: %s", q.Priority)
+			}
+			level = q.Priority
+		}
+		args = append(args, "-p", level)
+	}
+	if !q.Since.IsZero() {
+		args = append(args, fmt.Sprintf("--since=@%d", q.Since.Unix()))
+	}
+	if !q.Until.IsZero() {
+		args = append(args, fmt.Sprintf("--until=@%d", q.Until.Unix()))
+	}
+	if q.BootID != "" {
+		if !isValidBootID(q.BootID) {
+			return nil, fmt.Errorf("invalid boot ID: %s", q.BootID)
+		}
+		args = append(args, "--boot="+q.BootID)
+	}
+	if q.Grep != "" {
+		if len(q.Grep) > 200 {
+			return nil, fmt.Errorf("grep pattern too long")
+		}
+		args = append(args, "--grep="+q.Grep)
+	}
+	if q.Cursor != "" && !isValidCursor(q.Cursor) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return args, nil
+}
+
+// parseEntry decodes a journal JSON record. Field values are strings, except
+// for non-UTF-8 data which journalctl emits as an array of byte values.
+func parseEntry(line []byte) (Entry, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return Entry{}, err
+	}
+
+	field := func(key string) string {
+		v, ok := raw[key]
+		if !ok {
+			return ""
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			return s
+		}
+		var b []byte
+		var ints []int
+		if err := json.Unmarshal(v, &ints); err == nil {
+			for _, n := range ints {
+				b = append(b, byte(n))
+			}
+			return string(b)
+		}
+		return ""
+	}
+
+	e := Entry{
+		Cursor:     field("__CURSOR"),
+		Priority:   6,
+		Unit:       field("_SYSTEMD_UNIT"),
+		Identifier: field("SYSLOG_IDENTIFIER"),
+		PID:        field("_PID"),
+		Hostname:   field("_HOSTNAME"),
+		BootID:     field("_BOOT_ID"),
+		Message:    field("MESSAGE"),
+	}
+	if usec, err := strconv.ParseInt(field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		e.Time = time.UnixMicro(usec).UTC()
+	}
+	if p, err := strconv.Atoi(field("PRIORITY")); err == nil {
+		e.Priority = p
+	}
+	return e, nil
+}
+
+func isValidUnitName(unit string) bool {
+	if len(unit) > 256 {
+		return false
+	}
+	for _, c := range unit {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9') || c == '-' || c == '_' ||
+			c == '.' || c == '@' || c == ':' || c == '*') {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidBootID accepts a 128-bit boot ID in hex or a relative offset like -1.
+func isValidBootID(id string) bool {
+	if _, err := strconv.Atoi(id); err == nil {
+		return true
+	}
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidCursor(cursor string) bool {
+	if len(cursor) > 512 {
+		return false
+	}
+	for _, c := range cursor {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || c == '=' || c == ';') {
+			return false
+		}
+	}
+	return true
+}
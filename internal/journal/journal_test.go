@@ -0,0 +1,96 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEntry(t *testing.T) {
+	line := `{"__CURSOR":"s=abc;i=1f","__REALTIME_TIMESTAMP":"1700000000000000","PRIORITY":"3","_SYSTEMD_UNIT":"nginx.service","SYSLOG_IDENTIFIER":"nginx","_PID":"812","MESSAGE":[104,105]}`
+	e, err := parseEntry([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Cursor != "s=abc;i=1f" || e.Priority != 3 || e.Unit != "nginx.service" || e.PID != "812" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e.Message != "hi" {
+		t.Fatalf("expected binary message to decode, got %q", e.Message)
+	}
+	if !e.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("unexpected time: %v", e.Time)
+	}
+}
+
+func TestQueryArgs(t *testing.T) {
+	args, err := Query{Unit: "ssh.service", Priority: "warning", BootID: "-1", Grep: "fail"}.args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-o", "json", "--no-pager", "-u", "ssh.service", "-p", "4", "--boot=-1", "--grep=fail"}
+	if len(args) != len(want) {
+		t.Fatalf("got %v, want %v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("got %v, want %v", args, want)
+		}
+	}
+
+	invalid := []Query{{Unit: "a;b"}, {Priority: "9"}, {BootID: "xyz"}, {Cursor: "s=1 --flag"}}
+	for _, q := range invalid {
+		if _, err := q.args(); err == nil {
+			t.Fatalf("expected error for %+v", q)
+		}
+	}
+}
+
+func TestFollowCancel(t *testing.T) {
+	// The shell stands in for sudo: it only stops its child on SIGTERM
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	old := commandContext
+	commandContext = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+		script := `trap 'kill $child; exit 0' TERM; sleep 1000 & child=$!; echo $child > ` + pidFile + `; wait`
+		return exec.CommandContext(ctx, "sh", "-c", script)
+	}
+	t.Cleanup(func() { commandContext = old })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Follow(ctx, Query{}, func(Entry) error { return nil }) }()
+
+	var pid int
+	for i := 0; i < 100 && pid == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		data, _ := os.ReadFile(pidFile)
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	if pid == 0 {
+		t.Fatal("the follow command did not start")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Follow did not return after the context was cancelled")
+	}
+	for i := 0; i < 100; i++ {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("process %d survived the cancellation", pid)
+}
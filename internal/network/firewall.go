@@ -0,0 +1,352 @@
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"orbit/internal/util"
+)
+
+// run executes ufw and the other firewall commands; tests replace it.
+var run = util.RunCommand
+
+// maxPorts is the most ports ufw accepts in one rule, a range counting as two.
+const maxPorts = 15
+
+// FirewallRule is a ufw rule. From and To are an address or CIDR, or "any".
+// Port and FromPort are a port, a range ("8000:9000") or a comma-separated
+// list of those; App is an application profile used instead of a
+// destination port. Protocol is "tcp", "udp" or empty for both. Direction
+// is "in", "out" or "fwd" for routed rules. V6 marks the IPv6 copy ufw adds
+// for rules that match any address.
+//
+// Number and Raw are only set on rules read from `ufw status numbered`.
+type FirewallRule struct {
+	Number    int    `json:"number,omitempty"`
+	Action    string `json:"action"`
+	Direction string `json:"direction"`
+	From      string `json:"from"`
+	FromPort  string `json:"fromPort,omitempty"`
+	To        string `json:"to"`
+	Port      string `json:"port,omitempty"`
+	App       string `json:"app,omitempty"`
+	Protocol  string `json:"protocol,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	V6        bool   `json:"v6"`
+	Raw       string `json:"raw,omitempty"`
+}
+
+func getFirewallRules() ([]FirewallRule, error) {
+	output, err := run("ufw", "status", "numbered")
+	if err != nil {
+		return []FirewallRule{}, nil
+	}
+	return parseUFWStatus(output), nil
+}
+
+var (
+	ufwRuleLine = regexp.MustCompile(`^\[\s*(\d+)\]\s+(.*?)\s+(ALLOW|DENY|REJECT|LIMIT)(?: (IN|OUT|FWD))?\s+(.*)$`)
+	ufwPortSpec = regexp.MustCompile(`^([0-9:,]+)(?:/(\w+))?$`)
+)
+
+// parseUFWStatus reads `ufw status numbered`:
+//
+//	     To                         Action      From
+//	     --                         ------      ----
+//	[ 1] 22/tcp on eth0             LIMIT IN    10.0.0.0/8                 # ssh
+//	[ 2] 10.0.0.5 5432/tcp          ALLOW IN    Anywhere
+//	[ 3] Anywhere                   DENY OUT    203.0.113.9 25/tcp (out)
+//	[ 4] OpenSSH (v6)               ALLOW IN    Anywhere (v6)
+func parseUFWStatus(output string) []FirewallRule {
+	rules := []FirewallRule{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		m := ufwRuleLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		rule := FirewallRule{Action: strings.ToLower(m[3]), Direction: "in", Raw: line}
+		rule.Number, _ = strconv.Atoi(m[1])
+		if m[4] != "" {
+			rule.Direction = strings.ToLower(m[4])
+		}
+		from := m[5]
+		if i := strings.Index(from, " # "); i >= 0 {
+			rule.Comment = strings.TrimSpace(from[i+3:])
+			from = from[:i]
+		}
+
+		to := parseUFWEndpoint(&rule, m[2])
+		rule.To, rule.Port = to.addr, to.port
+		if to.app != "" {
+			rule.App = to.app
+		}
+		src := parseUFWEndpoint(&rule, from)
+		rule.From, rule.FromPort = src.addr, src.port
+		if src.app != "" && rule.App == "" {
+			rule.App = src.app
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+type ufwEndpoint struct {
+	addr, port, app string
+}
+
+// parseUFWEndpoint reads a To or From column, such as
+// "10.0.0.5 5432/tcp on eth0 (v6)", setting the protocol, interface and v6
+// flag on the rule.
+func parseUFWEndpoint(rule *FirewallRule, column string) ufwEndpoint {
+	column = strings.TrimSpace(column)
+	for {
+		switch {
+		case strings.HasSuffix(column, "(v6)"):
+			rule.V6 = true
+			column = strings.TrimSpace(strings.TrimSuffix(column, "(v6)"))
+			continue
+		case strings.HasSuffix(column, "(out)"):
+			column = strings.TrimSpace(strings.TrimSuffix(column, "(out)"))
+			continue
+		}
+		break
+	}
+	if i := strings.LastIndex(column, " on "); i >= 0 {
+		rule.Interface = column[i+4:]
+		column = column[:i]
+	}
+
+	e := ufwEndpoint{addr: "any"}
+	rest := column
+	if column == "Anywhere" {
+		return e
+	}
+	if first, remainder, _ := strings.Cut(column, " "); isAddressOrPrefix(first) {
+		e.addr, rest = first, remainder
+	} else if strings.HasPrefix(column, "Anywhere ") {
+		rest = strings.TrimPrefix(column, "Anywhere ")
+	}
+	if m := ufwPortSpec.FindStringSubmatch(rest); m != nil {
+		e.port = m[1]
+		if m[2] != "" {
+			rule.Protocol = m[2]
+		}
+	} else if rest != "" {
+		e.app = rest
+	}
+	return e
+}
+
+func isAddressOrPrefix(s string) bool {
+	_, err := parseAddressOrPrefix(s)
+	return err == nil
+}
+
+// parseAddressOrPrefix accepts an address or a CIDR and returns it as a
+// prefix.
+func parseAddressOrPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// AddRule validates a rule and adds it with ufw's full syntax, such as
+// `ufw limit in on eth0 proto tcp from 10.0.0.0/8 to any port 22 comment ssh`.
+// Number, Raw and V6 are ignored; ufw adds the IPv6 copy itself when both
+// addresses are "any".
+func AddRule(rule FirewallRule) error {
+	args, err := ufwRuleArgs(rule)
+	if err != nil {
+		return err
+	}
+	output, err := run("ufw", args...)
+	if err != nil {
+		return fmt.Errorf("ufw failed: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
+
+func ufwRuleArgs(rule FirewallRule) ([]string, error) {
+	switch rule.Action {
+	case "allow", "deny", "reject", "limit":
+	default:
+		return nil, fmt.Errorf("invalid action: %s", rule.Action)
+	}
+	direction := rule.Direction
+	if direction == "" {
+		direction = "in"
+	}
+	if direction != "in" && direction != "out" {
+		return nil, fmt.Errorf("invalid direction: %s", rule.Direction)
+	}
+	args := []string{rule.Action, direction}
+
+	if rule.Interface != "" {
+		if !isValidInterfaceName(rule.Interface) {
+			return nil, fmt.Errorf("invalid interface: %s", rule.Interface)
+		}
+		args = append(args, "on", rule.Interface)
+	}
+
+	if rule.App != "" {
+		if rule.Port != "" || rule.Protocol != "" {
+			return nil, fmt.Errorf("an application profile cannot be combined with a port or protocol")
+		}
+		if err := checkApp(rule.App); err != nil {
+			return nil, err
+		}
+	}
+	protocol := rule.Protocol
+	if protocol == "any" {
+		protocol = ""
+	}
+	if protocol != "" && !isValidProtocol(protocol) {
+		return nil, fmt.Errorf("invalid protocol: %s", rule.Protocol)
+	}
+	for _, port := range []string{rule.Port, rule.FromPort} {
+		if port == "" {
+			continue
+		}
+		multiple, err := validatePortSpec(port)
+		if err != nil {
+			return nil, err
+		}
+		if multiple && protocol == "" {
+			return nil, fmt.Errorf("port ranges and lists need a protocol")
+		}
+	}
+	if rule.Port == "" && rule.FromPort == "" && rule.App == "" && protocol != "" {
+		return nil, fmt.Errorf("a protocol needs a port")
+	}
+	if protocol != "" {
+		args = append(args, "proto", protocol)
+	}
+
+	from, err := ruleAddress(rule.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ruleAddress(rule.To)
+	if err != nil {
+		return nil, err
+	}
+	if from.IsValid() && to.IsValid() && from.Addr().Is4() != to.Addr().Is4() {
+		return nil, fmt.Errorf("source and destination must both be IPv4 or IPv6")
+	}
+	args = append(args, "from", addressArg(from))
+	if rule.FromPort != "" {
+		args = append(args, "port", rule.FromPort)
+	}
+	args = append(args, "to", addressArg(to))
+	if rule.Port != "" {
+		args = append(args, "port", rule.Port)
+	}
+	if rule.App != "" {
+		args = append(args, "app", rule.App)
+	}
+	if rule.Port == "" && rule.FromPort == "" && rule.App == "" && !from.IsValid() && !to.IsValid() && rule.Interface == "" {
+		return nil, fmt.Errorf("a rule needs an address, port, application or interface")
+	}
+
+	if rule.Comment != "" {
+		if !isValidRuleComment(rule.Comment) {
+			return nil, fmt.Errorf("invalid comment")
+		}
+		args = append(args, "comment", rule.Comment)
+	}
+	return args, nil
+}
+
+// ruleAddress parses From or To; the zero prefix stands for any address.
+func ruleAddress(s string) (netip.Prefix, error) {
+	if s == "" || s == "any" {
+		return netip.Prefix{}, nil
+	}
+	prefix, err := parseAddressOrPrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address: %s", s)
+	}
+	return prefix, nil
+}
+
+func addressArg(prefix netip.Prefix) string {
+	if !prefix.IsValid() {
+		return "any"
+	}
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+	return prefix.Masked().String()
+}
+
+// validatePortSpec checks a port, a range or a comma-separated list of them
+// and reports whether it covers more than one port.
+func validatePortSpec(spec string) (bool, error) {
+	parts := strings.Split(spec, ",")
+	count := 0
+	for _, part := range parts {
+		lo, hi, isRange := strings.Cut(part, ":")
+		low, err := parsePort(lo)
+		if err != nil {
+			return false, fmt.Errorf("invalid port: %s", spec)
+		}
+		count++
+		if isRange {
+			high, err := parsePort(hi)
+			if err != nil || high <= low {
+				return false, fmt.Errorf("invalid port range: %s", part)
+			}
+			count++
+		}
+	}
+	if count > maxPorts {
+		return false, fmt.Errorf("at most %d ports can be given in one rule", maxPorts)
+	}
+	return len(parts) > 1 || strings.Contains(spec, ":"), nil
+}
+
+func parsePort(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 || s != strconv.Itoa(n) {
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+	return n, nil
+}
+
+// checkApp only accepts application profiles ufw knows about.
+func checkApp(name string) error {
+	output, err := run("ufw", "app", "list")
+	if err != nil {
+		return fmt.Errorf("cannot list application profiles: %s", strings.TrimSpace(output))
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, " ") && strings.TrimSpace(line) == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown application profile: %s", name)
+}
+
+func isValidRuleComment(comment string) bool {
+	if len(comment) > 200 {
+		return false
+	}
+	for _, c := range comment {
+		// ufw stores comments quoted in its rules files
+		if unicode.IsControl(c) || c == '\'' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
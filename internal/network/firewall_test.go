@@ -0,0 +1,121 @@
+package network
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseUFWStatus(t *testing.T) {
+	data, err := os.ReadFile("testdata/ufw-status-numbered.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := parseUFWStatus(string(data))
+	if len(rules) != 8 {
+		t.Fatalf("expected 8 rules, got %d: %+v", len(rules), rules)
+	}
+	want := []FirewallRule{
+		{Number: 1, Action: "limit", Direction: "in", From: "10.0.0.0/8", To: "any", Port: "22", Protocol: "tcp", Interface: "eth0", Comment: "ssh from office"},
+		{Number: 2, Action: "allow", Direction: "in", From: "192.168.1.0/24", To: "10.0.0.5", Port: "5432", Protocol: "tcp"},
+		{Number: 3, Action: "allow", Direction: "in", From: "any", To: "any", Port: "80,443", Protocol: "tcp"},
+		{Number: 4, Action: "allow", Direction: "in", From: "any", To: "any", App: "OpenSSH"},
+		{Number: 5, Action: "deny", Direction: "out", From: "any", To: "203.0.113.9", Port: "25", Protocol: "tcp"},
+		{Number: 6, Action: "reject", Direction: "in", From: "198.51.100.7", To: "any", Interface: "eth1"},
+		{Number: 7, Action: "allow", Direction: "in", From: "any", To: "any", Port: "80,443", Protocol: "tcp", V6: true},
+		{Number: 8, Action: "allow", Direction: "fwd", From: "2001:db8::/32", To: "any", Port: "8080", Protocol: "tcp"},
+	}
+	for i, w := range want {
+		got := rules[i]
+		got.Raw = ""
+		if got != w {
+			t.Errorf("rule %d:\n got %+v\nwant %+v", i+1, got, w)
+		}
+	}
+	if !strings.HasPrefix(rules[0].Raw, "[ 1] 22/tcp on eth0") {
+		t.Errorf("unexpected raw line: %q", rules[0].Raw)
+	}
+}
+
+func TestAddRule(t *testing.T) {
+	var calls []string
+	old := run
+	run = func(command string, args ...string) (string, error) {
+		calls = append(calls, strings.Join(append([]string{command}, args...), " "))
+		if strings.Join(args, " ") == "app list" {
+			return "Available applications:\n  Nginx Full\n  OpenSSH\n", nil
+		}
+		return "", nil
+	}
+	t.Cleanup(func() { run = old })
+
+	for _, rule := range []FirewallRule{
+		{Action: "limit", From: "10.0.0.0/8", Port: "22", Protocol: "tcp", Interface: "eth0", Comment: "ssh from office"},
+		{Action: "reject", Direction: "out", To: "203.0.113.9", Port: "25", Protocol: "tcp"},
+		{Action: "allow", From: "192.168.1.7/24", App: "Nginx Full"},
+		{Action: "deny", From: "2001:db8::1"},
+		{Action: "allow", Port: "8000:8100,9000", Protocol: "udp"},
+	} {
+		if err := AddRule(rule); err != nil {
+			t.Fatalf("AddRule(%+v): %v", rule, err)
+		}
+	}
+	want := []string{
+		"ufw limit in on eth0 proto tcp from 10.0.0.0/8 to any port 22 comment ssh from office",
+		"ufw reject out proto tcp from any to 203.0.113.9 port 25",
+		"ufw app list",
+		"ufw allow in from 192.168.1.0/24 to any app Nginx Full",
+		"ufw deny in from 2001:db8::1 to any",
+		"ufw allow in proto udp from any to any port 8000:8100,9000",
+	}
+	if got := strings.Join(calls, "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("unexpected commands:\n%s", got)
+	}
+
+	for _, c := range []struct {
+		rule FirewallRule
+		err  string
+	}{
+		{FirewallRule{Action: "permit", Port: "22"}, "invalid action"},
+		{FirewallRule{Action: "allow", Direction: "fwd", Port: "22"}, "invalid direction"},
+		{FirewallRule{Action: "allow", From: "10.0.0.300", Port: "22"}, "invalid address"},
+		{FirewallRule{Action: "allow", From: "10.0.0.0/8", To: "2001:db8::1"}, "both be IPv4 or IPv6"},
+		{FirewallRule{Action: "allow", Port: "70000"}, "invalid port"},
+		{FirewallRule{Action: "allow", Port: "90:80", Protocol: "tcp"}, "invalid port range"},
+		{FirewallRule{Action: "allow", Port: "80,443"}, "need a protocol"},
+		{FirewallRule{Action: "allow", Port: "22", Protocol: "icmp"}, "invalid protocol"},
+		{FirewallRule{Action: "allow", App: "OpenSSH", Port: "22"}, "cannot be combined"},
+		{FirewallRule{Action: "allow", App: "Postfix"}, "unknown application profile"},
+		{FirewallRule{Action: "allow", Port: "22", Interface: "eth0;id"}, "invalid interface"},
+		{FirewallRule{Action: "allow", Port: "22", Comment: "it's"}, "invalid comment"},
+		{FirewallRule{Action: "deny"}, "needs an address"},
+	} {
+		if err := AddRule(c.rule); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("AddRule(%+v) = %v, want %q", c.rule, err, c.err)
+		}
+	}
+}
+
+func TestAllowDenyPort(t *testing.T) {
+	var calls []string
+	old := run
+	run = func(command string, args ...string) (string, error) {
+		calls = append(calls, strings.Join(append([]string{command}, args...), " "))
+		return "", nil
+	}
+	t.Cleanup(func() { run = old })
+
+	if err := AllowPort("443", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DenyPort("6000:6010", "udp"); err != nil {
+		t.Fatal(err)
+	}
+	want := "ufw allow in proto tcp from any to any port 443\nufw deny in proto udp from any to any port 6000:6010"
+	if got := strings.Join(calls, "\n"); got != want {
+		t.Fatalf("unexpected commands:\n%s", got)
+	}
+	if err := AllowPort("80; rm -rf /", "tcp"); err == nil || err.Error() != "invalid port: 80; rm -rf /" {
+		t.Fatalf("expected the port to be refused, got %v", err)
+	}
+}
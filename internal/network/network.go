@@ -9,11 +9,11 @@ import (
 )
 
 type NetworkInfo struct {
-	Interfaces     []Interface `json:"interfaces"`
-	FirewallStatus string      `json:"firewallStatus"`
-	FirewallRules  []string    `json:"firewallRules"`
-	IPForwarding   bool        `json:"ipForwarding"`
-	Routes         []Route     `json:"routes"`
+	Interfaces     []Interface    `json:"interfaces"`
+	FirewallStatus string         `json:"firewallStatus"`
+	FirewallRules  []FirewallRule `json:"firewallRules"`
+	IPForwarding   bool           `json:"ipForwarding"`
+	Routes         []Route        `json:"routes"`
 }
 
 type Interface struct {
@@ -158,26 +158,6 @@ func getFirewallStatus() (string, error) {
 	return "unknown", nil
 }
 
-func getFirewallRules() ([]string, error) {
-	output, err := util.RunCommand("ufw", "status", "numbered")
-	if err != nil {
-		return []string{}, nil
-	}
-
-	var rules []string
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "Status:") || strings.HasPrefix(line, "To") || strings.HasPrefix(line, "--") {
-			continue
-		}
-		if strings.HasPrefix(line, "[") {
-			rules = append(rules, line)
-		}
-	}
-	return rules, nil
-}
-
 func isIPForwardingEnabled() bool {
 	output, err := util.RunCommandNoSudo("sysctl", "net.ipv4.ip_forward")
 	if err != nil {
@@ -196,22 +176,19 @@ func DisableFirewall() error {
 	return err
 }
 
+// AllowPort allows incoming traffic to a port or range, like `ufw allow 80/tcp`.
+// The protocol defaults to tcp.
 func AllowPort(port, protocol string) error {
-	// Validate port and protocol to prevent injection
-	if !isValidPort(port) {
-		return fmt.Errorf("invalid port: %s", port)
-	}
-	if protocol == "" {
-		protocol = "tcp"
-	}
-	if !isValidProtocol(protocol) {
-		return fmt.Errorf("invalid protocol: %s", protocol)
-	}
-	_, err := util.RunCommand("ufw", "allow", port+"/"+protocol)
-	return err
+	return addPortRule("allow", port, protocol)
 }
 
+// DenyPort denies incoming traffic to a port or range, like `ufw deny 80/tcp`.
+// The protocol defaults to tcp.
 func DenyPort(port, protocol string) error {
+	return addPortRule("deny", port, protocol)
+}
+
+func addPortRule(action, port, protocol string) error {
 	// Validate port and protocol to prevent injection
 	if !isValidPort(port) {
 		return fmt.Errorf("invalid port: %s", port)
@@ -219,11 +196,7 @@ func DenyPort(port, protocol string) error {
 	if protocol == "" {
 		protocol = "tcp"
 	}
-	if !isValidProtocol(protocol) {
-		return fmt.Errorf("invalid protocol: %s", protocol)
-	}
-	_, err := util.RunCommand("ufw", "deny", port+"/"+protocol)
-	return err
+	return AddRule(FirewallRule{Action: action, Port: port, Protocol: protocol})
 }
 
 func DeleteRule(rule string) error {
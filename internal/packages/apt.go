@@ -0,0 +1,347 @@
+package packages
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// apt manages packages on Debian and Ubuntu with dpkg and apt-get.
+type apt struct {
+	run   runFunc
+	query runFunc
+}
+
+func newApt(run, query runFunc) *apt {
+	return &apt{run: run, query: query}
+}
+
+func (a *apt) Name() string {
+	return "apt"
+}
+
+func (a *apt) List() ([]Package, error) {
+	output, err := a.query("dpkg-query", "-W", "-f=${Package}\t${Version}\t${binary:Summary}\n")
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []Package
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) >= 3 {
+			pkgs = append(pkgs, Package{
+				Name:        parts[0],
+				Version:     parts[1],
+				Description: parts[2],
+				Installed:   true,
+				Source:      "apt",
+			})
+		}
+	}
+	return pkgs, nil
+}
+
+func (a *apt) Search(query string) ([]Package, error) {
+	if !isValidSearchQuery(query) {
+		return nil, fmt.Errorf("invalid search query: %s", query)
+	}
+	output, err := a.query("apt-cache", "search", query)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Package
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, " - ", 2)
+		if len(parts) == 2 {
+			results = append(results, Package{
+				Name:        parts[0],
+				Description: parts[1],
+				Installed:   false,
+				Source:      "apt",
+			})
+		}
+	}
+	return results, nil
+}
+
+func (a *apt) Install(pkg string) error {
+	// Validate package name
+	if !isValidPackageName(pkg) {
+		return fmt.Errorf("invalid package name: %s", pkg)
+	}
+	_, err := a.run("apt-get", "install", "-y", pkg)
+	return err
+}
+
+func (a *apt) Remove(pkg string, purge bool) error {
+	// Validate package name
+	if !isValidPackageName(pkg) {
+		return fmt.Errorf("invalid package name: %s", pkg)
+	}
+	action := "remove"
+	if purge {
+		action = "purge"
+	}
+	_, err := a.run("apt-get", action, "-y", pkg)
+	return err
+}
+
+func (a *apt) Update() error {
+	_, err := a.run("apt-get", "update")
+	return err
+}
+
+// Info combines the candidate record from the apt cache with what dpkg
+// knows about the installed version.
+func (a *apt) Info(pkg string) (*Details, error) {
+	if !isValidPackageName(pkg) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPackage, pkg)
+	}
+	output, err := a.query("apt-cache", "show", "--no-all-versions", pkg)
+	if err != nil || strings.TrimSpace(output) == "" {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, pkg)
+	}
+	fields := parseControl(strings.SplitN(output, "\n\n", 2)[0])
+
+	d := newDetails(pkg)
+	d.Candidate = fields["Version"]
+	d.Maintainer = fields["Maintainer"]
+	d.Homepage = fields["Homepage"]
+	description := fields["Description"]
+	if description == "" {
+		description = fields["Description-en"]
+	}
+	d.Description = strings.SplitN(description, "\n", 2)[0]
+	d.Depends = splitDepends(strings.Join([]string{fields["Pre-Depends"], fields["Depends"]}, ","))
+
+	if output, err := a.query("apt-cache", "policy", pkg); err == nil {
+		if candidate, repo := parseAptPolicy(output); candidate != "" {
+			d.Candidate, d.Repository = candidate, repo
+		}
+	}
+	if output, err := a.query("apt-cache", "rdepends", "--installed", pkg); err == nil {
+		d.ReverseDepends = parseAptRdepends(output, pkg)
+	}
+
+	status, err := a.query("dpkg-query", "-W", "-f=${Status}\t${Version}\t${Installed-Size}", pkg)
+	parts := strings.Split(strings.TrimSpace(status), "\t")
+	if err != nil || len(parts) != 3 || !strings.HasSuffix(parts[0], " installed") {
+		return d, nil
+	}
+	d.Version = parts[1]
+	if kib, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+		d.InstalledSize = kib * 1024
+	}
+	if output, err := a.query("dpkg", "-L", pkg); err == nil {
+		for _, file := range nonEmptyLines(output) {
+			if file != "/." {
+				d.Files = append(d.Files, file)
+			}
+		}
+	}
+	d.Changelog = debianChangelog(pkg)
+	return d, nil
+}
+
+// Owner parses `dpkg -S`, which prints "pkg1, pkg2: /path" per match and
+// "diversion by ..." lines for diverted files.
+func (a *apt) Owner(path string) ([]string, error) {
+	output, err := a.query("dpkg", "-S", path)
+	if err != nil {
+		if strings.Contains(output, "no path found") {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("lookup failed: %s", strings.TrimSpace(output))
+	}
+
+	owners := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "diversion by") {
+			continue
+		}
+		i := strings.Index(line, ": ")
+		if i < 0 || strings.TrimSpace(line[i+2:]) != path {
+			continue
+		}
+		owners = append(owners, splitDepends(line[:i])...)
+	}
+	return owners, nil
+}
+
+// parseAptPolicy returns the candidate version and the first repository
+// offering it from `apt-cache policy`:
+//
+//	 Candidate: 1.18.0-6ubuntu14.5
+//	 Version table:
+//	    1.18.0-6ubuntu14.5 500
+//	       500 http://archive.ubuntu.com/ubuntu jammy-updates/main amd64 Packages
+//	*** 1.18.0-6ubuntu14.4 100
+//	       100 /var/lib/dpkg/status
+func parseAptPolicy(output string) (candidate, repo string) {
+	inCandidate := false
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(trimmed, "Candidate:"); ok {
+			candidate = strings.TrimSpace(v)
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(trimmed, "***"))
+		switch {
+		case len(fields) == 2 && !strings.HasPrefix(fields[1], "/") && !strings.HasSuffix(fields[0], ":"):
+			inCandidate = fields[0] == candidate
+		case inCandidate && repo == "" && len(fields) >= 3:
+			repo = fields[1] + " " + fields[2]
+		}
+	}
+	if candidate == "(none)" {
+		candidate = ""
+	}
+	return candidate, repo
+}
+
+// parseAptRdepends lists the packages under "Reverse Depends:". Alternatives
+// are prefixed with "|".
+func parseAptRdepends(output, pkg string) []string {
+	rdeps := []string{}
+	seen := map[string]bool{pkg: true}
+	started := false
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Reverse Depends:") {
+			started = true
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimSpace(line), "|")
+		if !started || name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		rdeps = append(rdeps, name)
+	}
+	return rdeps
+}
+
+// Upgradable parses `apt list --upgradable`:
+//
+//	nginx/jammy-updates,jammy-security 1.18.0-6ubuntu14.5 amd64 [upgradable from: 1.18.0-6ubuntu14.4]
+func (a *apt) Upgradable() ([]Upgradable, error) {
+	output, err := a.query("apt", "list", "--upgradable")
+	if err != nil {
+		return nil, err
+	}
+
+	upgrades := []Upgradable{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.Contains(fields[0], "/") {
+			continue
+		}
+		nameOrigin := strings.SplitN(fields[0], "/", 2)
+		u := Upgradable{
+			Name:             nameOrigin[0],
+			CandidateVersion: fields[1],
+			Origin:           nameOrigin[1],
+			Security:         strings.Contains(nameOrigin[1], "-security"),
+		}
+		if i := strings.Index(line, "[upgradable from: "); i >= 0 {
+			u.CurrentVersion = strings.TrimSuffix(strings.TrimSpace(line[i+len("[upgradable from: "):]), "]")
+		}
+		upgrades = append(upgrades, u)
+	}
+	return upgrades, nil
+}
+
+func (a *apt) SimulateUpgrade(pkgs []string, dist bool) (*Plan, error) {
+	args, err := aptUpgradeArgs(pkgs, dist)
+	if err != nil {
+		return nil, err
+	}
+	return a.simulate(false, args...)
+}
+
+func (a *apt) UpgradePackages(pkgs []string, dist bool) error {
+	args, err := aptUpgradeArgs(pkgs, dist)
+	if err != nil {
+		return err
+	}
+	output, err := a.run("apt-get", append([]string{"-y"}, args...)...)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// aptUpgradeArgs upgrades only the named packages when given, otherwise
+// everything; dist only applies to a full upgrade.
+func aptUpgradeArgs(pkgs []string, dist bool) ([]string, error) {
+	if len(pkgs) == 0 {
+		if dist {
+			return []string{"dist-upgrade"}, nil
+		}
+		return []string{"upgrade"}, nil
+	}
+	for _, pkg := range pkgs {
+		if !isValidPackageName(pkg) {
+			return nil, fmt.Errorf("invalid package name: %s", pkg)
+		}
+	}
+	return append([]string{"install", "--only-upgrade"}, pkgs...), nil
+}
+
+func (a *apt) PreviewInstall(pkg string) (*Plan, error) {
+	if !isValidPackageName(pkg) {
+		return nil, fmt.Errorf("invalid package name: %s", pkg)
+	}
+	return a.simulate(false, "install", pkg)
+}
+
+func (a *apt) PreviewRemove(pkg string, purge bool) (*Plan, error) {
+	if !isValidPackageName(pkg) {
+		return nil, fmt.Errorf("invalid package name: %s", pkg)
+	}
+	action := "remove"
+	if purge {
+		action = "purge"
+	}
+	return a.simulate(purge, action, pkg)
+}
+
+// simulate runs an apt-get action with -s and returns the sized, sealed plan.
+func (a *apt) simulate(purge bool, args ...string) (*Plan, error) {
+	output, err := a.query("apt-get", append([]string{"-s"}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("simulation failed: %s", strings.TrimSpace(output))
+	}
+	plan := parseAptSimulation(output)
+	a.aptSizes(plan)
+	return plan.seal(args[0], purge), nil
+}
+
+func (a *apt) Holds() ([]string, error) {
+	output, err := a.query("apt-mark", "showhold")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list holds: %s", strings.TrimSpace(output))
+	}
+	return nonEmptyLines(output), nil
+}
+
+func (a *apt) SetHold(pkg string, held bool) error {
+	if !isValidPackageName(pkg) {
+		return fmt.Errorf("invalid package name: %s", pkg)
+	}
+	action := "unhold"
+	if held {
+		action = "hold"
+	}
+	if output, err := a.run("apt-mark", action, pkg); err != nil {
+		return fmt.Errorf("apt-mark %s failed: %s", action, strings.TrimSpace(output))
+	}
+	return nil
+}
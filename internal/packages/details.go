@@ -0,0 +1,107 @@
+package packages
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// docDir holds the Debian changelogs installed with each package.
+var docDir = "/usr/share/doc"
+
+const changelogLines = 40
+
+// Details describes one package. Version and InstalledSize are empty for
+// packages that are not installed; Candidate is what an install or upgrade
+// would get and Repository where it comes from.
+type Details struct {
+	Name           string   `json:"name"`
+	Version        string   `json:"version"`
+	Candidate      string   `json:"candidate"`
+	Repository     string   `json:"repository"`
+	InstalledSize  int64    `json:"installedSize"`
+	Maintainer     string   `json:"maintainer"`
+	Homepage       string   `json:"homepage"`
+	Description    string   `json:"description"`
+	Depends        []string `json:"depends"`
+	ReverseDepends []string `json:"reverseDepends"`
+	Files          []string `json:"files"`
+	Changelog      string   `json:"changelog"`
+}
+
+func newDetails(name string) *Details {
+	return &Details{Name: name, Depends: []string{}, ReverseDepends: []string{}, Files: []string{}}
+}
+
+// Owner returns the packages that installed path.
+func Owner(path string) ([]string, error) {
+	if !isValidOwnerPath(path) {
+		return nil, fmt.Errorf("invalid path: %s", path)
+	}
+	return Detect().Owner(path)
+}
+
+// isValidOwnerPath accepts absolute, clean paths. dpkg -S treats wildcards
+// as patterns, so those are rejected too.
+func isValidOwnerPath(path string) bool {
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path || len(path) > 4096 {
+		return false
+	}
+	return !strings.ContainsAny(path, "*?[\n\x00")
+}
+
+// debianChangelog returns the most recent entry of a package's Debian
+// changelog, up to changelogLines lines.
+func debianChangelog(pkg string) string {
+	f, err := os.Open(filepath.Join(docDir, pkg, "changelog.Debian.gz"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return ""
+	}
+	defer gz.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() && len(lines) < changelogLines {
+		line := scanner.Text()
+		lines = append(lines, line)
+		// The trailer line " -- Name <email>  date" closes an entry
+		if strings.HasPrefix(line, " -- ") {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitDepends splits a Depends field into its comma-separated relations.
+func splitDepends(field string) []string {
+	deps := []string{}
+	for _, dep := range strings.Split(field, ",") {
+		if dep = strings.TrimSpace(dep); dep != "" {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// nonEmptyLines returns the trimmed, de-duplicated non-empty lines of output.
+func nonEmptyLines(output string) []string {
+	lines := []string{}
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,484 @@
+package packages
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dnf manages packages on RHEL-family systems with rpm and dnf (or yum).
+type dnf struct {
+	tool  string // "dnf" or "yum"
+	run   runFunc
+	query runFunc
+}
+
+func newDnf(tool string, run, query runFunc) *dnf {
+	return &dnf{tool: tool, run: run, query: query}
+}
+
+func (d *dnf) Name() string {
+	return d.tool
+}
+
+func (d *dnf) List() ([]Package, error) {
+	output, err := d.query("rpm", "-qa", "--queryformat", "%{NAME}\t%{VERSION}-%{RELEASE}\t%{SUMMARY}\n")
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []Package
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.Split(line, "\t")
+		// gpg-pubkey entries are imported signing keys, not packages
+		if len(parts) < 3 || parts[0] == "gpg-pubkey" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name:        parts[0],
+			Version:     parts[1],
+			Description: parts[2],
+			Installed:   true,
+			Source:      d.tool,
+		})
+	}
+	return pkgs, nil
+}
+
+// Search parses `dnf search` output. dnf 4 prints "name.arch : summary" under
+// "=== ... Matched ===" headers; dnf 5 prints " name.arch<TAB>summary".
+func (d *dnf) Search(query string) ([]Package, error) {
+	if !isValidSearchQuery(query) {
+		return nil, fmt.Errorf("invalid search query: %s", query)
+	}
+	output, err := d.query(d.tool, "search", "-q", query)
+	if err != nil {
+		// dnf exits 1 when nothing matches
+		if strings.Contains(output, "No matches found") {
+			return []Package{}, nil
+		}
+		return nil, err
+	}
+
+	var results []Package
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "=") || strings.HasPrefix(line, "Matched fields") {
+			continue
+		}
+		var nameArch, summary string
+		if parts := strings.SplitN(line, " : ", 2); len(parts) == 2 {
+			nameArch, summary = parts[0], parts[1]
+		} else if parts := strings.SplitN(strings.TrimSpace(line), "\t", 2); len(parts) == 2 {
+			nameArch, summary = parts[0], parts[1]
+		} else {
+			continue
+		}
+		name := stripArch(strings.TrimSpace(nameArch))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		results = append(results, Package{
+			Name:        name,
+			Description: strings.TrimSpace(summary),
+			Installed:   false,
+			Source:      d.tool,
+		})
+	}
+	return results, nil
+}
+
+func (d *dnf) Install(pkg string) error {
+	if !isValidRPMName(pkg) {
+		return fmt.Errorf("invalid package name: %s", pkg)
+	}
+	_, err := d.run(d.tool, "install", "-y", pkg)
+	return err
+}
+
+// Remove uninstalls pkg. RPM has no separate purge; config files changed
+// locally are kept as .rpmsave either way.
+func (d *dnf) Remove(pkg string, purge bool) error {
+	if !isValidRPMName(pkg) {
+		return fmt.Errorf("invalid package name: %s", pkg)
+	}
+	_, err := d.run(d.tool, "remove", "-y", pkg)
+	return err
+}
+
+func (d *dnf) Update() error {
+	_, err := d.run(d.tool, "makecache")
+	return err
+}
+
+// Info combines `dnf info` for the installed and available versions with
+// rpm queries for the installed package.
+func (d *dnf) Info(pkg string) (*Details, error) {
+	if !isValidRPMName(pkg) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPackage, pkg)
+	}
+	output, err := d.query(d.tool, "info", "-q", pkg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, pkg)
+	}
+	installed, available := parseDnfInfo(output)
+	if installed == nil && available == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, pkg)
+	}
+
+	details := newDetails(pkg)
+	if available != nil {
+		details.Candidate = dnfEVR(available)
+		details.Repository = available["Repository"]
+		details.Homepage = available["URL"]
+		details.Description = available["Summary"]
+	}
+	if installed == nil {
+		return details, nil
+	}
+
+	details.Version = dnfEVR(installed)
+	if details.Candidate == "" {
+		details.Candidate = details.Version
+		details.Repository = installed["From repo"]
+	}
+	details.Homepage = installed["URL"]
+	details.Description = installed["Summary"]
+
+	if output, err := d.query("rpm", "-q", "--queryformat", "%{SIZE}\t%{PACKAGER}\t%{VENDOR}\n", pkg); err == nil {
+		parts := strings.Split(strings.TrimSpace(output), "\t")
+		if len(parts) == 3 {
+			details.InstalledSize, _ = strconv.ParseInt(parts[0], 10, 64)
+			details.Maintainer = parts[1]
+			if details.Maintainer == "(none)" {
+				details.Maintainer = parts[2]
+			}
+		}
+	}
+	if output, err := d.query("rpm", "-qR", pkg); err == nil {
+		for _, dep := range nonEmptyLines(output) {
+			if !strings.HasPrefix(dep, "rpmlib(") {
+				details.Depends = append(details.Depends, dep)
+			}
+		}
+	}
+	if output, err := d.query("rpm", "-q", "--whatrequires", pkg, "--queryformat", "%{NAME}\n"); err == nil {
+		details.ReverseDepends = nonEmptyLines(output)
+	}
+	if output, err := d.query("rpm", "-ql", pkg); err == nil && !strings.Contains(output, "(contains no files)") {
+		details.Files = nonEmptyLines(output)
+	}
+	if output, err := d.query("rpm", "-q", "--changelog", pkg); err == nil {
+		details.Changelog = rpmChangelog(output)
+	}
+	return details, nil
+}
+
+// Owner parses `rpm -qf`, which prints one package name per owner.
+func (d *dnf) Owner(path string) ([]string, error) {
+	output, err := d.query("rpm", "-qf", "--queryformat", "%{NAME}\n", path)
+	if strings.Contains(output, "not owned by any package") {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup failed: %s", strings.TrimSpace(output))
+	}
+	return nonEmptyLines(output), nil
+}
+
+// stripArch removes the trailing ".arch" from "name.arch".
+func stripArch(nameArch string) string {
+	if i := strings.LastIndex(nameArch, "."); i > 0 {
+		switch nameArch[i+1:] {
+		case "x86_64", "noarch", "i686", "aarch64", "ppc64le", "s390x", "armv7hl", "src":
+			return nameArch[:i]
+		}
+	}
+	return nameArch
+}
+
+// Upgradable parses `dnf check-update`, which exits 100 when updates exist,
+// and flags packages listed by `dnf updateinfo list --security`.
+func (d *dnf) Upgradable() ([]Upgradable, error) {
+	output, err := d.query(d.tool, "-q", "check-update")
+	if err != nil && exitCode(err) != 100 {
+		return nil, fmt.Errorf("check-update failed: %s", strings.TrimSpace(output))
+	}
+
+	installed := d.installedVersions()
+	advisories, _ := d.query(d.tool, "-q", "updateinfo", "list", "--security", "--updates")
+
+	upgrades := []Upgradable{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(line, " ") {
+			continue
+		}
+		name := stripArch(fields[0])
+		upgrades = append(upgrades, Upgradable{
+			Name:             name,
+			CurrentVersion:   installed[name],
+			CandidateVersion: fields[1],
+			Origin:           fields[2],
+			Security:         hasAdvisory(advisories, name, fields[1]),
+		})
+	}
+	return upgrades, nil
+}
+
+func (d *dnf) SimulateUpgrade(pkgs []string, dist bool) (*Plan, error) {
+	args, err := dnfUpgradeArgs(pkgs, dist)
+	if err != nil {
+		return nil, err
+	}
+	return d.simulate(false, args...)
+}
+
+func (d *dnf) PreviewInstall(pkg string) (*Plan, error) {
+	if !isValidRPMName(pkg) {
+		return nil, fmt.Errorf("invalid package name: %s", pkg)
+	}
+	return d.simulate(false, "install", pkg)
+}
+
+func (d *dnf) PreviewRemove(pkg string, purge bool) (*Plan, error) {
+	if !isValidRPMName(pkg) {
+		return nil, fmt.Errorf("invalid package name: %s", pkg)
+	}
+	return d.simulate(purge, "remove", pkg)
+}
+
+// simulate resolves a transaction with --assumeno, which prints it and
+// exits 1 without changing anything.
+func (d *dnf) simulate(purge bool, args ...string) (*Plan, error) {
+	output, _ := d.run(d.tool, append(args, "--assumeno")...)
+	if !strings.Contains(output, "Transaction Summary") && !strings.Contains(output, "Nothing to do") {
+		return nil, fmt.Errorf("simulation failed: %s", strings.TrimSpace(output))
+	}
+	plan := parseDnfTransaction(output, d.installedVersions())
+	parseDnfSizes(output, plan)
+	return plan.seal(args[0], purge), nil
+}
+
+func (d *dnf) UpgradePackages(pkgs []string, dist bool) error {
+	args, err := dnfUpgradeArgs(pkgs, dist)
+	if err != nil {
+		return err
+	}
+	output, err := d.run(d.tool, append(args, "-y")...)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
+
+func dnfUpgradeArgs(pkgs []string, dist bool) ([]string, error) {
+	action := "upgrade"
+	if dist {
+		action = "distro-sync"
+	}
+	for _, pkg := range pkgs {
+		if !isValidRPMName(pkg) {
+			return nil, fmt.Errorf("invalid package name: %s", pkg)
+		}
+	}
+	return append([]string{action}, pkgs...), nil
+}
+
+func (d *dnf) installedVersions() map[string]string {
+	versions := make(map[string]string)
+	pkgs, err := d.List()
+	if err != nil {
+		return versions
+	}
+	for _, p := range pkgs {
+		versions[p.Name] = p.Version
+	}
+	return versions
+}
+
+// hasAdvisory reports whether a security advisory line names the given
+// package version ("RHSA-2024:1234 Important/Sec. openssl-1:3.0.7-25.el9_3.x86_64").
+func hasAdvisory(advisories, name, version string) bool {
+	for _, line := range strings.Split(advisories, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		nevra := fields[len(fields)-1]
+		if strings.HasPrefix(nevra, name+"-") && strings.Contains(nevra, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDnfTransaction reads the package table of a dnf transaction. Rows are
+// indented under section headers such as "Upgrading:" or "Removing:".
+func parseDnfTransaction(output string, installed map[string]string) *Plan {
+	plan := newPlan()
+	var section *[]PlanItem
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "Transaction Summary"):
+			return plan
+		case !strings.HasPrefix(line, " ") && strings.HasSuffix(trimmed, ":"):
+			switch {
+			case strings.HasPrefix(trimmed, "Upgrading"):
+				section = &plan.Upgrade
+			case strings.HasPrefix(trimmed, "Installing"):
+				section = &plan.Install
+			case strings.HasPrefix(trimmed, "Removing"):
+				section = &plan.Remove
+			default:
+				section = nil
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if section == nil || !strings.HasPrefix(line, " ") || len(fields) < 4 || fields[0] == "replacing" {
+			continue
+		}
+		item := PlanItem{Name: fields[0], NewVersion: fields[2], Origin: fields[3], OldVersion: installed[fields[0]]}
+		if section == &plan.Remove {
+			item = PlanItem{Name: fields[0], OldVersion: fields[2]}
+		}
+		*section = append(*section, item)
+	}
+	return plan
+}
+
+// parseDnfInfo splits `dnf info` output into the fields of the installed and
+// the available package. Each field is a "Key : value" line; dnf 4 titles
+// the sections "Installed Packages", dnf 5 "Installed packages".
+func parseDnfInfo(output string) (installed, available map[string]string) {
+	var current map[string]string
+	for _, line := range strings.Split(output, "\n") {
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "installed packages":
+			if installed == nil {
+				installed = make(map[string]string)
+			}
+			current = installed
+			continue
+		case "available packages", "available upgrades":
+			if available == nil {
+				available = make(map[string]string)
+			}
+			current = available
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || current == nil || key == "" {
+			continue
+		}
+		// Only keep the first package listed in each section
+		if _, seen := current[key]; !seen {
+			current[key] = strings.TrimSpace(value)
+		}
+	}
+	return installed, available
+}
+
+// dnfEVR formats the epoch, version and release of a dnf info section.
+func dnfEVR(fields map[string]string) string {
+	evr := fields["Version"]
+	if release := fields["Release"]; release != "" {
+		evr += "-" + release
+	}
+	if epoch := fields["Epoch"]; epoch != "" && epoch != "0" {
+		evr = epoch + ":" + evr
+	}
+	return evr
+}
+
+// rpmChangelog returns the first entry of `rpm -q --changelog`, which starts
+// with a "* date author - version" line and ends at a blank line.
+func rpmChangelog(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if (strings.TrimSpace(line) == "" && len(lines) > 0) || len(lines) == changelogLines {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// History parses the dnf 4 `history list` table. It names the command line
+// and time of each transaction but not the packages involved:
+//
+//	ID     | Command line   | Date and time    | Action(s)      | Altered
+//	     5 | install -y jq  | 2024-01-10 10:12 | Install        |    2
+func (d *dnf) History() ([]Transaction, error) {
+	output, err := d.query(d.tool, "history", "list")
+	if err != nil {
+		return nil, fmt.Errorf("history failed: %s", strings.TrimSpace(output))
+	}
+
+	txs := []Transaction{}
+	for _, line := range strings.Split(output, "\n") {
+		cols := strings.Split(line, "|")
+		if len(cols) != 5 {
+			continue
+		}
+		start := parseLogTime("2006-01-02 15:04", strings.TrimSpace(cols[2]))
+		if start.IsZero() {
+			continue
+		}
+		tx := newTransaction(d.tool)
+		tx.Start, tx.End = start, start
+		tx.CommandLine = d.tool + " " + strings.TrimSpace(cols[1])
+		txs = append(txs, *tx)
+	}
+	return txs, nil
+}
+
+// Holds parses `dnf versionlock list`. dnf 4 prints one locked NEVRA per
+// line ("nginx-1:1.20.1-14.el9.*"); dnf 5 prints "Package name: nginx".
+// Both need the versionlock plugin.
+func (d *dnf) Holds() ([]string, error) {
+	output, err := d.query(d.tool, "-q", "versionlock", "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list version locks: %s", strings.TrimSpace(output))
+	}
+	holds := []string{}
+	for _, line := range nonEmptyLines(output) {
+		var name string
+		switch {
+		case strings.HasPrefix(line, "#") || strings.HasPrefix(line, "evr ") || strings.HasPrefix(line, "Last metadata"):
+			continue
+		case strings.HasPrefix(line, "Package name:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "Package name:"))
+		default:
+			name = nameFromNEVRA(strings.TrimPrefix(line, "!"))
+		}
+		if name != "" && !contains(holds, name) {
+			holds = append(holds, name)
+		}
+	}
+	return holds, nil
+}
+
+func (d *dnf) SetHold(pkg string, held bool) error {
+	if !isValidRPMName(pkg) {
+		return fmt.Errorf("invalid package name: %s", pkg)
+	}
+	action := "delete"
+	if held {
+		action = "add"
+	}
+	if output, err := d.run(d.tool, "versionlock", action, pkg); err != nil {
+		return fmt.Errorf("versionlock %s failed: %s", action, strings.TrimSpace(output))
+	}
+	return nil
+}
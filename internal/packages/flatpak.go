@@ -0,0 +1,164 @@
+package packages
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flatpakRemote is where apps are installed from when no remote is named.
+const flatpakRemote = "flathub"
+
+// flatpak manages system-wide flatpak applications.
+type flatpak struct {
+	run   runFunc
+	query runFunc
+}
+
+func newFlatpak(run, query runFunc) *flatpak {
+	return &flatpak{run: run, query: query}
+}
+
+func (f *flatpak) Name() string {
+	return "flatpak"
+}
+
+// List parses `flatpak list --system --app` with tab-separated columns. Per-user
+// installations are left out, as the other operations act on the system one.
+func (f *flatpak) List() ([]Package, error) {
+	output, err := f.query("flatpak", "list", "--system", "--app", "--columns=application,version,branch,name")
+	if err != nil {
+		return nil, fmt.Errorf("flatpak list failed: %s", strings.TrimSpace(output))
+	}
+
+	pkgs := []Package{}
+	for _, line := range strings.Split(output, "\n") {
+		cols := strings.Split(line, "\t")
+		if len(cols) < 4 || cols[0] == "" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name:        cols[0],
+			Version:     cols[1],
+			Description: cols[3],
+			Installed:   true,
+			Source:      "flatpak",
+			Channel:     cols[2],
+		})
+	}
+	return pkgs, nil
+}
+
+func (f *flatpak) Search(query string) ([]Package, error) {
+	if !isValidSearchQuery(query) {
+		return nil, fmt.Errorf("invalid search query: %s", query)
+	}
+	output, err := f.query("flatpak", "search", "--columns=application,version,branch,description", query)
+	if err != nil {
+		return nil, fmt.Errorf("flatpak search failed: %s", strings.TrimSpace(output))
+	}
+
+	results := []Package{}
+	for _, line := range strings.Split(output, "\n") {
+		cols := strings.Split(line, "\t")
+		// "No matches found" is a single column
+		if len(cols) < 4 {
+			continue
+		}
+		results = append(results, Package{
+			Name:        cols[0],
+			Version:     cols[1],
+			Description: cols[3],
+			Source:      "flatpak",
+			Channel:     cols[2],
+		})
+	}
+	return results, nil
+}
+
+// Install installs an app from flathub, on branch channel when given.
+func (f *flatpak) Install(pkg, channel string, classic bool) error {
+	ref, err := flatpakRef(pkg, channel)
+	if err != nil {
+		return err
+	}
+	return f.flatpak("install", flatpakRemote, ref)
+}
+
+func (f *flatpak) Remove(pkg string) error {
+	if !isValidFlatpakID(pkg) {
+		return fmt.Errorf("invalid application ID: %s", pkg)
+	}
+	return f.flatpak("uninstall", pkg)
+}
+
+// Refresh updates one app, or everything when pkg is empty.
+func (f *flatpak) Refresh(pkg string) error {
+	if pkg == "" {
+		return f.flatpak("update")
+	}
+	if !isValidFlatpakID(pkg) {
+		return fmt.Errorf("invalid application ID: %s", pkg)
+	}
+	return f.flatpak("update", pkg)
+}
+
+// SwitchChannel installs the app from another branch and removes the
+// branches installed before. Flatpak keeps branches side by side, so there
+// is no in-place switch.
+func (f *flatpak) SwitchChannel(pkg, channel string) error {
+	ref, err := flatpakRef(pkg, channel)
+	if err != nil {
+		return err
+	}
+	installed, err := f.List()
+	if err != nil {
+		return err
+	}
+	if err := f.flatpak("install", flatpakRemote, ref); err != nil {
+		return err
+	}
+	for _, p := range installed {
+		if p.Name == pkg && p.Channel != channel {
+			if err := f.flatpak("uninstall", pkg+"//"+p.Channel); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *flatpak) flatpak(action string, args ...string) error {
+	full := append([]string{action, "-y", "--noninteractive", "--system"}, args...)
+	if output, err := f.run("flatpak", full...); err != nil {
+		return fmt.Errorf("flatpak %s failed: %s", action, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// flatpakRef builds "app" or "app//branch".
+func flatpakRef(pkg, channel string) (string, error) {
+	if !isValidFlatpakID(pkg) {
+		return "", fmt.Errorf("invalid application ID: %s", pkg)
+	}
+	if channel == "" {
+		return pkg, nil
+	}
+	if !isValidChannel(channel) || strings.Contains(channel, "/") {
+		return "", fmt.Errorf("invalid branch: %s", channel)
+	}
+	return pkg + "//" + channel, nil
+}
+
+// isValidFlatpakID checks reverse-DNS application IDs such as
+// org.mozilla.firefox.
+func isValidFlatpakID(id string) bool {
+	if len(id) > 255 || strings.Count(id, ".") < 2 || id[0] == '-' || id[0] == '.' {
+		return false
+	}
+	for _, c := range id {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
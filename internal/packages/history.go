@@ -0,0 +1,315 @@
+package packages
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"orbit/internal/audit"
+)
+
+// aptLogDir and dpkgLogDir hold the apt and dpkg logs and their rotations.
+var (
+	aptLogDir  = "/var/log/apt"
+	dpkgLogDir = "/var/log"
+)
+
+// orbitWindow is how long after a transaction ends the audit entry of the
+// Orbit request that started it may be written.
+const orbitWindow = time.Minute
+
+// Transaction is one recorded package operation. Source is "apt" for
+// apt-get/apt runs, "dpkg" for direct dpkg invocations, or the dnf tool.
+type Transaction struct {
+	Start       time.Time    `json:"start"`
+	End         time.Time    `json:"end"`
+	Source      string       `json:"source"`
+	CommandLine string       `json:"commandLine"`
+	RequestedBy string       `json:"requestedBy"`
+	Installed   []PlanItem   `json:"installed"`
+	Upgraded    []PlanItem   `json:"upgraded"`
+	Removed     []PlanItem   `json:"removed"`
+	Orbit       *audit.Entry `json:"orbit,omitempty"`
+}
+
+func newTransaction(source string) *Transaction {
+	return &Transaction{Source: source, Installed: []PlanItem{}, Upgraded: []PlanItem{}, Removed: []PlanItem{}}
+}
+
+// History returns up to limit package transactions, newest first. Those
+// started through the Orbit API carry the matching audit entry.
+func History(limit int) ([]Transaction, error) {
+	txs, err := Detect().History()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Start.After(txs[j].Start) })
+	if limit > 0 && len(txs) > limit {
+		txs = txs[:limit]
+	}
+	if entries, err := audit.Entries(); err == nil {
+		correlate(txs, entries)
+	}
+	return txs, nil
+}
+
+// transactionPaths are the API endpoints that run a package transaction.
+var transactionPaths = []string{
+	"/api/packages/install",
+	"/api/packages/remove",
+	"/api/packages/upgrade",
+	"/api/packages/unattended/run",
+}
+
+// correlate attaches to transactions the Orbit package request that was
+// logged closest after each ended. Audit entries are written when the
+// request completes, so they follow the transaction they caused. The closest
+// pairs are matched first and each entry is used once.
+func correlate(txs []Transaction, entries []audit.Entry) {
+	type match struct {
+		tx, entry int
+		gap       time.Duration
+	}
+	var matches []match
+	for i := range txs {
+		end := txs[i].End
+		if end.IsZero() {
+			end = txs[i].Start
+		}
+		for j := range entries {
+			if !isPackageChange(&entries[j]) {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, entries[j].Time)
+			if err != nil {
+				continue
+			}
+			// Audit times have second precision
+			gap := t.Sub(end.Truncate(time.Second))
+			if t.Before(txs[i].Start.Truncate(time.Second)) || gap > orbitWindow {
+				continue
+			}
+			matches = append(matches, match{i, j, gap})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].gap < matches[b].gap })
+
+	used := make(map[int]bool)
+	for _, m := range matches {
+		if txs[m.tx].Orbit != nil || used[m.entry] {
+			continue
+		}
+		entry := entries[m.entry]
+		txs[m.tx].Orbit = &entry
+		used[m.entry] = true
+	}
+}
+
+// isPackageChange reports whether an audit entry is a successful request
+// that runs a package transaction, as opposed to a preview or a change to
+// repositories, keys, holds or other settings.
+func isPackageChange(e *audit.Entry) bool {
+	if e.Method != "POST" || e.Status >= 400 {
+		return false
+	}
+	if strings.HasPrefix(e.Path, "/api/packages/providers/") {
+		return true
+	}
+	for _, path := range transactionPaths {
+		if e.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// History reads the apt history log, then adds the dpkg runs from dpkg.log
+// that were not part of an apt transaction (for example `dpkg -i`).
+func (a *apt) History() ([]Transaction, error) {
+	var txs []Transaction
+	for _, data := range readRotated(aptLogDir, "history.log") {
+		txs = append(txs, parseAptHistory(data)...)
+	}
+	for _, data := range readRotated(dpkgLogDir, "dpkg.log") {
+		for _, tx := range parseDpkgLog(data) {
+			if !withinApt(txs, tx.Start) {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	if txs == nil {
+		txs = []Transaction{}
+	}
+	return txs, nil
+}
+
+func withinApt(txs []Transaction, t time.Time) bool {
+	for _, tx := range txs {
+		if tx.Source == "apt" && !t.Before(tx.Start) && !t.After(tx.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// readRotated returns the contents of a log and its rotations (name.1,
+// name.2.gz, ...), skipping any that cannot be read.
+func readRotated(dir, name string) []string {
+	paths, _ := filepath.Glob(filepath.Join(dir, name+"*"))
+	var contents []string
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				f.Close()
+				continue
+			}
+			r = gz
+		}
+		data, err := io.ReadAll(r)
+		f.Close()
+		if err == nil {
+			contents = append(contents, string(data))
+		}
+	}
+	return contents
+}
+
+// aptHistoryItem matches "name:arch (version)", "name:arch (version, automatic)"
+// and "name:arch (old, new)" in history.log package lists.
+var aptHistoryItem = regexp.MustCompile(`([^\s,()]+) \(([^)]*)\)`)
+
+// parseAptHistory reads the blank-line separated records of
+// /var/log/apt/history.log:
+//
+//	Start-Date: 2024-01-10  10:12:33
+//	Commandline: apt-get install -y jq
+//	Requested-By: alice (1000)
+//	Install: jq:amd64 (1.6-2.1ubuntu3), libjq1:amd64 (1.6-2.1ubuntu3, automatic)
+//	Upgrade: nginx:amd64 (1.18.0-6ubuntu14.4, 1.18.0-6ubuntu14.5)
+//	End-Date: 2024-01-10  10:12:35
+func parseAptHistory(data string) []Transaction {
+	var txs []Transaction
+	var tx *Transaction
+	for _, line := range strings.Split(data, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if key == "Start-Date" {
+			tx = newTransaction("apt")
+			tx.Start = parseLogTime("2006-01-02  15:04:05", value)
+			continue
+		}
+		if tx == nil {
+			continue
+		}
+		switch key {
+		case "End-Date":
+			tx.End = parseLogTime("2006-01-02  15:04:05", value)
+			txs = append(txs, *tx)
+			tx = nil
+		case "Commandline":
+			tx.CommandLine = value
+		case "Requested-By":
+			tx.RequestedBy = value
+		case "Install", "Reinstall":
+			for _, m := range aptHistoryItem.FindAllStringSubmatch(value, -1) {
+				version := strings.TrimSuffix(m[2], ", automatic")
+				tx.Installed = append(tx.Installed, PlanItem{Name: stripDebArch(m[1]), NewVersion: version})
+			}
+		case "Upgrade", "Downgrade":
+			for _, m := range aptHistoryItem.FindAllStringSubmatch(value, -1) {
+				oldVersion, newVersion, _ := strings.Cut(m[2], ", ")
+				tx.Upgraded = append(tx.Upgraded, PlanItem{Name: stripDebArch(m[1]), OldVersion: oldVersion, NewVersion: newVersion})
+			}
+		case "Remove", "Purge":
+			for _, m := range aptHistoryItem.FindAllStringSubmatch(value, -1) {
+				tx.Removed = append(tx.Removed, PlanItem{Name: stripDebArch(m[1]), OldVersion: m[2]})
+			}
+		}
+	}
+	return txs
+}
+
+// parseDpkgLog groups the package actions in dpkg.log by dpkg invocation.
+// dpkg does not log its command line; each invocation begins with a
+// "startup" line:
+//
+//	2024-01-10 10:12:34 startup archives unpack
+//	2024-01-10 10:12:34 install jq:amd64 <none> 1.6-2.1ubuntu3
+//	2024-01-10 10:12:35 upgrade nginx:amd64 1.18.0-6ubuntu14.4 1.18.0-6ubuntu14.5
+//	2024-01-10 10:12:36 remove foo:amd64 1.0-1 <none>
+func parseDpkgLog(data string) []Transaction {
+	var txs []Transaction
+	var tx *Transaction
+	flush := func() {
+		if tx != nil && len(tx.Installed)+len(tx.Upgraded)+len(tx.Removed) > 0 {
+			txs = append(txs, *tx)
+		}
+		tx = nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		t := parseLogTime("2006-01-02 15:04:05", fields[0]+" "+fields[1])
+		if fields[2] == "startup" {
+			flush()
+			tx = newTransaction("dpkg")
+			tx.Start, tx.End = t, t
+			continue
+		}
+		if tx == nil || len(fields) != 6 {
+			continue
+		}
+		name, oldVersion, newVersion := stripDebArch(fields[3]), fields[4], fields[5]
+		switch fields[2] {
+		case "install":
+			if oldVersion == "<none>" {
+				tx.Installed = append(tx.Installed, PlanItem{Name: name, NewVersion: newVersion})
+			} else {
+				tx.Upgraded = append(tx.Upgraded, PlanItem{Name: name, OldVersion: oldVersion, NewVersion: newVersion})
+			}
+		case "upgrade":
+			tx.Upgraded = append(tx.Upgraded, PlanItem{Name: name, OldVersion: oldVersion, NewVersion: newVersion})
+		case "remove", "purge":
+			tx.Removed = append(tx.Removed, PlanItem{Name: name, OldVersion: oldVersion})
+		default:
+			continue
+		}
+		tx.End = t
+	}
+	flush()
+	return txs
+}
+
+func parseLogTime(layout, value string) time.Time {
+	t, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// stripDebArch removes the ":arch" qualifier from "name:arch".
+func stripDebArch(name string) string {
+	if i := strings.Index(name, ":"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,202 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// preferencesDir holds apt pin files.
+var preferencesDir = "/etc/apt/preferences.d"
+
+// Pin is one stanza of an apt preferences file. Name is the file it lives
+// in; Package is a space-separated list of names or glob patterns and Pin a
+// "version", "release" or "origin" selector.
+type Pin struct {
+	Name        string `json:"name"`
+	Package     string `json:"package"`
+	Pin         string `json:"pin"`
+	Priority    int    `json:"priority"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// Holds returns the packages held back from upgrades.
+func Holds() ([]string, error) {
+	return Detect().Holds()
+}
+
+// SetHold holds pkg at its installed version, or releases the hold.
+func SetHold(pkg string, held bool) error {
+	return Detect().SetHold(pkg, held)
+}
+
+// ListPins returns the stanzas of every file in preferences.d.
+func ListPins() ([]Pin, error) {
+	if _, err := aptOnly(); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(preferencesDir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	pins := []Pin{}
+	for _, p := range paths {
+		name := filepath.Base(p)
+		if !isPreferencesFile(name) {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		pins = append(pins, parsePreferences(name, string(data))...)
+	}
+	return pins, nil
+}
+
+// SavePin writes pin as the only stanza of its preferences file.
+func SavePin(pin Pin) error {
+	a, err := aptOnly()
+	if err != nil {
+		return err
+	}
+	if err := validatePin(pin); err != nil {
+		return err
+	}
+	return writeRootFile(a.run, renderPin(pin), filepath.Join(preferencesDir, pin.Name), "0644")
+}
+
+// DeletePin removes a preferences file.
+func DeletePin(name string) error {
+	a, err := aptOnly()
+	if err != nil {
+		return err
+	}
+	if !isPreferencesFile(name) || !isValidRepoName(name) {
+		return fmt.Errorf("invalid pin file name: %s", name)
+	}
+	p := filepath.Join(preferencesDir, name)
+	if _, err := os.Stat(p); err != nil {
+		return fmt.Errorf("pin file not found: %s", name)
+	}
+	if _, err := a.run("rm", "-f", p); err != nil {
+		return fmt.Errorf("failed to delete pin file: %w", err)
+	}
+	return nil
+}
+
+// isPreferencesFile follows apt, which reads files in preferences.d that
+// have no extension or end in ".pref".
+func isPreferencesFile(name string) bool {
+	return !strings.Contains(name, ".") || strings.HasSuffix(name, ".pref")
+}
+
+func validatePin(pin Pin) error {
+	if !isPreferencesFile(pin.Name) || !isValidRepoName(pin.Name) {
+		return fmt.Errorf("invalid pin file name: %s (no extension or .pref)", pin.Name)
+	}
+	patterns := strings.Fields(pin.Package)
+	if len(patterns) == 0 {
+		return fmt.Errorf("package is required")
+	}
+	for _, p := range patterns {
+		if !isValidPackageName(strings.ReplaceAll(p, "*", "x")) {
+			return fmt.Errorf("invalid package pattern: %s", p)
+		}
+	}
+	kind, value, _ := strings.Cut(pin.Pin, " ")
+	if (kind != "version" && kind != "release" && kind != "origin") || strings.TrimSpace(value) == "" {
+		return fmt.Errorf("pin must be \"version ...\", \"release ...\" or \"origin ...\"")
+	}
+	if strings.ContainsAny(pin.Pin+pin.Explanation, "\n\r") {
+		return fmt.Errorf("pin fields must be single lines")
+	}
+	if pin.Priority < -32768 || pin.Priority > 32767 {
+		return fmt.Errorf("invalid priority: %d", pin.Priority)
+	}
+	return nil
+}
+
+// parsePreferences reads the blank-line separated stanzas of a preferences
+// file:
+//
+//	Explanation: hold PostgreSQL at 15
+//	Package: postgresql-15 postgresql-client-15
+//	Pin: version 15.5-*
+//	Pin-Priority: 1001
+func parsePreferences(name, data string) []Pin {
+	pins := []Pin{}
+	for _, stanza := range strings.Split(data, "\n\n") {
+		fields := parseControl(stanza)
+		if fields["Package"] == "" || fields["Pin"] == "" {
+			continue
+		}
+		priority, _ := strconv.Atoi(fields["Pin-Priority"])
+		pins = append(pins, Pin{
+			Name:        name,
+			Package:     fields["Package"],
+			Pin:         fields["Pin"],
+			Priority:    priority,
+			Explanation: fields["Explanation"],
+		})
+	}
+	return pins
+}
+
+func renderPin(pin Pin) string {
+	var b strings.Builder
+	if pin.Explanation != "" {
+		fmt.Fprintf(&b, "Explanation: %s\n", pin.Explanation)
+	}
+	fmt.Fprintf(&b, "Package: %s\n", strings.Join(strings.Fields(pin.Package), " "))
+	fmt.Fprintf(&b, "Pin: %s\n", pin.Pin)
+	fmt.Fprintf(&b, "Pin-Priority: %d\n", pin.Priority)
+	return b.String()
+}
+
+// matchingPin returns the first pin whose package patterns match name.
+func matchingPin(pins []Pin, name string) *Pin {
+	for i := range pins {
+		for _, pattern := range strings.Fields(pins[i].Package) {
+			if ok, _ := path.Match(pattern, name); ok {
+				return &pins[i]
+			}
+		}
+	}
+	return nil
+}
+
+// markHeldAndPinned flags upgrades that a hold or pin keeps back, so the
+// upgradable view shows why a blanket upgrade leaves them alone.
+func markHeldAndPinned(upgrades []Upgradable, holds []string, pins []Pin) {
+	held := make(map[string]bool, len(holds))
+	for _, h := range holds {
+		held[h] = true
+	}
+	for i := range upgrades {
+		upgrades[i].Held = held[upgrades[i].Name]
+		if pin := matchingPin(pins, upgrades[i].Name); pin != nil {
+			upgrades[i].Pin = fmt.Sprintf("%s (%d)", pin.Pin, pin.Priority)
+		}
+	}
+}
+
+// nameFromNEVRA strips "-[epoch:]version-release[.arch|.*]" from a dnf
+// versionlock entry such as "nginx-1:1.20.1-14.el9.*".
+func nameFromNEVRA(nevra string) string {
+	s := nevra
+	for i := 0; i < 2; i++ {
+		j := strings.LastIndex(s, "-")
+		if j <= 0 {
+			return nevra
+		}
+		s = s[:j]
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package packages
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPins(t *testing.T) {
+	pin := Pin{Name: "postgresql", Package: "postgresql-15  postgresql-client-15", Pin: "version 15.5-*", Priority: 1001, Explanation: "hold PostgreSQL at 15.5"}
+	if err := validatePin(pin); err != nil {
+		t.Fatal(err)
+	}
+	parsed := parsePreferences("postgresql", renderPin(pin))
+	if len(parsed) != 1 || parsed[0].Package != "postgresql-15 postgresql-client-15" || parsed[0].Priority != 1001 || parsed[0].Explanation != pin.Explanation {
+		t.Fatalf("unexpected round trip: %+v", parsed)
+	}
+
+	invalid := map[string]func(p *Pin){
+		"extension": func(p *Pin) { p.Name = "postgresql.conf" },
+		"selector":  func(p *Pin) { p.Pin = "15.5" },
+		"newline":   func(p *Pin) { p.Pin = "version 1\nPin-Priority: 1001" },
+		"package":   func(p *Pin) { p.Package = "Postgres;" },
+		"priority":  func(p *Pin) { p.Priority = 40000 },
+	}
+	for name, mutate := range invalid {
+		p := pin
+		mutate(&p)
+		if err := validatePin(p); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+
+	pins := append(parsed, Pin{Name: "kernel", Package: "linux-image-*", Pin: "release a=jammy", Priority: -1})
+	upgrades := []Upgradable{{Name: "postgresql-15"}, {Name: "linux-image-generic"}, {Name: "nginx"}}
+	markHeldAndPinned(upgrades, []string{"nginx"}, pins)
+	if upgrades[0].Pin != "version 15.5-* (1001)" || upgrades[1].Pin != "release a=jammy (-1)" {
+		t.Fatalf("unexpected pins: %+v", upgrades)
+	}
+	if !upgrades[2].Held || upgrades[2].Pin != "" || upgrades[0].Held {
+		t.Fatalf("unexpected holds: %+v", upgrades)
+	}
+}
+
+func TestHolds(t *testing.T) {
+	var calls []string
+	run := recorded(t, nil, &calls)
+	query := func(command string, args ...string) (string, error) {
+		switch strings.Join(append([]string{command}, args...), " ") {
+		case "apt-mark showhold":
+			return "linux-image-generic\npostgresql-15\n", nil
+		case "dnf -q versionlock list":
+			return "nginx-1:1.20.1-14.el9.*\nkernel-core-0:5.14.0-362.8.1.el9_3.*\n", nil
+		case "dnf5 -q versionlock list":
+			return "# Added by 'versionlock add' command on 2024-01-10 10:12:33\nPackage name: nginx\nevr = 1:1.20.1-14.el9\n", nil
+		}
+		return "", nil
+	}
+
+	holds, err := newApt(run, query).Holds()
+	if err != nil || strings.Join(holds, ",") != "linux-image-generic,postgresql-15" {
+		t.Fatalf("unexpected apt holds: %v %v", holds, err)
+	}
+	holds, err = newDnf("dnf", run, query).Holds()
+	if err != nil || strings.Join(holds, ",") != "nginx,kernel-core" {
+		t.Fatalf("unexpected dnf holds: %v %v", holds, err)
+	}
+	holds, err = newDnf("dnf5", run, query).Holds()
+	if err != nil || strings.Join(holds, ",") != "nginx" {
+		t.Fatalf("unexpected dnf5 holds: %v %v", holds, err)
+	}
+
+	if err := newApt(run, query).SetHold("nginx", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := newDnf("dnf", run, query).SetHold("nginx", false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, "; ") != "apt-mark hold nginx; dnf versionlock delete nginx" {
+		t.Fatalf("unexpected commands: %v", calls)
+	}
+}
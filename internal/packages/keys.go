@@ -0,0 +1,223 @@
+package packages
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxKeySize   = 1 << 20
+	keyFetchWait = 30 * time.Second
+)
+
+// Key is an OpenPGP keyring in the apt keyring directory. Fingerprints lists
+// the primary keys it holds.
+type Key struct {
+	Name         string     `json:"name"`
+	Path         string     `json:"path"`
+	Fingerprints []string   `json:"fingerprints"`
+	UserIDs      []string   `json:"userIds"`
+	Expires      *time.Time `json:"expires,omitempty"`
+	UsedBy       []string   `json:"usedBy"`
+}
+
+// ListKeys returns the keyrings in the apt keyring directory with the
+// repositories that reference them.
+func ListKeys() ([]Key, error) {
+	a, err := aptOnly()
+	if err != nil {
+		return nil, err
+	}
+	paths, _ := filepath.Glob(filepath.Join(keyringDir, "*"))
+	sort.Strings(paths)
+	repos, _ := ListRepos()
+
+	keys := []Key{}
+	for _, path := range paths {
+		ext := filepath.Ext(path)
+		if ext != ".gpg" && ext != ".asc" {
+			continue
+		}
+		key, err := a.inspectKey(path)
+		if err != nil {
+			continue
+		}
+		key.Name = strings.TrimSuffix(filepath.Base(path), ext)
+		key.Path = path
+		for _, repo := range repos {
+			if repo.SignedBy == path && !contains(key.UsedBy, repo.Name) {
+				key.UsedBy = append(key.UsedBy, repo.Name)
+			}
+		}
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+// ImportKey stores a signing key as <name>.asc (armored) or <name>.gpg
+// (binary) in the keyring directory, from data or else downloaded from an
+// https URL, and returns its fingerprints for the user to check.
+func ImportKey(name string, data []byte, keyURL string) (*Key, error) {
+	a, err := aptOnly()
+	if err != nil {
+		return nil, err
+	}
+	if !isValidRepoName(name) {
+		return nil, fmt.Errorf("invalid key name: %s", name)
+	}
+	if len(data) == 0 {
+		if data, err = fetchKey(keyURL); err != nil {
+			return nil, err
+		}
+	}
+
+	ext := ".gpg"
+	if strings.Contains(string(data), "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		ext = ".asc"
+	}
+	tmp, err := os.CreateTemp("", "orbit-key-*"+ext)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := a.inspectKey(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if len(key.Fingerprints) == 0 {
+		return nil, fmt.Errorf("no public key found")
+	}
+
+	dest := filepath.Join(keyringDir, name+ext)
+	if err := writeRootFile(a.run, string(data), dest, "0644"); err != nil {
+		return nil, err
+	}
+	key.Name, key.Path = name, dest
+	return key, nil
+}
+
+// DeleteKey removes a keyring unless a repository still uses it.
+func DeleteKey(name string) error {
+	a, err := aptOnly()
+	if err != nil {
+		return err
+	}
+	keys, err := ListKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.Name != name {
+			continue
+		}
+		if len(key.UsedBy) > 0 {
+			return fmt.Errorf("key is used by %s", strings.Join(key.UsedBy, ", "))
+		}
+		if _, err := a.run("rm", "-f", key.Path); err != nil {
+			return fmt.Errorf("failed to delete key: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("key not found: %s", name)
+}
+
+func fetchKey(keyURL string) ([]byte, error) {
+	if !strings.HasPrefix(keyURL, "https://") {
+		return nil, fmt.Errorf("key data or an https URL is required")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keyFetchWait)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keyURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key URL: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download key: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download key: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download key: %w", err)
+	}
+	if len(data) > maxKeySize {
+		return nil, fmt.Errorf("key is too large")
+	}
+	return data, nil
+}
+
+// inspectKey lists the keys in a keyring file without importing them
+// anywhere. gpg needs a home directory even for --show-keys, so it gets a
+// throwaway one.
+func (a *apt) inspectKey(path string) (*Key, error) {
+	home, err := os.MkdirTemp("", "orbit-gpg-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(home)
+
+	output, err := a.query("gpg", "--homedir", home, "--batch", "--with-colons", "--show-keys", path)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid OpenPGP key: %s", strings.TrimSpace(output))
+	}
+	return parseGPGColons(output), nil
+}
+
+// parseGPGColons reads `gpg --with-colons` output. A "fpr" record after a
+// "pub" record carries the primary key fingerprint; subkey fingerprints
+// follow "sub" records and are skipped.
+func parseGPGColons(output string) *Key {
+	key := &Key{Fingerprints: []string{}, UserIDs: []string{}, UsedBy: []string{}}
+	var last string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub":
+			if secs, err := strconv.ParseInt(fields[6], 10, 64); err == nil && secs > 0 {
+				expires := time.Unix(secs, 0).UTC()
+				if key.Expires == nil || expires.Before(*key.Expires) {
+					key.Expires = &expires
+				}
+			}
+		case "fpr":
+			if last == "pub" {
+				key.Fingerprints = append(key.Fingerprints, fields[9])
+			}
+		case "uid":
+			key.UserIDs = append(key.UserIDs, fields[9])
+		}
+		if fields[0] != "fpr" {
+			last = fields[0]
+		}
+	}
+	return key
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,89 +1,98 @@
 package packages
 
 import (
-	"fmt"
-	"strings"
+	"errors"
+	"os/exec"
+	"sync"
 
 	"orbit/internal/util"
 )
 
+// Package is an installed or available package. Source names the package
+// manager or provider it comes from; Channel is set for snaps and flatpaks.
 type Package struct {
 	Name        string `json:"name"`
 	Version     string `json:"version"`
 	Description string `json:"description"`
 	Installed   bool   `json:"installed"`
+	Source      string `json:"source"`
+	Channel     string `json:"channel,omitempty"`
 }
 
-func List() ([]Package, error) {
-	output, err := util.RunCommandNoSudo("dpkg-query", "-W", "-f=${Package}\t${Version}\t${binary:Summary}\n")
-	if err != nil {
-		return nil, err
-	}
-
-	var pkgs []Package
-	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "\t")
-		if len(parts) >= 3 {
-			pkgs = append(pkgs, Package{
-				Name:        parts[0],
-				Version:     parts[1],
-				Description: parts[2],
-				Installed:   true,
-			})
-		}
-	}
-	return pkgs, nil
+// Manager is a package manager backend (apt/dpkg or dnf/rpm).
+type Manager interface {
+	Name() string
+	List() ([]Package, error)
+	Search(query string) ([]Package, error)
+	Install(pkg string) error
+	Remove(pkg string, purge bool) error
+	Update() error
+	Info(pkg string) (*Details, error)
+	Owner(path string) ([]string, error)
+	Upgradable() ([]Upgradable, error)
+	SimulateUpgrade(pkgs []string, dist bool) (*Plan, error)
+	UpgradePackages(pkgs []string, dist bool) error
+	PreviewInstall(pkg string) (*Plan, error)
+	PreviewRemove(pkg string, purge bool) (*Plan, error)
+	History() ([]Transaction, error)
+	Holds() ([]string, error)
+	SetHold(pkg string, held bool) error
 }
 
-func Search(query string) ([]Package, error) {
-	if !isValidSearchQuery(query) {
-		return nil, fmt.Errorf("invalid search query: %s", query)
-	}
-	output, err := util.RunCommandNoSudo("apt-cache", "search", query)
-	if err != nil {
-		return nil, err
-	}
+// runFunc runs a command and returns its combined output. Backends take two:
+// one that runs through sudo for changes and one without for queries.
+type runFunc func(command string, args ...string) (string, error)
 
-	var results []Package
-	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, " - ", 2)
-		if len(parts) == 2 {
-			results = append(results, Package{
-				Name:        parts[0],
-				Description: parts[1],
-				Installed:   false,
-			})
+var (
+	backend     Manager
+	backendOnce sync.Once
+)
+
+// Detect selects the backend for this host. It is called at startup; later
+// calls return the backend already chosen.
+func Detect() Manager {
+	backendOnce.Do(func() {
+		switch {
+		case hasCommand("dpkg-query"):
+			backend = newApt(util.RunCommand, util.RunCommandNoSudo)
+		case hasCommand("dnf"):
+			backend = newDnf("dnf", util.RunCommand, util.RunCommandNoSudo)
+		case hasCommand("yum"):
+			backend = newDnf("yum", util.RunCommand, util.RunCommandNoSudo)
+		default:
+			// Keep the historical behaviour: commands fail with a clear error
+			backend = newApt(util.RunCommand, util.RunCommandNoSudo)
 		}
-	}
-	return results, nil
+	})
+	return backend
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
 }
 
 func Install(pkg string) error {
-	// Validate package name
-	if !isValidPackageName(pkg) {
-		return fmt.Errorf("invalid package name: %s", pkg)
-	}
-	_, err := util.RunCommand("apt-get", "install", "-y", pkg)
-	return err
+	return Detect().Install(pkg)
 }
 
 func Remove(pkg string, purge bool) error {
-	// Validate package name
-	if !isValidPackageName(pkg) {
-		return fmt.Errorf("invalid package name: %s", pkg)
-	}
-	action := "remove"
-	if purge {
-		action = "purge"
-	}
-	_, err := util.RunCommand("apt-get", action, "-y", pkg)
-	return err
+	return Detect().Remove(pkg, purge)
+}
+
+func Update() error {
+	return Detect().Update()
+}
+
+// Errors returned by GetPackageInfo for a name that is not a package name or
+// that neither the repositories nor the installed system know.
+var (
+	ErrInvalidPackage  = errors.New("invalid package name")
+	ErrPackageNotFound = errors.New("package not found")
+)
+
+func GetPackageInfo(pkg string) (*Details, error) {
+	return Detect().Info(pkg)
 }
 
 func isValidSearchQuery(query string) bool {
@@ -112,24 +121,17 @@ func isValidPackageName(pkg string) bool {
 	return true
 }
 
-func Update() error {
-	_, err := util.RunCommand("apt-get", "update")
-	return err
-}
-
-func Upgrade() error {
-	_, err := util.RunCommand("apt-get", "upgrade", "-y")
-	return err
-}
-
-func GetPackageInfo(pkg string) (string, error) {
-	if !isValidPackageName(pkg) {
-		return "", fmt.Errorf("invalid package name: %s", pkg)
+// isValidRPMName checks RPM package names, which unlike Debian ones may
+// contain uppercase letters and underscores (e.g. NetworkManager).
+func isValidRPMName(pkg string) bool {
+	if pkg == "" || pkg[0] == '-' {
+		return false
 	}
-	output, err := util.RunCommandNoSudo("apt-cache", "show", pkg)
-	if err != nil {
-		return "", fmt.Errorf("package not found")
+	for _, c := range pkg {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '+' || c == '-' || c == '.' || c == '_') {
+			return false
+		}
 	}
-	return output, nil
+	return true
 }
-
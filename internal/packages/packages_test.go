@@ -1,6 +1,17 @@
 package packages
 
-import "testing"
+import (
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"orbit/internal/audit"
+)
 
 func TestIsValidPackageName(t *testing.T) {
 	valid := []string{"nginx", "openssh-server", "foo.bar", "libssl3"}
@@ -25,3 +36,394 @@ func TestIsValidSearchQuery(t *testing.T) {
 		t.Fatal("expected invalid search query")
 	}
 }
+
+// recorded returns a runFunc that replays testdata files keyed by the
+// command line, and records every command it was asked to run.
+func recorded(t *testing.T, outputs map[string]string, calls *[]string) runFunc {
+	return func(command string, args ...string) (string, error) {
+		cmdline := strings.Join(append([]string{command}, args...), " ")
+		*calls = append(*calls, cmdline)
+		file, ok := outputs[cmdline]
+		if !ok {
+			return "", nil
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data), nil
+	}
+}
+
+func TestAptBackend(t *testing.T) {
+	var calls []string
+	query := recorded(t, map[string]string{
+		"dpkg-query -W -f=${Package}\t${Version}\t${binary:Summary}\n": "dpkg-query.txt",
+		"apt-cache search nginx": "apt-cache-search.txt",
+	}, &calls)
+	a := newApt(recorded(t, nil, &calls), query)
+
+	pkgs, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 3 || pkgs[2].Name != "openssh-server" || pkgs[2].Version != "1:8.9p1-3ubuntu0.10" || !pkgs[2].Installed {
+		t.Fatalf("unexpected list: %+v", pkgs)
+	}
+
+	results, err := a.Search("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[1].Description != "small, powerful, scalable web/proxy server - common files" {
+		t.Fatalf("unexpected search results: %+v", results)
+	}
+
+	calls = nil
+	if err := a.Remove("nginx", true); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != "apt-get purge -y nginx" {
+		t.Fatalf("unexpected commands: %v", calls)
+	}
+}
+
+func TestDnfBackend(t *testing.T) {
+	var calls []string
+	query := recorded(t, map[string]string{
+		"rpm -qa --queryformat %{NAME}\t%{VERSION}-%{RELEASE}\t%{SUMMARY}\n": "rpm-qa.txt",
+		"dnf search -q nginx":  "dnf4-search.txt",
+		"dnf5 search -q nginx": "dnf5-search.txt",
+	}, &calls)
+	d := newDnf("dnf", recorded(t, nil, &calls), query)
+
+	pkgs, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || pkgs[1].Name != "NetworkManager" || pkgs[1].Version != "1.46.0-19.el9_5" {
+		t.Fatalf("unexpected list: %+v", pkgs)
+	}
+
+	results, err := d.Search("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Name != "nginx" || results[1].Name != "nginx-all-modules" || results[2].Name != "nginx-mod-stream" {
+		t.Fatalf("unexpected dnf4 search results: %+v", results)
+	}
+
+	results, err = newDnf("dnf5", nil, query).Search("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[1].Name != "nginx-mod-stream" || results[1].Description != "Nginx stream modules" {
+		t.Fatalf("unexpected dnf5 search results: %+v", results)
+	}
+
+	calls = nil
+	if err := d.Install("NetworkManager-wifi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Remove("nginx", true); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, "; ") != "dnf install -y NetworkManager-wifi; dnf remove -y nginx" {
+		t.Fatalf("unexpected commands: %v", calls)
+	}
+	if err := d.Install("-y"); err == nil {
+		t.Fatal("expected option-like package name to be rejected")
+	}
+}
+
+func TestAptUpgrades(t *testing.T) {
+	var calls []string
+	query := recorded(t, map[string]string{
+		"apt list --upgradable":   "apt-list-upgradable.txt",
+		"apt-get -s dist-upgrade": "apt-get-s-dist-upgrade.txt",
+	}, &calls)
+	a := newApt(recorded(t, nil, &calls), query)
+
+	upgrades, err := a.Upgradable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(upgrades) != 2 {
+		t.Fatalf("unexpected upgrades: %+v", upgrades)
+	}
+	if u := upgrades[0]; u.Name != "nginx" || u.CurrentVersion != "1.18.0-6ubuntu14.4" || u.CandidateVersion != "1.18.0-6ubuntu14.5" || !u.Security {
+		t.Fatalf("unexpected nginx upgrade: %+v", u)
+	}
+	if upgrades[1].Security {
+		t.Fatal("expected tzdata not to be a security update")
+	}
+
+	plan, err := a.SimulateUpgrade(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Install) != 1 || len(plan.Upgrade) != 1 || len(plan.Remove) != 1 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.Upgrade[0].OldVersion != "1.18.0-6ubuntu14.4" || plan.Upgrade[0].NewVersion != "1.18.0-6ubuntu14.5" {
+		t.Fatalf("unexpected upgrade item: %+v", plan.Upgrade[0])
+	}
+	if plan.Remove[0].Name != "linux-image-5.15.0-88-generic" || plan.Remove[0].OldVersion != "5.15.0-88.98" {
+		t.Fatalf("unexpected remove item: %+v", plan.Remove[0])
+	}
+
+	calls = nil
+	if err := a.UpgradePackages([]string{"nginx", "tzdata"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if calls[0] != "apt-get -y install --only-upgrade nginx tzdata" {
+		t.Fatalf("unexpected command: %v", calls)
+	}
+}
+
+func TestParseDnfTransaction(t *testing.T) {
+	data, err := os.ReadFile("testdata/dnf-upgrade-assumeno.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := parseDnfTransaction(string(data), map[string]string{"openssl": "1:3.0.7-24.el9"})
+	if len(plan.Upgrade) != 1 || plan.Upgrade[0].OldVersion != "1:3.0.7-24.el9" || plan.Upgrade[0].NewVersion != "1:3.0.7-25.el9_3" {
+		t.Fatalf("unexpected upgrades: %+v", plan.Upgrade)
+	}
+	if len(plan.Install) != 1 || plan.Install[0].Name != "openssl-fips-provider" {
+		t.Fatalf("unexpected installs: %+v", plan.Install)
+	}
+	if len(plan.Remove) != 1 || plan.Remove[0].OldVersion != "0.4.11-7.el9" {
+		t.Fatalf("unexpected removals: %+v", plan.Remove)
+	}
+
+	parseDnfSizes(string(data), plan)
+	if plan.DownloadSize != 1258291 || plan.DiskDelta != 3*(1<<20)-52*(1<<10) {
+		t.Fatalf("unexpected sizes: download %d, delta %d", plan.DownloadSize, plan.DiskDelta)
+	}
+
+	dnf5 := newPlan()
+	parseDnfSizes("Total size of inbound packages is 5 MiB. Need to download 5 MiB.\nAfter this operation, 2 MiB will be freed (install 1 MiB, remove 3 MiB).\n", dnf5)
+	if dnf5.DownloadSize != 5<<20 || dnf5.DiskDelta != -2<<20 {
+		t.Fatalf("unexpected dnf5 sizes: download %d, delta %d", dnf5.DownloadSize, dnf5.DiskDelta)
+	}
+}
+
+func TestAptPreview(t *testing.T) {
+	var calls []string
+	query := recorded(t, map[string]string{
+		"apt-get -s install jq": "apt-get-s-install.txt",
+		"apt-cache show --no-all-versions libonig5=6.9.7.1-2build1 libjq1=1.6-2.1ubuntu3 jq=1.6-2.1ubuntu3": "apt-cache-show-jq.txt",
+		"apt-get -s purge nginx": "apt-get-s-purge.txt",
+		"dpkg-query -W -f=${Package}\t${Installed-Size}\n nginx nginx-core libnginx-mod-http-geoip2 nginx-common": "dpkg-query-size-nginx.txt",
+	}, &calls)
+	a := newApt(recorded(t, nil, &calls), query)
+
+	plan, err := a.PreviewInstall("jq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Install) != 3 || plan.Install[2].Name != "jq" {
+		t.Fatalf("unexpected install plan: %+v", plan)
+	}
+	if plan.DownloadSize != 172364+133134+52542 || plan.DiskDelta != (630+386+102)*1024 {
+		t.Fatalf("unexpected sizes: download %d, delta %d", plan.DownloadSize, plan.DiskDelta)
+	}
+	if plan.Token == "" {
+		t.Fatal("expected plan token")
+	}
+
+	removal, err := a.PreviewRemove("nginx", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removal.Remove) != 4 || removal.Remove[3].Name != "nginx-common" {
+		t.Fatalf("unexpected removal plan: %+v", removal)
+	}
+	if removal.DownloadSize != 0 || removal.DiskDelta != -(1345+1420+60+394)*1024 {
+		t.Fatalf("unexpected sizes: download %d, delta %d", removal.DownloadSize, removal.DiskDelta)
+	}
+	if removal.Token == plan.Token {
+		t.Fatal("expected different plans to have different tokens")
+	}
+
+	again, _ := a.PreviewRemove("nginx", true)
+	if again.Token != removal.Token {
+		t.Fatal("expected identical plans to have the same token")
+	}
+	if plain, _ := a.PreviewRemove("nginx", false); plain.Token == removal.Token {
+		t.Fatal("expected a remove and a purge plan to have different tokens")
+	}
+}
+
+func TestAptInfo(t *testing.T) {
+	defaultDocDir := docDir
+	t.Cleanup(func() { docDir = defaultDocDir })
+	docDir = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(docDir, "nginx"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(docDir, "nginx", "changelog.Debian.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte("nginx (1.18.0-6ubuntu14.4) jammy-security; urgency=medium\n\n  * SECURITY UPDATE: fix\n\n -- Marc <marc@ubuntu.com>  Mon, 09 Oct 2023 10:00:00 -0400\n\nnginx (1.18.0-6ubuntu14.3) jammy; urgency=medium\n"))
+	gz.Close()
+	f.Close()
+
+	var calls []string
+	query := recorded(t, map[string]string{
+		"apt-cache show --no-all-versions nginx":                          "apt-cache-show-nginx.txt",
+		"apt-cache policy nginx":                                          "apt-cache-policy-nginx.txt",
+		"apt-cache rdepends --installed nginx":                            "apt-cache-rdepends-nginx.txt",
+		"dpkg-query -W -f=${Status}\t${Version}\t${Installed-Size} nginx": "dpkg-query-status-nginx.txt",
+		"dpkg -L nginx":   "dpkg-L-nginx.txt",
+		"dpkg -S /bin/sh": "dpkg-S.txt",
+	}, &calls)
+	a := newApt(nil, query)
+
+	d, err := a.Info("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Version != "1.18.0-6ubuntu14.4" || d.Candidate != "1.18.0-6ubuntu14.5" || d.InstalledSize != 50*1024 {
+		t.Fatalf("unexpected versions: %+v", d)
+	}
+	if d.Repository != "http://archive.ubuntu.com/ubuntu jammy-updates/main" {
+		t.Fatalf("unexpected repository: %q", d.Repository)
+	}
+	if d.Description != "small, powerful, scalable web/proxy server" || d.Homepage != "https://nginx.net" || len(d.Depends) != 2 {
+		t.Fatalf("unexpected fields: %+v", d)
+	}
+	if strings.Join(d.ReverseDepends, ",") != "nginx-extras,nginx-light,certbot-nginx" {
+		t.Fatalf("unexpected reverse dependencies: %v", d.ReverseDepends)
+	}
+	if len(d.Files) != 6 || d.Files[0] != "/usr" {
+		t.Fatalf("unexpected files: %v", d.Files)
+	}
+	if !strings.HasPrefix(d.Changelog, "nginx (1.18.0-6ubuntu14.4)") || strings.Contains(d.Changelog, "14.3") {
+		t.Fatalf("unexpected changelog: %q", d.Changelog)
+	}
+
+	owners, err := a.Owner("/bin/sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(owners, ",") != "dash,bash" {
+		t.Fatalf("unexpected owners: %v", owners)
+	}
+}
+
+func TestDnfInfo(t *testing.T) {
+	var calls []string
+	query := recorded(t, map[string]string{
+		"dnf info -q openssl":        "dnf-info-openssl.txt",
+		"rpm -q --changelog openssl": "rpm-changelog-openssl.txt",
+	}, &calls)
+	d, err := newDnf("dnf", nil, query).Info("openssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Version != "1:3.0.7-24.el9" || d.Candidate != "1:3.0.7-25.el9_3" || d.Repository != "baseos" {
+		t.Fatalf("unexpected versions: %+v", d)
+	}
+	if !strings.HasSuffix(d.Changelog, "Resolves: RHEL-16538") {
+		t.Fatalf("unexpected changelog: %q", d.Changelog)
+	}
+
+	if _, err := newDnf("dnf", nil, query).Info("Bad;name"); !errors.Is(err, ErrInvalidPackage) {
+		t.Fatalf("expected ErrInvalidPackage, got %v", err)
+	}
+	if _, err := newDnf("dnf", nil, query).Info("nosuch"); !errors.Is(err, ErrPackageNotFound) {
+		t.Fatalf("expected ErrPackageNotFound, got %v", err)
+	}
+
+	if isValidOwnerPath("/usr/bin/*") || isValidOwnerPath("bin/sh") || !isValidOwnerPath("/usr/sbin/nginx") {
+		t.Fatal("unexpected owner path validation")
+	}
+}
+
+func TestAptHistory(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"history.log", "history.log.1", "dpkg.log"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "logs", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "history.log.1" {
+			// Rotations past the first are compressed
+			f, err := os.Create(filepath.Join(dir, "history.log.2.gz"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gz := gzip.NewWriter(f)
+			gz.Write(data)
+			gz.Close()
+			f.Close()
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defaultApt, defaultDpkg := aptLogDir, dpkgLogDir
+	t.Cleanup(func() { aptLogDir, dpkgLogDir = defaultApt, defaultDpkg })
+	aptLogDir, dpkgLogDir = dir, dir
+
+	txs, err := newApt(nil, nil).History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three apt transactions and the direct dpkg install outside them
+	if len(txs) != 4 {
+		t.Fatalf("unexpected transactions: %+v", txs)
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Start.Before(txs[j].Start) })
+
+	if txs[0].CommandLine != "apt-get purge -y telnet" || txs[0].RequestedBy != "bob (1001)" || txs[0].Removed[0].OldVersion != "0.17-44build1" {
+		t.Fatalf("unexpected rotated transaction: %+v", txs[0])
+	}
+	if txs[1].Source != "dpkg" || len(txs[1].Installed) != 1 || txs[1].Installed[0].Name != "orbitctl" {
+		t.Fatalf("unexpected dpkg transaction: %+v", txs[1])
+	}
+	if len(txs[2].Installed) != 3 || txs[2].Installed[1].Name != "libjq1" || txs[2].Installed[1].NewVersion != "1.6-2.1ubuntu3" {
+		t.Fatalf("unexpected install transaction: %+v", txs[2])
+	}
+	up := txs[3]
+	if len(up.Upgraded) != 2 || up.Upgraded[0].OldVersion != "1.18.0-6ubuntu14.4" || up.Upgraded[0].NewVersion != "1.18.0-6ubuntu14.5" || len(up.Removed) != 1 {
+		t.Fatalf("unexpected upgrade transaction: %+v", up)
+	}
+	if up.End.Sub(up.Start) != 39*time.Second {
+		t.Fatalf("unexpected duration: %v", up.End.Sub(up.Start))
+	}
+
+	end := txs[2].End.UTC()
+	correlate(txs, []audit.Entry{
+		{Time: end.Add(-time.Hour).Format(time.RFC3339), User: "admin", Method: "POST", Path: "/api/packages/install", Status: 200},
+		{Time: end.Format(time.RFC3339), User: "admin", Method: "POST", Path: "/api/packages/install/preview", Status: 200},
+		{Time: end.Add(2 * time.Second).Format(time.RFC3339), User: "admin", Method: "POST", Path: "/api/packages/install", Status: 200},
+	})
+	if txs[2].Orbit == nil || txs[2].Orbit.Path != "/api/packages/install" || txs[2].Orbit.Time != end.Add(2*time.Second).Format(time.RFC3339) {
+		t.Fatalf("unexpected correlation: %+v", txs[2].Orbit)
+	}
+	if txs[3].Orbit != nil || txs[1].Orbit != nil {
+		t.Fatal("expected transactions outside Orbit to stay uncorrelated")
+	}
+
+	// Settings changes start no transaction, and one request explains one
+	// transaction only
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	txs = []Transaction{
+		{Start: base, End: base.Add(10 * time.Second)},
+		{Start: base.Add(20 * time.Second), End: base.Add(30 * time.Second)},
+		{Start: base.Add(time.Hour), End: base.Add(time.Hour + 5*time.Second)},
+	}
+	correlate(txs, []audit.Entry{
+		{Time: base.Add(31 * time.Second).Format(time.RFC3339), Method: "POST", Path: "/api/packages/providers/snap/install", Status: 200},
+		{Time: base.Add(time.Hour + 6*time.Second).Format(time.RFC3339), Method: "POST", Path: "/api/packages/repos", Status: 200},
+	})
+	if txs[1].Orbit == nil || txs[0].Orbit != nil || txs[2].Orbit != nil {
+		t.Fatalf("unexpected correlation: %+v %+v %+v", txs[0].Orbit, txs[1].Orbit, txs[2].Orbit)
+	}
+}
@@ -0,0 +1,190 @@
+package packages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrPlanChanged is returned when a transaction no longer matches the plan
+// the client confirmed.
+var ErrPlanChanged = errors.New("package plan changed since the preview; review it again")
+
+// PreviewInstall shows what installing pkg would change without changing it.
+func PreviewInstall(pkg string) (*Plan, error) {
+	return Detect().PreviewInstall(pkg)
+}
+
+// PreviewRemove shows what removing pkg would change, including packages
+// removed with it because they depend on it.
+func PreviewRemove(pkg string, purge bool) (*Plan, error) {
+	return Detect().PreviewRemove(pkg, purge)
+}
+
+// ConfirmInstall installs pkg only if the transaction still matches the
+// previewed plan identified by token.
+func ConfirmInstall(pkg, token string) error {
+	plan, err := PreviewInstall(pkg)
+	if err != nil {
+		return err
+	}
+	if plan.Token != token {
+		return ErrPlanChanged
+	}
+	return Install(pkg)
+}
+
+// ConfirmRemove removes pkg only if the transaction still matches the
+// previewed plan identified by token.
+func ConfirmRemove(pkg string, purge bool, token string) error {
+	plan, err := PreviewRemove(pkg, purge)
+	if err != nil {
+		return err
+	}
+	if plan.Token != token {
+		return ErrPlanChanged
+	}
+	return Remove(pkg, purge)
+}
+
+// ConfirmUpgrade upgrades pkgs, or everything when empty, only if the
+// transaction still matches the simulated plan identified by token.
+func ConfirmUpgrade(pkgs []string, dist bool, token string) error {
+	plan, err := SimulateUpgrade(pkgs, dist)
+	if err != nil {
+		return err
+	}
+	if plan.Token != token {
+		return ErrPlanChanged
+	}
+	return UpgradePackages(pkgs, dist)
+}
+
+// seal sets the plan token, a digest of the operation and the packages and
+// versions involved. Any change in what the transaction would do yields a
+// different token, and so does purging instead of removing the same
+// packages.
+func (p *Plan) seal(op string, purge bool) *Plan {
+	data, _ := json.Marshal(struct {
+		Op    string       `json:"op"`
+		Purge bool         `json:"purge"`
+		Items [][]PlanItem `json:"items"`
+	}{op, purge, [][]PlanItem{p.Install, p.Upgrade, p.Remove}})
+	sum := sha256.Sum256(data)
+	p.Token = hex.EncodeToString(sum[:])
+	return p
+}
+
+// aptSizes fills in the download size and disk delta of an apt plan from the
+// candidate records in the apt cache and the installed sizes known to dpkg.
+// Installed-Size is in KiB, Size in bytes.
+func (a *apt) aptSizes(plan *Plan) {
+	var candidates, installed []string
+	for _, item := range plan.Install {
+		candidates = append(candidates, item.Name+"="+item.NewVersion)
+	}
+	for _, item := range plan.Upgrade {
+		candidates = append(candidates, item.Name+"="+item.NewVersion)
+		installed = append(installed, item.Name)
+	}
+	for _, item := range plan.Remove {
+		installed = append(installed, item.Name)
+	}
+
+	if len(candidates) > 0 {
+		output, _ := a.query("apt-cache", append([]string{"show", "--no-all-versions"}, candidates...)...)
+		for _, stanza := range strings.Split(output, "\n\n") {
+			fields := parseControl(stanza)
+			size, _ := strconv.ParseInt(fields["Size"], 10, 64)
+			kib, _ := strconv.ParseInt(fields["Installed-Size"], 10, 64)
+			plan.DownloadSize += size
+			plan.DiskDelta += kib * 1024
+		}
+	}
+	if len(installed) > 0 {
+		output, _ := a.query("dpkg-query", append([]string{"-W", "-f=${Package}\t${Installed-Size}\n"}, installed...)...)
+		for _, line := range strings.Split(output, "\n") {
+			parts := strings.Split(line, "\t")
+			if len(parts) != 2 {
+				continue
+			}
+			kib, _ := strconv.ParseInt(parts[1], 10, 64)
+			plan.DiskDelta -= kib * 1024
+		}
+	}
+}
+
+// parseControl reads the "Field: value" lines of a Debian control stanza.
+// Continuation lines are appended to the previous field.
+func parseControl(stanza string) map[string]string {
+	fields := make(map[string]string)
+	var last string
+	for _, line := range strings.Split(stanza, "\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			fields[last] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			last = key
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// parseDnfSizes reads the size summary printed before dnf asks to proceed.
+// dnf 4 prints "Total download size: 1.2 M", "Installed size: 3.4 M" and
+// "Freed space: 52 k"; dnf 5 prints "Need to download 1 MiB." and
+// "After this operation, 2 MiB extra will be used (...)" or "... will be freed".
+func parseDnfSizes(output string, plan *Plan) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Total download size:"):
+			plan.DownloadSize = parseDnfSize(strings.TrimPrefix(line, "Total download size:"))
+		case strings.HasPrefix(line, "Installed size:"):
+			plan.DiskDelta += parseDnfSize(strings.TrimPrefix(line, "Installed size:"))
+		case strings.HasPrefix(line, "Freed space:"):
+			plan.DiskDelta -= parseDnfSize(strings.TrimPrefix(line, "Freed space:"))
+		case strings.Contains(line, "Need to download "):
+			rest := line[strings.Index(line, "Need to download ")+len("Need to download "):]
+			plan.DownloadSize = parseDnfSize(strings.TrimSuffix(rest, "."))
+		case strings.HasPrefix(line, "After this operation, "):
+			rest := strings.TrimPrefix(line, "After this operation, ")
+			if i := strings.Index(rest, " extra will be used"); i > 0 {
+				plan.DiskDelta = parseDnfSize(rest[:i])
+			} else if i := strings.Index(rest, " will be freed"); i > 0 {
+				plan.DiskDelta = -parseDnfSize(rest[:i])
+			}
+		}
+	}
+}
+
+// parseDnfSize converts sizes such as "1.2 M", "52 k" or "3 MiB" to bytes.
+func parseDnfSize(s string) int64 {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	if len(fields) > 1 {
+		switch strings.TrimSuffix(strings.ToLower(fields[1]), "ib") {
+		case "k":
+			value *= 1 << 10
+		case "m":
+			value *= 1 << 20
+		case "g":
+			value *= 1 << 30
+		}
+	}
+	return int64(value)
+}
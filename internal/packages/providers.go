@@ -0,0 +1,109 @@
+package packages
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"orbit/internal/util"
+)
+
+// Provider is an optional package source that works alongside the system
+// package manager, such as snap or flatpak. Channel is a snap channel
+// ("latest/stable") or a flatpak branch ("stable").
+type Provider interface {
+	Name() string
+	List() ([]Package, error)
+	Search(query string) ([]Package, error)
+	Install(pkg, channel string, classic bool) error
+	Remove(pkg string) error
+	Refresh(pkg string) error
+	SwitchChannel(pkg, channel string) error
+}
+
+var (
+	providers     []Provider
+	providersOnce sync.Once
+)
+
+// Providers returns the optional providers installed on this host.
+func Providers() []Provider {
+	providersOnce.Do(func() {
+		if hasCommand("snap") {
+			providers = append(providers, newSnap(util.RunCommand, util.RunCommandNoSudo))
+		}
+		if hasCommand("flatpak") {
+			providers = append(providers, newFlatpak(util.RunCommand, util.RunCommandNoSudo))
+		}
+	})
+	return providers
+}
+
+// GetProvider returns the provider with the given name.
+func GetProvider(name string) (Provider, error) {
+	for _, p := range Providers() {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("package source not available: %s", name)
+}
+
+// List returns installed packages from the system package manager and the
+// optional providers, each tagged with its source. source limits the list
+// to one of them.
+func List(source string) ([]Package, error) {
+	return collect(source, Manager.List, Provider.List)
+}
+
+// Search looks query up in the system package manager and the providers.
+func Search(query, source string) ([]Package, error) {
+	return collect(source,
+		func(m Manager) ([]Package, error) { return m.Search(query) },
+		func(p Provider) ([]Package, error) { return p.Search(query) })
+}
+
+// collect gathers packages from the backend and every provider matching
+// source. Errors from the backend, or from the one source asked for, are
+// returned; otherwise a failing provider is logged so the rest still loads.
+func collect(source string, fromBackend func(Manager) ([]Package, error), fromProvider func(Provider) ([]Package, error)) ([]Package, error) {
+	backend := Detect()
+	if source == backend.Name() {
+		return fromBackend(backend)
+	}
+	if source != "" {
+		p, err := GetProvider(source)
+		if err != nil {
+			return nil, err
+		}
+		return fromProvider(p)
+	}
+
+	pkgs, err := fromBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range Providers() {
+		found, err := fromProvider(p)
+		if err != nil {
+			log.Printf("%s: %v", p.Name(), err)
+			continue
+		}
+		pkgs = append(pkgs, found...)
+	}
+	return pkgs, nil
+}
+
+// isValidChannel accepts snap channels (track/risk/branch) and flatpak
+// branches.
+func isValidChannel(channel string) bool {
+	if channel == "" || len(channel) > 64 || channel[0] == '-' {
+		return false
+	}
+	for _, c := range channel {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '/' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
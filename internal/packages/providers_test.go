@@ -0,0 +1,75 @@
+package packages
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnapProvider(t *testing.T) {
+	var calls []string
+	query := recorded(t, map[string]string{
+		"snap list":     "snap-list.txt",
+		"snap find lxd": "snap-find.txt",
+	}, &calls)
+	s := newSnap(recorded(t, nil, &calls), query)
+
+	pkgs, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 3 || pkgs[2].Name != "lxd" || pkgs[2].Channel != "5.0/stable" || pkgs[2].Source != "snap" {
+		t.Fatalf("unexpected snaps: %+v", pkgs)
+	}
+
+	results, err := s.Search("lxd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Description != "LXD - container and VM manager" {
+		t.Fatalf("unexpected search results: %+v", results)
+	}
+
+	calls = nil
+	if err := s.Install("certbot", "latest/stable", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SwitchChannel("lxd", "5.21/stable"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, "; ") != "snap install certbot --channel=latest/stable --classic; snap refresh lxd --channel=5.21/stable" {
+		t.Fatalf("unexpected commands: %v", calls)
+	}
+	if s.Install("Certbot", "", false) == nil || s.SwitchChannel("lxd", "--classic") == nil {
+		t.Fatal("expected invalid names and channels to be rejected")
+	}
+}
+
+func TestFlatpakProvider(t *testing.T) {
+	var calls []string
+	query := recorded(t, map[string]string{
+		"flatpak list --system --app --columns=application,version,branch,name": "flatpak-list.txt",
+	}, &calls)
+	f := newFlatpak(recorded(t, nil, &calls), query)
+
+	pkgs, err := f.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 3 || pkgs[1].Name != "org.gimp.GIMP" || pkgs[1].Channel != "beta" || pkgs[1].Source != "flatpak" {
+		t.Fatalf("unexpected apps: %+v", pkgs)
+	}
+
+	calls = nil
+	if err := f.SwitchChannel("org.gimp.GIMP", "stable"); err != nil {
+		t.Fatal(err)
+	}
+	want := "flatpak list --system --app --columns=application,version,branch,name; " +
+		"flatpak install -y --noninteractive --system flathub org.gimp.GIMP//stable; " +
+		"flatpak uninstall -y --noninteractive --system org.gimp.GIMP//beta"
+	if strings.Join(calls, "; ") != want {
+		t.Fatalf("unexpected commands: %v", calls)
+	}
+	if f.Remove("firefox") == nil {
+		t.Fatal("expected a bare name to be rejected as an application ID")
+	}
+}
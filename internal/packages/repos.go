@@ -0,0 +1,493 @@
+package packages
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"orbit/internal/jobs"
+)
+
+// sourcesDir and keyringDir are where apt repositories and the keys that
+// sign them live.
+var (
+	sourcesDir = "/etc/apt/sources.list.d"
+	keyringDir = "/etc/apt/keyrings"
+)
+
+// Repo is one apt source entry. Name is the file it lives in without its
+// extension; Format is "list" for one-line entries or "sources" for deb822
+// stanzas. A file may hold several entries, which share its name.
+type Repo struct {
+	Name          string   `json:"name"`
+	Format        string   `json:"format"`
+	Enabled       bool     `json:"enabled"`
+	Types         []string `json:"types"`
+	URIs          []string `json:"uris"`
+	Suites        []string `json:"suites"`
+	Components    []string `json:"components"`
+	Architectures []string `json:"architectures"`
+	SignedBy      string   `json:"signedBy"`
+}
+
+// aptOnly returns the apt backend, or an error on hosts using another
+// package manager.
+func aptOnly() (*apt, error) {
+	a, ok := Detect().(*apt)
+	if !ok {
+		return nil, fmt.Errorf("repository management requires apt")
+	}
+	return a, nil
+}
+
+// ListRepos returns the entries of every file in sources.list.d.
+func ListRepos() ([]Repo, error) {
+	if _, err := aptOnly(); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(sourcesDir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	repos := []Repo{}
+	for _, path := range paths {
+		name, format := repoFile(filepath.Base(path))
+		if format == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if format == "list" {
+			repos = append(repos, parseSourcesList(name, string(data))...)
+		} else {
+			repos = append(repos, parseDeb822(name, string(data))...)
+		}
+	}
+	return repos, nil
+}
+
+// SaveRepo writes repo as the only entry of its file, replacing any file of
+// the same name, then refreshes the package lists in the background.
+func SaveRepo(repo Repo) (jobs.Job, error) {
+	a, err := aptOnly()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if repo.Format == "" {
+		repo.Format = "sources"
+	}
+	if err := validateRepo(repo); err != nil {
+		return jobs.Job{}, err
+	}
+
+	content := renderDeb822(repo)
+	if repo.Format == "list" {
+		content = renderSourcesList(repo)
+	}
+	if err := writeRootFile(a.run, content, repoPath(repo.Name, repo.Format), "0644"); err != nil {
+		return jobs.Job{}, err
+	}
+	// Drop the file in the other format so the name stays unique; only now,
+	// so a failed write leaves the existing repository in place
+	other := repoPath(repo.Name, "list")
+	if repo.Format == "list" {
+		other = repoPath(repo.Name, "sources")
+	}
+	if _, err := os.Stat(other); err == nil {
+		if _, err := a.run("rm", "-f", other); err != nil {
+			return jobs.Job{}, fmt.Errorf("failed to replace %s: %w", other, err)
+		}
+	}
+	return a.startUpdate(), nil
+}
+
+// DeleteRepo removes a repository file, then refreshes the package lists.
+func DeleteRepo(name string) (jobs.Job, error) {
+	a, err := aptOnly()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	path, _, err := findRepoFile(name)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if _, err := a.run("rm", "-f", path); err != nil {
+		return jobs.Job{}, fmt.Errorf("failed to delete repository: %w", err)
+	}
+	return a.startUpdate(), nil
+}
+
+// SetRepoEnabled enables or disables every entry of a repository file, then
+// refreshes the package lists. One-line entries are commented out; deb822
+// stanzas get "Enabled: no".
+func SetRepoEnabled(name string, enabled bool) (jobs.Job, error) {
+	a, err := aptOnly()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	path, format, err := findRepoFile(name)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	var content string
+	if format == "list" {
+		content = toggleSourcesList(string(data), enabled)
+	} else {
+		content = toggleDeb822(string(data), enabled)
+	}
+	if err := writeRootFile(a.run, content, path, "0644"); err != nil {
+		return jobs.Job{}, err
+	}
+	return a.startUpdate(), nil
+}
+
+// startUpdate runs `apt-get update` as a background job.
+func (a *apt) startUpdate() jobs.Job {
+	return jobs.Start("apt-update", func() (interface{}, error) {
+		output, err := a.run("apt-get", "update")
+		if err != nil {
+			return output, fmt.Errorf("apt-get update failed")
+		}
+		return output, nil
+	})
+}
+
+// repoFile splits a sources.list.d file name into its name and format.
+// Files apt ignores, such as .list.save backups, have no format.
+func repoFile(base string) (name, format string) {
+	switch {
+	case strings.HasSuffix(base, ".list"):
+		return strings.TrimSuffix(base, ".list"), "list"
+	case strings.HasSuffix(base, ".sources"):
+		return strings.TrimSuffix(base, ".sources"), "sources"
+	}
+	return "", ""
+}
+
+func repoPath(name, format string) string {
+	return filepath.Join(sourcesDir, name+"."+format)
+}
+
+func findRepoFile(name string) (path, format string, err error) {
+	if !isValidRepoName(name) {
+		return "", "", fmt.Errorf("invalid repository name: %s", name)
+	}
+	for _, format := range []string{"sources", "list"} {
+		path := repoPath(name, format)
+		if _, err := os.Stat(path); err == nil {
+			return path, format, nil
+		}
+	}
+	return "", "", fmt.Errorf("repository not found: %s", name)
+}
+
+// isValidRepoName follows the characters apt accepts in sources.list.d
+// file names.
+func isValidRepoName(name string) bool {
+	if name == "" || len(name) > 64 || name[0] == '.' || name[0] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidRepoWord checks a suite, component, type or architecture, which
+// appear as whitespace-separated words in both formats.
+func isValidRepoWord(word string) bool {
+	if word == "" || len(word) > 128 {
+		return false
+	}
+	for _, c := range word {
+		if c <= ' ' || c == '#' || c == '[' || c == ']' || c == '=' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateRepo checks a repository before it is written. Orbit only writes
+// entries scoped to a keyring with signed-by, so a third-party key can never
+// vouch for other repositories.
+func validateRepo(repo Repo) error {
+	if !isValidRepoName(repo.Name) {
+		return fmt.Errorf("invalid repository name: %s", repo.Name)
+	}
+	if repo.Format != "list" && repo.Format != "sources" {
+		return fmt.Errorf("invalid format: %s", repo.Format)
+	}
+	if len(repo.Types) == 0 {
+		return fmt.Errorf("at least one type is required")
+	}
+	for _, t := range repo.Types {
+		if t != "deb" && t != "deb-src" {
+			return fmt.Errorf("invalid type: %s", t)
+		}
+	}
+	if len(repo.URIs) == 0 || len(repo.Suites) == 0 {
+		return fmt.Errorf("URIs and suites are required")
+	}
+	if repo.Format == "list" && len(repo.URIs) != 1 {
+		return fmt.Errorf("one-line entries take exactly one URI")
+	}
+	for _, uri := range repo.URIs {
+		u, err := url.Parse(uri)
+		if err != nil || !isValidRepoWord(uri) {
+			return fmt.Errorf("invalid URI: %s", uri)
+		}
+		switch u.Scheme {
+		case "http", "https", "file", "mirror+http", "mirror+https", "tor+http", "tor+https":
+		default:
+			return fmt.Errorf("unsupported URI scheme: %s", uri)
+		}
+	}
+	for _, words := range [][]string{repo.Suites, repo.Components, repo.Architectures} {
+		for _, w := range words {
+			if !isValidRepoWord(w) {
+				return fmt.Errorf("invalid value: %q", w)
+			}
+		}
+	}
+	// A suite ending in "/" is an exact path and takes no components
+	for _, suite := range repo.Suites {
+		if !strings.HasSuffix(suite, "/") && len(repo.Components) == 0 {
+			return fmt.Errorf("suite %s needs at least one component", suite)
+		}
+	}
+	return validateSignedBy(repo.SignedBy)
+}
+
+func validateSignedBy(path string) error {
+	if path == "" {
+		return fmt.Errorf("signed-by keyring is required")
+	}
+	if filepath.Clean(path) != path || !isValidRepoWord(path) {
+		return fmt.Errorf("invalid signed-by path: %s", path)
+	}
+	dir := filepath.Dir(path)
+	if dir != keyringDir && dir != "/usr/share/keyrings" {
+		return fmt.Errorf("signed-by keyring must be in %s or /usr/share/keyrings", keyringDir)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("keyring not found: %s", path)
+	}
+	return nil
+}
+
+// parseSourcesList reads one-line entries. Commented-out entries are
+// returned as disabled:
+//
+//	deb [arch=amd64 signed-by=/etc/apt/keyrings/pgdg.asc] https://apt.postgresql.org/pub/repos/apt jammy-pgdg main
+//	# deb-src http://archive.ubuntu.com/ubuntu jammy main
+func parseSourcesList(name, data string) []Repo {
+	repos := []Repo{}
+	for _, line := range strings.Split(data, "\n") {
+		repo, ok := parseSourcesLine(line)
+		if !ok {
+			continue
+		}
+		repo.Name = name
+		repos = append(repos, repo)
+	}
+	return repos
+}
+
+func parseSourcesLine(line string) (Repo, bool) {
+	repo := Repo{Format: "list", Enabled: true}
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		repo.Enabled = false
+		line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 3 || (fields[0] != "deb" && fields[0] != "deb-src") {
+		return repo, false
+	}
+	repo.Types = []string{fields[0]}
+	rest := fields[1:]
+
+	if strings.HasPrefix(rest[0], "[") {
+		var options []string
+		for len(rest) > 0 {
+			word := rest[0]
+			rest = rest[1:]
+			options = append(options, strings.Trim(word, "[]"))
+			if strings.HasSuffix(word, "]") {
+				break
+			}
+		}
+		for _, opt := range options {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "arch":
+				repo.Architectures = strings.Split(value, ",")
+			case "signed-by":
+				repo.SignedBy = value
+			}
+		}
+	}
+	if len(rest) < 2 {
+		return repo, false
+	}
+	repo.URIs = []string{rest[0]}
+	repo.Suites = []string{rest[1]}
+	repo.Components = rest[2:]
+	return repo, true
+}
+
+// parseDeb822 reads the blank-line separated stanzas of a .sources file:
+//
+//	Types: deb
+//	URIs: https://download.docker.com/linux/ubuntu
+//	Suites: jammy
+//	Components: stable
+//	Signed-By: /etc/apt/keyrings/docker.asc
+func parseDeb822(name, data string) []Repo {
+	repos := []Repo{}
+	for _, stanza := range strings.Split(data, "\n\n") {
+		var lines []string
+		for _, line := range strings.Split(stanza, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+				lines = append(lines, line)
+			}
+		}
+		fields := parseControl(strings.Join(lines, "\n"))
+		if fields["Types"] == "" || fields["URIs"] == "" {
+			continue
+		}
+		repo := Repo{
+			Name:          name,
+			Format:        "sources",
+			Enabled:       !strings.EqualFold(fields["Enabled"], "no"),
+			Types:         strings.Fields(fields["Types"]),
+			URIs:          strings.Fields(fields["URIs"]),
+			Suites:        strings.Fields(fields["Suites"]),
+			Components:    strings.Fields(fields["Components"]),
+			Architectures: strings.Fields(fields["Architectures"]),
+			SignedBy:      fields["Signed-By"],
+		}
+		// Signed-By may embed the key itself rather than name a keyring
+		if strings.Contains(repo.SignedBy, "BEGIN PGP") {
+			repo.SignedBy = "(inline key)"
+		}
+		repos = append(repos, repo)
+	}
+	return repos
+}
+
+// renderSourcesList writes one line per type and suite, since a one-line
+// entry takes exactly one of each.
+func renderSourcesList(repo Repo) string {
+	prefix := ""
+	if !repo.Enabled {
+		prefix = "# "
+	}
+	options := "signed-by=" + repo.SignedBy
+	if len(repo.Architectures) > 0 {
+		options = "arch=" + strings.Join(repo.Architectures, ",") + " " + options
+	}
+
+	var b strings.Builder
+	for _, t := range repo.Types {
+		for _, suite := range repo.Suites {
+			line := strings.Join(append([]string{t, "[" + options + "]", repo.URIs[0], suite}, repo.Components...), " ")
+			b.WriteString(prefix + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func renderDeb822(repo Repo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Types: %s\n", strings.Join(repo.Types, " "))
+	fmt.Fprintf(&b, "URIs: %s\n", strings.Join(repo.URIs, " "))
+	fmt.Fprintf(&b, "Suites: %s\n", strings.Join(repo.Suites, " "))
+	if len(repo.Components) > 0 {
+		fmt.Fprintf(&b, "Components: %s\n", strings.Join(repo.Components, " "))
+	}
+	if len(repo.Architectures) > 0 {
+		fmt.Fprintf(&b, "Architectures: %s\n", strings.Join(repo.Architectures, " "))
+	}
+	fmt.Fprintf(&b, "Signed-By: %s\n", repo.SignedBy)
+	if !repo.Enabled {
+		b.WriteString("Enabled: no\n")
+	}
+	return b.String()
+}
+
+// toggleSourcesList comments out or restores the entry lines of a .list
+// file, leaving other comments alone.
+func toggleSourcesList(data string, enabled bool) string {
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		repo, ok := parseSourcesLine(line)
+		if !ok || repo.Enabled == enabled {
+			continue
+		}
+		if enabled {
+			lines[i] = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		} else {
+			lines[i] = "# " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toggleDeb822 sets the Enabled field of every stanza.
+func toggleDeb822(data string, enabled bool) string {
+	value := "yes"
+	if !enabled {
+		value = "no"
+	}
+	stanzas := strings.Split(strings.TrimRight(data, "\n"), "\n\n")
+	for i, stanza := range stanzas {
+		lines := strings.Split(stanza, "\n")
+		found := false
+		for j, line := range lines {
+			if key, _, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "Enabled") {
+				lines[j] = "Enabled: " + value
+				found = true
+			}
+		}
+		if !found && strings.Contains(stanza, "Types:") {
+			lines = append(lines, "Enabled: "+value)
+		}
+		stanzas[i] = strings.Join(lines, "\n")
+	}
+	return strings.Join(stanzas, "\n\n") + "\n"
+}
+
+// writeRootFile writes content to a temporary file and installs it at dest
+// with the given mode, owned by root.
+func writeRootFile(run runFunc, content, dest, mode string) error {
+	tmp, err := os.CreateTemp("", "orbit-*")
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	tmp.Close()
+
+	if output, err := run("install", "-D", "-o", "root", "-g", "root", "-m", mode, tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to install %s: %s", dest, strings.TrimSpace(output))
+	}
+	return nil
+}
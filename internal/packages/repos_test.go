@@ -0,0 +1,124 @@
+package packages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSourcesList(t *testing.T) {
+	data := `# PostgreSQL
+deb [arch=amd64,arm64 signed-by=/etc/apt/keyrings/pgdg.asc] https://apt.postgresql.org/pub/repos/apt jammy-pgdg main
+# deb-src http://archive.ubuntu.com/ubuntu jammy main universe
+`
+	repos := parseSourcesList("pgdg", data)
+	if len(repos) != 2 {
+		t.Fatalf("unexpected repos: %+v", repos)
+	}
+	r := repos[0]
+	if !r.Enabled || r.SignedBy != "/etc/apt/keyrings/pgdg.asc" || strings.Join(r.Architectures, ",") != "amd64,arm64" ||
+		r.URIs[0] != "https://apt.postgresql.org/pub/repos/apt" || r.Suites[0] != "jammy-pgdg" || r.Components[0] != "main" {
+		t.Fatalf("unexpected entry: %+v", r)
+	}
+	if repos[1].Enabled || repos[1].Types[0] != "deb-src" || len(repos[1].Components) != 2 {
+		t.Fatalf("unexpected disabled entry: %+v", repos[1])
+	}
+
+	disabled := toggleSourcesList(data, false)
+	if !strings.Contains(disabled, "# deb [arch=amd64,arm64") || !strings.HasPrefix(disabled, "# PostgreSQL\n") {
+		t.Fatalf("unexpected disabled file:\n%s", disabled)
+	}
+	for _, repo := range parseSourcesList("pgdg", toggleSourcesList(disabled, true)) {
+		if !repo.Enabled {
+			t.Fatalf("expected all entries enabled: %+v", repo)
+		}
+	}
+}
+
+func TestDeb822(t *testing.T) {
+	repo := Repo{
+		Name:       "docker",
+		Format:     "sources",
+		Enabled:    true,
+		Types:      []string{"deb"},
+		URIs:       []string{"https://download.docker.com/linux/ubuntu"},
+		Suites:     []string{"jammy"},
+		Components: []string{"stable"},
+		SignedBy:   "/etc/apt/keyrings/docker.asc",
+	}
+	content := renderDeb822(repo)
+	parsed := parseDeb822("docker", content)
+	if len(parsed) != 1 || !parsed[0].Enabled || parsed[0].SignedBy != repo.SignedBy || parsed[0].Components[0] != "stable" {
+		t.Fatalf("unexpected round trip: %+v", parsed)
+	}
+
+	disabled := parseDeb822("docker", toggleDeb822(content, false))
+	if len(disabled) != 1 || disabled[0].Enabled {
+		t.Fatalf("expected disabled repo: %+v", disabled)
+	}
+	enabled := toggleDeb822(toggleDeb822(content, false), true)
+	if strings.Count(enabled, "Enabled:") != 1 || !parseDeb822("docker", enabled)[0].Enabled {
+		t.Fatalf("unexpected enabled file:\n%s", enabled)
+	}
+
+	repo.Format = "list"
+	repo.Types = []string{"deb", "deb-src"}
+	lines := renderSourcesList(repo)
+	if lines != "deb [signed-by=/etc/apt/keyrings/docker.asc] https://download.docker.com/linux/ubuntu jammy stable\n"+
+		"deb-src [signed-by=/etc/apt/keyrings/docker.asc] https://download.docker.com/linux/ubuntu jammy stable\n" {
+		t.Fatalf("unexpected one-line entries:\n%s", lines)
+	}
+}
+
+func TestValidateRepo(t *testing.T) {
+	defaultKeyringDir := keyringDir
+	t.Cleanup(func() { keyringDir = defaultKeyringDir })
+	keyringDir = t.TempDir()
+	key := filepath.Join(keyringDir, "docker.asc")
+	if err := os.WriteFile(key, []byte("key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	valid := Repo{Name: "docker", Format: "sources", Types: []string{"deb"}, URIs: []string{"https://download.docker.com/linux/ubuntu"},
+		Suites: []string{"jammy"}, Components: []string{"stable"}, SignedBy: key}
+	if err := validateRepo(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string]func(r *Repo){
+		"name":      func(r *Repo) { r.Name = "../evil" },
+		"type":      func(r *Repo) { r.Types = []string{"rpm"} },
+		"scheme":    func(r *Repo) { r.URIs = []string{"ftp://example.com/debian"} },
+		"newline":   func(r *Repo) { r.Suites = []string{"jammy\nTypes: deb"} },
+		"unsigned":  func(r *Repo) { r.SignedBy = "" },
+		"keyring":   func(r *Repo) { r.SignedBy = "/tmp/key.asc" },
+		"component": func(r *Repo) { r.Components = nil },
+	}
+	for name, mutate := range invalid {
+		r := valid
+		mutate(&r)
+		if err := validateRepo(r); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestParseGPGColons(t *testing.T) {
+	output := `pub:-:4096:1:7EA0A9C3F273FCD8:1487788586:1803321386::-:::scESC::::::23::0:
+fpr:::::::::9DC858229FC7DD38854AE2D88D81803C0EBFCD88:
+uid:-::::1487788586::B5D1B0D3A6A4D6C3::Docker Release (CE deb) <docker@docker.com>::::::::::0:
+sub:-:4096:1:8D81803C0EBFCD88:1487792064:::-:::s::::::23:
+fpr:::::::::D3306A018370199E527AE7997EA0A9C3F273FCD8:
+`
+	key := parseGPGColons(output)
+	if len(key.Fingerprints) != 1 || key.Fingerprints[0] != "9DC858229FC7DD38854AE2D88D81803C0EBFCD88" {
+		t.Fatalf("unexpected fingerprints: %v", key.Fingerprints)
+	}
+	if len(key.UserIDs) != 1 || key.UserIDs[0] != "Docker Release (CE deb) <docker@docker.com>" {
+		t.Fatalf("unexpected user IDs: %v", key.UserIDs)
+	}
+	if key.Expires == nil || key.Expires.Year() != 2027 {
+		t.Fatalf("unexpected expiry: %v", key.Expires)
+	}
+}
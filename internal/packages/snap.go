@@ -0,0 +1,152 @@
+package packages
+
+import (
+	"fmt"
+	"strings"
+)
+
+// snap manages snaps through snapd.
+type snap struct {
+	run   runFunc
+	query runFunc
+}
+
+func newSnap(run, query runFunc) *snap {
+	return &snap{run: run, query: query}
+}
+
+func (s *snap) Name() string {
+	return "snap"
+}
+
+// List parses `snap list`:
+//
+//	Name    Version   Rev    Tracking       Publisher   Notes
+//	core22  20240111  1122   latest/stable  canonical✓  base
+func (s *snap) List() ([]Package, error) {
+	output, err := s.query("snap", "list")
+	if err != nil {
+		// snapd prints this and exits 0 or 1 depending on version
+		if strings.Contains(output, "No snaps are installed") {
+			return []Package{}, nil
+		}
+		return nil, fmt.Errorf("snap list failed: %s", strings.TrimSpace(output))
+	}
+
+	pkgs := []Package{}
+	for i, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 4 {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name:      fields[0],
+			Version:   fields[1],
+			Installed: true,
+			Source:    "snap",
+			Channel:   fields[3],
+		})
+	}
+	return pkgs, nil
+}
+
+// Search parses `snap find`, whose last column is a free-text summary:
+//
+//	Name  Version  Publisher   Notes  Summary
+//	lxd   5.19     canonical✓  -      LXD - container and VM manager
+func (s *snap) Search(query string) ([]Package, error) {
+	if !isValidSearchQuery(query) {
+		return nil, fmt.Errorf("invalid search query: %s", query)
+	}
+	output, err := s.query("snap", "find", query)
+	if err != nil {
+		if strings.Contains(output, "No matching snaps") {
+			return []Package{}, nil
+		}
+		return nil, fmt.Errorf("snap find failed: %s", strings.TrimSpace(output))
+	}
+
+	results := []Package{}
+	for i, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 5 {
+			continue
+		}
+		results = append(results, Package{
+			Name:        fields[0],
+			Version:     fields[1],
+			Description: strings.Join(fields[4:], " "),
+			Source:      "snap",
+		})
+	}
+	return results, nil
+}
+
+// Install installs a snap, from channel when given. classic lifts the
+// sandbox, which snaps such as certbot require.
+func (s *snap) Install(pkg, channel string, classic bool) error {
+	if !isValidSnapName(pkg) {
+		return fmt.Errorf("invalid snap name: %s", pkg)
+	}
+	args := []string{"install", pkg}
+	if channel != "" {
+		if !isValidChannel(channel) {
+			return fmt.Errorf("invalid channel: %s", channel)
+		}
+		args = append(args, "--channel="+channel)
+	}
+	if classic {
+		args = append(args, "--classic")
+	}
+	return s.snap(args...)
+}
+
+func (s *snap) Remove(pkg string) error {
+	if !isValidSnapName(pkg) {
+		return fmt.Errorf("invalid snap name: %s", pkg)
+	}
+	return s.snap("remove", pkg)
+}
+
+// Refresh updates one snap, or all of them when pkg is empty.
+func (s *snap) Refresh(pkg string) error {
+	if pkg == "" {
+		return s.snap("refresh")
+	}
+	if !isValidSnapName(pkg) {
+		return fmt.Errorf("invalid snap name: %s", pkg)
+	}
+	return s.snap("refresh", pkg)
+}
+
+// SwitchChannel moves a snap to another channel and refreshes it from there.
+func (s *snap) SwitchChannel(pkg, channel string) error {
+	if !isValidSnapName(pkg) {
+		return fmt.Errorf("invalid snap name: %s", pkg)
+	}
+	if !isValidChannel(channel) {
+		return fmt.Errorf("invalid channel: %s", channel)
+	}
+	return s.snap("refresh", pkg, "--channel="+channel)
+}
+
+func (s *snap) snap(args ...string) error {
+	if output, err := s.run("snap", args...); err != nil {
+		return fmt.Errorf("snap %s failed: %s", args[0], strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// isValidSnapName follows the snap store rules: lowercase letters, digits
+// and single hyphens, not starting or ending with a hyphen.
+func isValidSnapName(name string) bool {
+	if name == "" || len(name) > 40 || name[0] == '-' || name[len(name)-1] == '-' || strings.Contains(name, "--") {
+		return false
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,386 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"orbit/internal/jobs"
+)
+
+// aptConfDir holds the unattended-upgrades configuration and
+// unattendedLogDir its logs.
+var (
+	aptConfDir       = "/etc/apt/apt.conf.d"
+	unattendedLogDir = "/var/log/unattended-upgrades"
+	unattendedStamp  = "/var/lib/apt/periodic/unattended-upgrades-stamp"
+)
+
+const (
+	autoUpgradesFile = "20auto-upgrades"
+	unattendedFile   = "50unattended-upgrades"
+	maxUnattendedRun = 20
+)
+
+// UnattendedConfig is the part of the unattended-upgrades configuration
+// Orbit manages. Enabled and UpdateLists come from 20auto-upgrades, the
+// rest from 50unattended-upgrades.
+type UnattendedConfig struct {
+	Enabled             bool     `json:"enabled"`
+	UpdateLists         bool     `json:"updateLists"`
+	AllowedOrigins      []string `json:"allowedOrigins"`
+	OriginsPattern      []string `json:"originsPattern"`
+	Blacklist           []string `json:"blacklist"`
+	AutomaticReboot     bool     `json:"automaticReboot"`
+	AutomaticRebootTime string   `json:"automaticRebootTime"`
+	Mail                string   `json:"mail"`
+	MailReport          string   `json:"mailReport"`
+}
+
+// UnattendedRun is one run of unattended-upgrade as recorded in its log.
+type UnattendedRun struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Upgraded    []string  `json:"upgraded"`
+	KeptBack    []string  `json:"keptBack"`
+	AutoRemoved []string  `json:"autoRemoved"`
+	Warnings    []string  `json:"warnings"`
+	Errors      []string  `json:"errors"`
+	Result      string    `json:"result"` // "upgraded", "nothing" or "error"
+}
+
+// UnattendedStatus combines the configuration with recent runs, newest first.
+type UnattendedStatus struct {
+	Installed bool              `json:"installed"`
+	Config    *UnattendedConfig `json:"config"`
+	LastRun   *time.Time        `json:"lastRun,omitempty"`
+	Runs      []UnattendedRun   `json:"runs"`
+}
+
+// GetUnattended reads the unattended-upgrades configuration and logs.
+func GetUnattended() (*UnattendedStatus, error) {
+	if _, err := aptOnly(); err != nil {
+		return nil, err
+	}
+	status := &UnattendedStatus{Config: &UnattendedConfig{}, Runs: []UnattendedRun{}}
+	auto, _ := os.ReadFile(filepath.Join(aptConfDir, autoUpgradesFile))
+	main, err := os.ReadFile(filepath.Join(aptConfDir, unattendedFile))
+	status.Installed = err == nil
+	status.Config = parseUnattendedConfig(string(auto), string(main))
+
+	if info, err := os.Stat(unattendedStamp); err == nil {
+		t := info.ModTime().UTC()
+		status.LastRun = &t
+	}
+	for _, data := range readRotated(unattendedLogDir, "unattended-upgrades.log") {
+		status.Runs = append(status.Runs, parseUnattendedLog(data)...)
+	}
+	sort.Slice(status.Runs, func(i, j int) bool { return status.Runs[i].Start.After(status.Runs[j].Start) })
+	if len(status.Runs) > maxUnattendedRun {
+		status.Runs = status.Runs[:maxUnattendedRun]
+	}
+	return status, nil
+}
+
+// SaveUnattended writes cfg. 20auto-upgrades is rewritten whole; in
+// 50unattended-upgrades only the managed settings change, so the comments
+// shipped with the package stay in place.
+func SaveUnattended(cfg UnattendedConfig) error {
+	a, err := aptOnly()
+	if err != nil {
+		return err
+	}
+	if err := validateUnattended(cfg); err != nil {
+		return err
+	}
+	mainPath := filepath.Join(aptConfDir, unattendedFile)
+	main, err := os.ReadFile(mainPath)
+	if err != nil {
+		return fmt.Errorf("unattended-upgrades is not installed")
+	}
+
+	if err := writeRootFile(a.run, renderAutoUpgrades(cfg), filepath.Join(aptConfDir, autoUpgradesFile), "0644"); err != nil {
+		return err
+	}
+	return writeRootFile(a.run, applyUnattendedConfig(string(main), cfg), mainPath, "0644")
+}
+
+// RunUnattended starts unattended-upgrade as a background job.
+func RunUnattended(dryRun bool) (jobs.Job, error) {
+	a, err := aptOnly()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	args := []string{"-v"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	return jobs.Start("unattended-upgrade", func() (interface{}, error) {
+		output, err := a.run("unattended-upgrade", args...)
+		if err != nil {
+			return output, fmt.Errorf("unattended-upgrade failed")
+		}
+		return output, nil
+	}), nil
+}
+
+var (
+	rebootTimePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+	mailPattern       = regexp.MustCompile(`^[A-Za-z0-9._%+-]+(@[A-Za-z0-9.-]+)?$`)
+)
+
+func validateUnattended(cfg UnattendedConfig) error {
+	for _, list := range [][]string{cfg.AllowedOrigins, cfg.OriginsPattern, cfg.Blacklist} {
+		for _, v := range list {
+			if v == "" || strings.ContainsAny(v, "\"\n\r") {
+				return fmt.Errorf("invalid entry: %q", v)
+			}
+		}
+	}
+	if cfg.AutomaticRebootTime != "" && cfg.AutomaticRebootTime != "now" && !rebootTimePattern.MatchString(cfg.AutomaticRebootTime) {
+		return fmt.Errorf("invalid reboot time: %s (use HH:MM or now)", cfg.AutomaticRebootTime)
+	}
+	if cfg.Mail != "" && !mailPattern.MatchString(cfg.Mail) {
+		return fmt.Errorf("invalid mail address: %s", cfg.Mail)
+	}
+	switch cfg.MailReport {
+	case "", "always", "only-on-error", "on-change":
+	default:
+		return fmt.Errorf("invalid mail report setting: %s", cfg.MailReport)
+	}
+	return nil
+}
+
+// parseUnattendedConfig reads the managed settings from the apt.conf
+// syntax of both files:
+//
+//	APT::Periodic::Unattended-Upgrade "1";
+//	Unattended-Upgrade::Allowed-Origins {
+//	        "${distro_id}:${distro_codename}-security";
+//	//      "${distro_id}:${distro_codename}-updates";
+//	};
+//	Unattended-Upgrade::Automatic-Reboot "true";
+func parseUnattendedConfig(auto, main string) *UnattendedConfig {
+	autoValues := aptConfScalars(auto)
+	mainValues := aptConfScalars(main)
+	return &UnattendedConfig{
+		Enabled:             autoValues["APT::Periodic::Unattended-Upgrade"] == "1",
+		UpdateLists:         autoValues["APT::Periodic::Update-Package-Lists"] == "1",
+		AllowedOrigins:      aptConfList(main, "Unattended-Upgrade::Allowed-Origins"),
+		OriginsPattern:      aptConfList(main, "Unattended-Upgrade::Origins-Pattern"),
+		Blacklist:           aptConfList(main, "Unattended-Upgrade::Package-Blacklist"),
+		AutomaticReboot:     mainValues["Unattended-Upgrade::Automatic-Reboot"] == "true",
+		AutomaticRebootTime: mainValues["Unattended-Upgrade::Automatic-Reboot-Time"],
+		Mail:                mainValues["Unattended-Upgrade::Mail"],
+		MailReport:          mainValues["Unattended-Upgrade::MailReport"],
+	}
+}
+
+var (
+	aptConfScalar = regexp.MustCompile(`^\s*([A-Za-z0-9:_-]+)\s+"([^"]*)"\s*;`)
+	aptConfString = regexp.MustCompile(`"([^"]*)"`)
+)
+
+// stripAptComment removes a trailing // comment outside of quotes.
+func stripAptComment(line string) string {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(line[i:], "//"):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func aptConfScalars(data string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		if m := aptConfScalar.FindStringSubmatch(stripAptComment(line)); m != nil {
+			values[m[1]] = m[2]
+		}
+	}
+	return values
+}
+
+// aptConfList returns the active quoted values of a "key { ... };" block.
+func aptConfList(data, key string) []string {
+	values := []string{}
+	start, end := aptConfBlock(data, key)
+	if start < 0 {
+		return values
+	}
+	lines := strings.Split(data, "\n")[start : end+1]
+	for i, line := range lines {
+		line = stripAptComment(line)
+		if i == 0 {
+			line = line[strings.Index(line, "{")+1:]
+		}
+		for _, m := range aptConfString.FindAllStringSubmatch(line, -1) {
+			values = append(values, m[1])
+		}
+	}
+	return values
+}
+
+// aptConfBlock returns the first and last line of the active block for key,
+// or -1 when there is none.
+func aptConfBlock(data, key string) (start, end int) {
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		active := strings.TrimSpace(aptConfSyntax(line))
+		if !strings.HasPrefix(active, key) || !strings.HasPrefix(strings.TrimSpace(active[len(key):]), "{") {
+			continue
+		}
+		for j := i; j < len(lines); j++ {
+			if strings.Contains(aptConfSyntax(lines[j]), "}") {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+// aptConfSyntax blanks out comments and quoted values, leaving the braces
+// and keys that structure a line. Values such as "${distro_id}" contain
+// braces of their own.
+func aptConfSyntax(line string) string {
+	return aptConfString.ReplaceAllString(stripAptComment(line), `""`)
+}
+
+func renderAutoUpgrades(cfg UnattendedConfig) string {
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprintf("APT::Periodic::Update-Package-Lists \"%s\";\nAPT::Periodic::Unattended-Upgrade \"%s\";\n",
+		flag(cfg.UpdateLists), flag(cfg.Enabled))
+}
+
+// applyUnattendedConfig sets the managed settings in 50unattended-upgrades.
+// Existing blocks and lines are replaced where they are, commented-out
+// defaults are activated, and anything missing is appended.
+func applyUnattendedConfig(data string, cfg UnattendedConfig) string {
+	data = setAptConfList(data, "Unattended-Upgrade::Allowed-Origins", cfg.AllowedOrigins)
+	data = setAptConfList(data, "Unattended-Upgrade::Origins-Pattern", cfg.OriginsPattern)
+	data = setAptConfList(data, "Unattended-Upgrade::Package-Blacklist", cfg.Blacklist)
+
+	reboot := "false"
+	if cfg.AutomaticReboot {
+		reboot = "true"
+	}
+	data = setAptConfScalar(data, "Unattended-Upgrade::Automatic-Reboot", reboot)
+	if cfg.AutomaticRebootTime != "" {
+		data = setAptConfScalar(data, "Unattended-Upgrade::Automatic-Reboot-Time", cfg.AutomaticRebootTime)
+	}
+	data = setAptConfScalar(data, "Unattended-Upgrade::Mail", cfg.Mail)
+	if cfg.MailReport != "" {
+		data = setAptConfScalar(data, "Unattended-Upgrade::MailReport", cfg.MailReport)
+	}
+	return data
+}
+
+func setAptConfList(data, key string, values []string) string {
+	block := []string{key + " {"}
+	for _, v := range values {
+		block = append(block, "\t\""+v+"\";")
+	}
+	block = append(block, "};")
+
+	start, end := aptConfBlock(data, key)
+	if start < 0 {
+		return strings.TrimRight(data, "\n") + "\n\n" + strings.Join(block, "\n") + "\n"
+	}
+	lines := strings.Split(data, "\n")
+	out := append(append(append([]string{}, lines[:start]...), block...), lines[end+1:]...)
+	return strings.Join(out, "\n")
+}
+
+func setAptConfScalar(data, key, value string) string {
+	line := key + " \"" + value + "\";"
+	lines := strings.Split(data, "\n")
+	commented := -1
+	for i, l := range lines {
+		if m := aptConfScalar.FindStringSubmatch(stripAptComment(l)); m != nil && m[1] == key {
+			lines[i] = line
+			return strings.Join(lines, "\n")
+		}
+		trimmed := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(l), "/"))
+		if commented < 0 && strings.HasPrefix(strings.TrimSpace(l), "//") && strings.HasPrefix(trimmed, key+" ") {
+			commented = i
+		}
+	}
+	if commented >= 0 {
+		lines[commented] = line
+		return strings.Join(lines, "\n")
+	}
+	return strings.TrimRight(data, "\n") + "\n" + line + "\n"
+}
+
+// parseUnattendedLog splits unattended-upgrades.log into runs. Each run
+// starts with "Starting unattended upgrades script":
+//
+//	2024-01-10 06:25:11,123 INFO Starting unattended upgrades script
+//	2024-01-10 06:25:14,456 INFO Packages that will be upgraded: libssl3 openssl
+//	2024-01-10 06:26:02,789 INFO All upgrades installed
+func parseUnattendedLog(data string) []UnattendedRun {
+	var runs []UnattendedRun
+	var run *UnattendedRun
+	finish := func() {
+		if run == nil {
+			return
+		}
+		switch {
+		case len(run.Errors) > 0:
+			run.Result = "error"
+		case len(run.Upgraded) > 0:
+			run.Result = "upgraded"
+		default:
+			run.Result = "nothing"
+		}
+		runs = append(runs, *run)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		stamp, _, _ := strings.Cut(fields[1], ",")
+		t := parseLogTime("2006-01-02 15:04:05", fields[0]+" "+stamp)
+		if t.IsZero() {
+			continue
+		}
+		level, msg := fields[2], strings.TrimSpace(fields[3])
+
+		if msg == "Starting unattended upgrades script" {
+			finish()
+			run = &UnattendedRun{Start: t, Upgraded: []string{}, KeptBack: []string{}, AutoRemoved: []string{}, Warnings: []string{}, Errors: []string{}}
+		}
+		if run == nil {
+			continue
+		}
+		run.End = t
+		switch {
+		case level == "ERROR" || level == "CRITICAL":
+			run.Errors = append(run.Errors, msg)
+		case level == "WARNING":
+			run.Warnings = append(run.Warnings, msg)
+		case strings.HasPrefix(msg, "Packages that will be upgraded:"):
+			run.Upgraded = strings.Fields(strings.TrimPrefix(msg, "Packages that will be upgraded:"))
+		case strings.HasPrefix(msg, "Packages that are kept back:"):
+			run.KeptBack = strings.Fields(strings.TrimPrefix(msg, "Packages that are kept back:"))
+		case strings.HasPrefix(msg, "Packages that were auto-removed:"):
+			run.AutoRemoved = strings.Fields(strings.TrimPrefix(msg, "Packages that were auto-removed:"))
+		}
+	}
+	finish()
+	return runs
+}
@@ -0,0 +1,83 @@
+package packages
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUnattendedConfig(t *testing.T) {
+	data, err := os.ReadFile("testdata/50unattended-upgrades")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auto := "APT::Periodic::Update-Package-Lists \"1\";\nAPT::Periodic::Unattended-Upgrade \"1\";\n"
+
+	cfg := parseUnattendedConfig(auto, string(data))
+	if !cfg.Enabled || !cfg.UpdateLists {
+		t.Fatalf("expected unattended upgrades enabled: %+v", cfg)
+	}
+	if len(cfg.AllowedOrigins) != 4 || cfg.AllowedOrigins[1] != "${distro_id}:${distro_codename}-security" {
+		t.Fatalf("unexpected origins: %v", cfg.AllowedOrigins)
+	}
+	if len(cfg.Blacklist) != 0 || cfg.AutomaticReboot || cfg.Mail != "" {
+		t.Fatalf("expected commented-out defaults to be ignored: %+v", cfg)
+	}
+
+	cfg.AllowedOrigins = cfg.AllowedOrigins[:2]
+	cfg.Blacklist = []string{"linux-", "postgresql-.*"}
+	cfg.AutomaticReboot = true
+	cfg.AutomaticRebootTime = "03:30"
+	cfg.Mail = "ops@example.com"
+	cfg.MailReport = "only-on-error"
+	if err := validateUnattended(*cfg); err != nil {
+		t.Fatal(err)
+	}
+	updated := applyUnattendedConfig(string(data), *cfg)
+	again := parseUnattendedConfig(auto, updated)
+	if strings.Join(again.AllowedOrigins, ",") != strings.Join(cfg.AllowedOrigins, ",") ||
+		strings.Join(again.Blacklist, ",") != "linux-,postgresql-.*" {
+		t.Fatalf("unexpected lists after update: %+v", again)
+	}
+	if !again.AutomaticReboot || again.AutomaticRebootTime != "03:30" || again.Mail != "ops@example.com" || again.MailReport != "only-on-error" {
+		t.Fatalf("unexpected settings after update: %+v", again)
+	}
+	if !strings.Contains(updated, "// Automatically reboot *WITHOUT CONFIRMATION* if") || strings.Count(updated, "Unattended-Upgrade::Mail ") != 1 {
+		t.Fatalf("expected comments kept and defaults activated in place:\n%s", updated)
+	}
+
+	for _, bad := range []UnattendedConfig{
+		{Blacklist: []string{"linux-\";\nAPT::Periodic"}},
+		{AutomaticRebootTime: "25:00"},
+		{Mail: "root; rm"},
+		{MailReport: "sometimes"},
+	} {
+		if err := validateUnattended(bad); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestParseUnattendedLog(t *testing.T) {
+	data, err := os.ReadFile("testdata/logs/unattended-upgrades.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := parseUnattendedLog(string(data))
+	if len(runs) != 3 {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+	if runs[0].Result != "nothing" {
+		t.Fatalf("unexpected first run: %+v", runs[0])
+	}
+	r := runs[1]
+	if r.Result != "upgraded" || strings.Join(r.Upgraded, ",") != "libssl3,openssl" || len(r.Warnings) != 1 || len(r.AutoRemoved) != 1 {
+		t.Fatalf("unexpected second run: %+v", r)
+	}
+	if r.End.Sub(r.Start).Seconds() != 52 {
+		t.Fatalf("unexpected duration: %v", r.End.Sub(r.Start))
+	}
+	if runs[2].Result != "error" || runs[2].Errors[0] != "Cache has broken packages, exiting" {
+		t.Fatalf("unexpected third run: %+v", runs[2])
+	}
+}
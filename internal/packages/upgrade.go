@@ -0,0 +1,124 @@
+package packages
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Upgradable is an installed package with a newer candidate version. Held
+// packages and those matching a pin are flagged, since a blanket upgrade
+// leaves them where the hold or pin says.
+type Upgradable struct {
+	Name             string `json:"name"`
+	CurrentVersion   string `json:"currentVersion"`
+	CandidateVersion string `json:"candidateVersion"`
+	Origin           string `json:"origin"`
+	Security         bool   `json:"security"`
+	Held             bool   `json:"held"`
+	Pin              string `json:"pin,omitempty"`
+}
+
+// PlanItem is one package affected by a transaction.
+type PlanItem struct {
+	Name       string `json:"name"`
+	OldVersion string `json:"oldVersion,omitempty"`
+	NewVersion string `json:"newVersion,omitempty"`
+	Origin     string `json:"origin,omitempty"`
+}
+
+// Plan is the outcome of a simulated transaction. DownloadSize and DiskDelta
+// are in bytes; a negative DiskDelta means space is freed. Token identifies
+// the plan so a client can confirm exactly what it previewed.
+type Plan struct {
+	Install      []PlanItem `json:"install"`
+	Upgrade      []PlanItem `json:"upgrade"`
+	Remove       []PlanItem `json:"remove"`
+	DownloadSize int64      `json:"downloadSize"`
+	DiskDelta    int64      `json:"diskDelta"`
+	Token        string     `json:"token"`
+}
+
+func newPlan() *Plan {
+	return &Plan{Install: []PlanItem{}, Upgrade: []PlanItem{}, Remove: []PlanItem{}}
+}
+
+func ListUpgradable() ([]Upgradable, error) {
+	upgrades, err := Detect().Upgradable()
+	if err != nil {
+		return nil, err
+	}
+	holds, _ := Holds()
+	var pins []Pin
+	if _, err := aptOnly(); err == nil {
+		pins, _ = ListPins()
+	}
+	markHeldAndPinned(upgrades, holds, pins)
+	return upgrades, nil
+}
+
+// SimulateUpgrade shows what upgrading pkgs (or everything when empty) would do.
+// dist allows installing and removing packages to resolve changed dependencies.
+func SimulateUpgrade(pkgs []string, dist bool) (*Plan, error) {
+	return Detect().SimulateUpgrade(pkgs, dist)
+}
+
+// UpgradePackages upgrades pkgs, or everything when pkgs is empty.
+func UpgradePackages(pkgs []string, dist bool) error {
+	return Detect().UpgradePackages(pkgs, dist)
+}
+
+// parseAptSimulation reads the Inst/Remv lines printed by `apt-get -s`:
+//
+//	Inst nginx [1.18.0-6ubuntu14.4] (1.18.0-6ubuntu14.5 Ubuntu:22.04/jammy-updates [amd64])
+//	Inst libfoo1 (2.0-1 Debian:12/stable [amd64])
+//	Remv oldpkg [1.0-1]
+//	Purg oldpkg [1.0-1]
+func parseAptSimulation(output string) *Plan {
+	plan := newPlan()
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		item := PlanItem{Name: fields[1]}
+		rest := strings.Join(fields[2:], " ")
+		if strings.HasPrefix(rest, "[") {
+			if end := strings.Index(rest, "]"); end > 0 {
+				item.OldVersion = rest[1:end]
+				rest = strings.TrimSpace(rest[end+1:])
+			}
+		}
+		if strings.HasPrefix(rest, "(") {
+			inner := strings.TrimSuffix(strings.TrimPrefix(rest, "("), ")")
+			parts := strings.Fields(inner)
+			if len(parts) > 0 {
+				item.NewVersion = parts[0]
+			}
+			if len(parts) > 1 && !strings.HasPrefix(parts[1], "[") {
+				item.Origin = strings.TrimSuffix(parts[1], ",")
+			}
+		}
+
+		switch fields[0] {
+		case "Inst":
+			if item.OldVersion != "" {
+				plan.Upgrade = append(plan.Upgrade, item)
+			} else {
+				plan.Install = append(plan.Install, item)
+			}
+		case "Remv", "Purg":
+			plan.Remove = append(plan.Remove, item)
+		}
+	}
+	return plan
+}
+
+// exitCode returns the exit status carried by err, or -1.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
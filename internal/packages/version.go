@@ -0,0 +1,207 @@
+package packages
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareDebVersions orders two Debian version strings ([epoch:]upstream[-revision])
+// the way dpkg does, returning -1, 0 or 1.
+func CompareDebVersions(a, b string) int {
+	epochA, upstreamA, revisionA := splitDebVersion(a)
+	epochB, upstreamB, revisionB := splitDebVersion(b)
+	if epochA != epochB {
+		return sign(epochA - epochB)
+	}
+	if c := debVerRevCmp(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return debVerRevCmp(revisionA, revisionB)
+}
+
+func splitDebVersion(v string) (epoch int, upstream, revision string) {
+	if i := strings.Index(v, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(v[:i])
+		v = v[i+1:]
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// debOrder is dpkg's character weight for the non-digit parts of a version:
+// "~" sorts before everything, even the end of the string, letters sort
+// before other symbols.
+func debOrder(s string) int {
+	if s == "" {
+		return 0
+	}
+	c := s[0]
+	switch {
+	case isDigit(c):
+		return 0
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+// debVerRevCmp is dpkg's verrevcmp: alternating non-digit parts compared by
+// debOrder and digit parts compared numerically.
+func debVerRevCmp(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			ac, bc := debOrder(a), debOrder(b)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			a, b = a[1:], b[1:]
+		}
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		firstDiff := 0
+		for a != "" && isDigit(a[0]) && b != "" && isDigit(b[0]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[0]) - int(b[0])
+			}
+			a, b = a[1:], b[1:]
+		}
+		if a != "" && isDigit(a[0]) {
+			return 1
+		}
+		if b != "" && isDigit(b[0]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// CompareRPMVersions orders two rpm [epoch:]version[-release] strings the way
+// rpm does, returning -1, 0 or 1. A missing epoch is 0, and the release is
+// only compared when both sides have one.
+func CompareRPMVersions(a, b string) int {
+	epochA, versionA, releaseA := splitRPMVersion(a)
+	epochB, versionB, releaseB := splitRPMVersion(b)
+	if epochA != epochB {
+		return sign(epochA - epochB)
+	}
+	if c := rpmVerCmp(versionA, versionB); c != 0 || releaseA == "" || releaseB == "" {
+		return c
+	}
+	return rpmVerCmp(releaseA, releaseB)
+}
+
+func splitRPMVersion(v string) (epoch int, version, release string) {
+	if i := strings.Index(v, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(v[:i])
+		v = v[i+1:]
+	}
+	version, release, _ = strings.Cut(v, "-")
+	return epoch, version, release
+}
+
+// rpmVerCmp is rpm's rpmvercmp: versions are split into alphabetic and
+// numeric segments, separators are ignored, "~" sorts before anything and
+// "^" after the end of the string but before any other segment.
+func rpmVerCmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSeparator := func(r rune) bool {
+		return !isAlnum(byte(r)) && r != '~' && r != '^'
+	}
+	for a != "" || b != "" {
+		a, b = strings.TrimLeftFunc(a, isSeparator), strings.TrimLeftFunc(b, isSeparator)
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := isDigit(a[0])
+		segA, segB := rpmSegment(a, numeric), rpmSegment(b, numeric)
+		a, b = a[len(segA):], b[len(segB):]
+		if segB == "" {
+			// A numeric segment is newer than an alphabetic one
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			segA, segB = strings.TrimLeft(segA, "0"), strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				return sign(len(segA) - len(segB))
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// rpmSegment returns the leading run of digits, or of letters, in s.
+func rpmSegment(s string, numeric bool) string {
+	i := 0
+	for i < len(s) && isAlnum(s[i]) && isDigit(s[i]) == numeric {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+package packages
+
+import "testing"
+
+func TestCompareDebVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0-0", 0},
+		{"1:1.0", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0", "1.0+b1", -1},
+		{"1.0a", "1.0", 1},
+		{"1.10", "1.9", 1},
+		{"1.001", "1.1", 0},
+		{"3.0.13-1~deb12u1", "3.0.13-1", -1},
+		{"3.0.2-0ubuntu1.12", "3.0.2-0ubuntu1.14", -1},
+		{"2.36-9+deb12u4", "2.36-9+deb12u10", -1},
+		{"1.2-3-4", "1.2-3-10", -1},
+	} {
+		if got := CompareDebVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareDebVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := CompareDebVersions(tc.b, tc.a); got != -tc.want {
+			t.Errorf("CompareDebVersions(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestCompareRPMVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0-1", "1.0-1", 0},
+		{"1.0", "1.0-5", 0},
+		{"1:1.0-1", "2.0-1", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1.0.1", "1.0", 1},
+		{"1.10", "1.9", 1},
+		{"1.0a", "1.0", 1},
+		{"1.0", "1.0a", -1},
+		{"2.0a", "2.0.1", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1_0", "1.0", 0},
+		{"5.1.8-6.el9", "5.1.8-9.el9", -1},
+		{"3.0.7-25.el9_3", "3.0.7-27.el9", -1},
+	} {
+		if got := CompareRPMVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("CompareRPMVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := CompareRPMVersions(tc.b, tc.a); got != -tc.want {
+			t.Errorf("CompareRPMVersions(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
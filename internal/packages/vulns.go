@@ -0,0 +1,850 @@
+package packages
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// vulnDir holds the imported vulnerability databases, one normalized JSON
+// file each; osReleasePath identifies the release to keep advisories for.
+var (
+	vulnDir       = "/var/lib/orbit/vulns"
+	osReleasePath = "/etc/os-release"
+)
+
+// MaxVulnDBSize bounds an uploaded database file. Full OSV ecosystem dumps
+// run to a few hundred megabytes.
+const MaxVulnDBSize = 1 << 30
+
+// ErrNoVulnDB is returned by ScanVulns before any database was imported.
+var ErrNoVulnDB = errors.New("no vulnerability database imported")
+
+// Errors returned for a database name that is not valid or not imported.
+var (
+	ErrInvalidVulnDB  = errors.New("invalid database name")
+	ErrVulnDBNotFound = errors.New("database not found")
+)
+
+// Vulnerability database formats accepted by ImportVulnDB.
+const (
+	FormatOVAL            = "oval"
+	FormatSecurityTracker = "security-tracker"
+	FormatOSV             = "osv"
+)
+
+// Advisory is one vulnerability of one package, normalized from an imported
+// database. Package may be a Debian source package. An empty FixedVersion
+// means no fix is available yet; Introduced, when set, is the first affected
+// version.
+type Advisory struct {
+	ID           string   `json:"id"`
+	Aliases      []string `json:"aliases,omitempty"`
+	Package      string   `json:"package"`
+	Release      string   `json:"release,omitempty"`
+	Ecosystem    string   `json:"ecosystem,omitempty"`
+	Severity     string   `json:"severity"`
+	Introduced   string   `json:"introduced,omitempty"`
+	FixedVersion string   `json:"fixedVersion"`
+	Summary      string   `json:"summary,omitempty"`
+}
+
+// VulnDB is an imported vulnerability database. Listings leave out the
+// advisories and only report their Count.
+type VulnDB struct {
+	Name       string     `json:"name"`
+	Format     string     `json:"format"`
+	Imported   time.Time  `json:"imported"`
+	Count      int        `json:"count"`
+	Advisories []Advisory `json:"advisories,omitempty"`
+}
+
+// Vulnerability is an advisory that applies to an installed package.
+type Vulnerability struct {
+	Advisory
+	Database string `json:"database"`
+}
+
+// VulnerablePackage is an installed package with the advisories that apply
+// to its version, most severe first.
+type VulnerablePackage struct {
+	Name            string          `json:"name"`
+	Version         string          `json:"version"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// VulnReport is the result of matching the installed packages against the
+// imported databases.
+type VulnReport struct {
+	Generated  time.Time           `json:"generated"`
+	Databases  []VulnDB            `json:"databases"`
+	BySeverity map[string]int      `json:"bySeverity"`
+	Packages   []VulnerablePackage `json:"packages"`
+}
+
+// vulnTarget is a name and version under which vulnerability data may list
+// an installed package.
+type vulnTarget struct {
+	Name    string
+	Version string
+}
+
+// ScanVulns matches the installed packages against the imported databases.
+// Nothing is fetched from the network.
+func ScanVulns() (*VulnReport, error) {
+	dbs, err := loadVulnDBs()
+	if err != nil {
+		return nil, err
+	}
+	if len(dbs) == 0 {
+		return nil, ErrNoVulnDB
+	}
+
+	m := Detect()
+	pkgs, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	var targets map[string][]vulnTarget
+	compare := CompareDebVersions
+	switch b := m.(type) {
+	case *apt:
+		targets = b.vulnTargets()
+	case *dnf:
+		targets = b.vulnTargets()
+		compare = CompareRPMVersions
+	}
+
+	report := &VulnReport{
+		Generated:  time.Now(),
+		Databases:  []VulnDB{},
+		BySeverity: map[string]int{},
+		Packages:   scanVulns(pkgs, targets, dbs, compare),
+	}
+	for _, db := range dbs {
+		db.Advisories = nil
+		report.Databases = append(report.Databases, db)
+	}
+	for _, pkg := range report.Packages {
+		for _, v := range pkg.Vulnerabilities {
+			report.BySeverity[v.Severity]++
+		}
+	}
+	return report, nil
+}
+
+// scanVulns returns the packages affected by an advisory under their own
+// name or one of their targets. An advisory found through several targets
+// or databases is reported once.
+func scanVulns(pkgs []Package, targets map[string][]vulnTarget, dbs []VulnDB, compare func(a, b string) int) []VulnerablePackage {
+	byPackage := make(map[string][]Vulnerability)
+	for _, db := range dbs {
+		for _, adv := range db.Advisories {
+			byPackage[adv.Package] = append(byPackage[adv.Package], Vulnerability{Advisory: adv, Database: db.Name})
+		}
+	}
+
+	result := []VulnerablePackage{}
+	for _, pkg := range pkgs {
+		candidates, ok := targets[pkg.Name]
+		if !ok {
+			candidates = []vulnTarget{{Name: pkg.Name, Version: pkg.Version}}
+		}
+		seen := make(map[string]bool)
+		var found []Vulnerability
+		for _, target := range candidates {
+			for _, v := range byPackage[target.Name] {
+				if !seen[v.ID] && affects(v.Advisory, target.Version, compare) {
+					seen[v.ID] = true
+					found = append(found, v)
+				}
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+		sort.SliceStable(found, func(i, j int) bool {
+			ri, rj := severityRank(found[i].Severity), severityRank(found[j].Severity)
+			if ri != rj {
+				return ri > rj
+			}
+			return found[i].ID < found[j].ID
+		})
+		result = append(result, VulnerablePackage{Name: pkg.Name, Version: pkg.Version, Vulnerabilities: found})
+	}
+	return result
+}
+
+func affects(adv Advisory, version string, compare func(a, b string) int) bool {
+	if adv.Introduced != "" && compare(version, adv.Introduced) < 0 {
+		return false
+	}
+	return adv.FixedVersion == "" || compare(version, adv.FixedVersion) < 0
+}
+
+// vulnTargets adds the source package of each installed package, which is
+// what the Debian security tracker, Debian OVAL and OSV data refer to.
+func (a *apt) vulnTargets() map[string][]vulnTarget {
+	output, err := a.query("dpkg-query", "-W", "-f=${Package}\t${Version}\t${source:Package}\t${source:Version}\n")
+	if err != nil {
+		return nil
+	}
+	targets := make(map[string][]vulnTarget)
+	for _, line := range nonEmptyLines(output) {
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 || len(targets[parts[0]]) > 0 {
+			continue
+		}
+		targets[parts[0]] = []vulnTarget{{Name: parts[0], Version: parts[1]}}
+		if parts[2] != parts[0] {
+			targets[parts[0]] = append(targets[parts[0]], vulnTarget{Name: parts[2], Version: parts[3]})
+		}
+	}
+	return targets
+}
+
+// vulnTargets uses the epoch-qualified version, as OVAL and OSV fixed
+// versions carry the epoch and List leaves it out.
+func (d *dnf) vulnTargets() map[string][]vulnTarget {
+	output, err := d.query("rpm", "-qa", "--queryformat", "%{NAME}\t%{EPOCHNUM}:%{VERSION}-%{RELEASE}\n")
+	if err != nil {
+		return nil
+	}
+	targets := make(map[string][]vulnTarget)
+	for _, line := range nonEmptyLines(output) {
+		name, evr, ok := strings.Cut(line, "\t")
+		if ok && len(targets[name]) == 0 {
+			targets[name] = []vulnTarget{{Name: name, Version: evr}}
+		}
+	}
+	return targets
+}
+
+// ImportVulnDB parses a vulnerability database in the given format (detected
+// from the data when empty) and stores the advisories for this host's
+// release under name, replacing an earlier import of the same name.
+func ImportVulnDB(name, format string, data []byte) (*VulnDB, error) {
+	if !isValidRepoName(name) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidVulnDB, name)
+	}
+	if format == "" {
+		format = detectVulnFormat(data)
+	}
+
+	var advisories []Advisory
+	var err error
+	switch format {
+	case FormatOVAL:
+		advisories, err = parseOVAL(data)
+	case FormatSecurityTracker:
+		advisories, err = parseSecurityTracker(data)
+	case FormatOSV:
+		advisories, err = parseOSV(data)
+	default:
+		return nil, fmt.Errorf("unsupported database format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s data: %w", format, err)
+	}
+	advisories = forRelease(advisories, readOSRelease())
+	if len(advisories) == 0 {
+		return nil, fmt.Errorf("no advisories for this release found")
+	}
+
+	db := &VulnDB{Name: name, Format: format, Imported: time.Now().UTC(), Count: len(advisories), Advisories: advisories}
+	content, err := json.Marshal(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(vulnDir, 0750); err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(vulnDir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, content, 0640); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, filepath.Join(vulnDir, name+".json")); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	db.Advisories = nil
+	return db, nil
+}
+
+// ListVulnDBs returns the imported databases without their advisories.
+func ListVulnDBs() ([]VulnDB, error) {
+	dbs, err := loadVulnDBs()
+	if err != nil {
+		return nil, err
+	}
+	for i := range dbs {
+		dbs[i].Advisories = nil
+	}
+	return dbs, nil
+}
+
+// DeleteVulnDB removes an imported database.
+func DeleteVulnDB(name string) error {
+	if !isValidRepoName(name) {
+		return fmt.Errorf("%w: %s", ErrInvalidVulnDB, name)
+	}
+	err := os.Remove(filepath.Join(vulnDir, name+".json"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrVulnDBNotFound, name)
+	}
+	return err
+}
+
+// OpenSyncedVulnDB opens a database file synced to dir on the server. name
+// is relative to dir and must stay inside it, also after resolving symlinks,
+// and only regular files are opened.
+func OpenSyncedVulnDB(dir, name string) (*os.File, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no vulnerability sync directory configured")
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(root, name)
+	if !isWithin(root, path) {
+		return nil, fmt.Errorf("invalid path: %s", name)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %s", name)
+	}
+	if !isWithin(root, resolved) {
+		return nil, fmt.Errorf("invalid path: %s", name)
+	}
+
+	// O_NONBLOCK keeps a FIFO swapped in after the check from blocking the open
+	f, err := os.OpenFile(resolved, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("not a regular file: %s", name)
+	}
+	return f, nil
+}
+
+// isWithin reports whether path is root or below it.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func loadVulnDBs() ([]VulnDB, error) {
+	paths, _ := filepath.Glob(filepath.Join(vulnDir, "*.json"))
+	sort.Strings(paths)
+	dbs := []VulnDB{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var db VulnDB
+		if err := json.Unmarshal(data, &db); err != nil {
+			return nil, fmt.Errorf("corrupt vulnerability database %s: %w", filepath.Base(path), err)
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// WriteVulnCSV writes a report as CSV, one row per package and advisory.
+func WriteVulnCSV(w io.Writer, report *VulnReport) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"package", "version", "id", "severity", "fixed_version", "affected_package", "database", "summary"})
+	for _, pkg := range report.Packages {
+		for _, v := range pkg.Vulnerabilities {
+			out.Write([]string{pkg.Name, pkg.Version, v.ID, v.Severity, v.FixedVersion, v.Package, v.Database, v.Summary})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func detectVulnFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	head := trimmed[:min(len(trimmed), 4096)]
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return FormatOSV
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return FormatOVAL
+	case bytes.HasPrefix(trimmed, []byte("[")), bytes.Contains(head, []byte(`"affected"`)):
+		return FormatOSV
+	default:
+		return FormatSecurityTracker
+	}
+}
+
+// readOSRelease returns the fields of /etc/os-release.
+func readOSRelease() map[string]string {
+	fields := make(map[string]string)
+	data, _ := os.ReadFile(osReleasePath)
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			fields[key] = strings.Trim(value, `"'`)
+		}
+	}
+	return fields
+}
+
+// forRelease keeps the advisories without a release and those for the host's
+// release, given as a codename (security tracker) or version (OSV, where
+// "9" covers "9.3"). OSV advisories must also be for the host's
+// distribution and name a release, so language ecosystems such as PyPI and
+// bare "Debian" records never match system packages.
+func forRelease(advisories []Advisory, osRelease map[string]string) []Advisory {
+	codename, versionID := osRelease["VERSION_CODENAME"], osRelease["VERSION_ID"]
+	var kept []Advisory
+	for _, adv := range advisories {
+		if adv.Ecosystem != "" && (osvDistro(adv.Ecosystem) != osRelease["ID"] || adv.Release == "") {
+			continue
+		}
+		r := adv.Release
+		if r == "" || r == codename || r == versionID || strings.HasPrefix(versionID, r+".") {
+			kept = append(kept, adv)
+		}
+	}
+	return kept
+}
+
+// normalizeSeverity maps the severity and urgency names of the supported
+// formats to lowercase, dropping the security tracker's "*" annotations.
+func normalizeSeverity(s string) string {
+	s = strings.ToLower(strings.TrimRight(strings.TrimSpace(s), "*"))
+	switch s {
+	case "", "not yet assigned", "unassigned", "none":
+		return "unknown"
+	case "important":
+		return "high"
+	case "moderate":
+		return "medium"
+	case "unimportant":
+		return "negligible"
+	}
+	return s
+}
+
+func severityRank(s string) int {
+	switch s {
+	case "critical":
+		return 4
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	case "negligible":
+		return 0
+	}
+	return -1
+}
+
+func sortAdvisories(advisories []Advisory) {
+	sort.Slice(advisories, func(i, j int) bool {
+		a, b := advisories[i], advisories[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Release < b.Release
+	})
+}
+
+// parseSecurityTracker reads the Debian security tracker JSON
+// (https://security-tracker.debian.org/tracker/data/json), keyed by source
+// package, then issue, with a status per release:
+//
+//	{"openssl": {"CVE-2024-0727": {"description": "...", "releases":
+//	  {"bookworm": {"status": "resolved", "fixed_version": "3.0.13-1~deb12u1", "urgency": "low"}}}}}
+//
+// A fixed version of "0" means the release was never affected.
+func parseSecurityTracker(data []byte) ([]Advisory, error) {
+	var tracker map[string]map[string]struct {
+		Description string `json:"description"`
+		Releases    map[string]struct {
+			Status       string `json:"status"`
+			FixedVersion string `json:"fixed_version"`
+			Urgency      string `json:"urgency"`
+		} `json:"releases"`
+	}
+	if err := json.Unmarshal(data, &tracker); err != nil {
+		return nil, err
+	}
+
+	var advisories []Advisory
+	for pkg, issues := range tracker {
+		for id, issue := range issues {
+			for release, status := range issue.Releases {
+				adv := Advisory{ID: id, Package: pkg, Release: release, Severity: normalizeSeverity(status.Urgency), Summary: issue.Description}
+				switch status.Status {
+				case "resolved":
+					if status.FixedVersion == "0" || status.FixedVersion == "" {
+						continue
+					}
+					adv.FixedVersion = status.FixedVersion
+				case "open", "undetermined":
+				default:
+					continue
+				}
+				advisories = append(advisories, adv)
+			}
+		}
+	}
+	sortAdvisories(advisories)
+	return advisories, nil
+}
+
+type ovalCriteria struct {
+	Criteria   []ovalCriteria `xml:"criteria"`
+	Criterions []struct {
+		TestRef string `xml:"test_ref,attr"`
+		Negate  bool   `xml:"negate,attr"`
+	} `xml:"criterion"`
+}
+
+type ovalTest struct {
+	ID     string `xml:"id,attr"`
+	Object struct {
+		Ref string `xml:"object_ref,attr"`
+	} `xml:"object"`
+	State struct {
+		Ref string `xml:"state_ref,attr"`
+	} `xml:"state"`
+}
+
+type ovalObject struct {
+	ID   string `xml:"id,attr"`
+	Name struct {
+		Value  string `xml:",chardata"`
+		VarRef string `xml:"var_ref,attr"`
+	} `xml:"name"`
+}
+
+type ovalState struct {
+	ID  string `xml:"id,attr"`
+	EVR struct {
+		Value     string `xml:",chardata"`
+		Operation string `xml:"operation,attr"`
+	} `xml:"evr"`
+}
+
+type ovalDocument struct {
+	Definitions []struct {
+		ID          string `xml:"id,attr"`
+		Class       string `xml:"class,attr"`
+		Title       string `xml:"metadata>title"`
+		Description string `xml:"metadata>description"`
+		References  []struct {
+			Source string `xml:"source,attr"`
+			RefID  string `xml:"ref_id,attr"`
+		} `xml:"metadata>reference"`
+		Severity string       `xml:"metadata>advisory>severity"`
+		Criteria ovalCriteria `xml:"criteria"`
+	} `xml:"definitions>definition"`
+	DpkgTests   []ovalTest   `xml:"tests>dpkginfo_test"`
+	RPMTests    []ovalTest   `xml:"tests>rpminfo_test"`
+	DpkgObjects []ovalObject `xml:"objects>dpkginfo_object"`
+	RPMObjects  []ovalObject `xml:"objects>rpminfo_object"`
+	DpkgStates  []ovalState  `xml:"states>dpkginfo_state"`
+	RPMStates   []ovalState  `xml:"states>rpminfo_state"`
+	Variables   []struct {
+		ID     string   `xml:"id,attr"`
+		Values []string `xml:"value"`
+	} `xml:"variables>constant_variable"`
+}
+
+// parseOVAL reads Debian, Ubuntu or Red Hat OVAL definitions. Each
+// dpkginfo/rpminfo test whose state is "evr less than" names a package and
+// its fixed version; a test without a state (Ubuntu's unfixed CVEs) means any
+// installed version is affected. Tests on other properties, such as the
+// signing key or the release package, are not package advisories.
+func parseOVAL(data []byte) ([]Advisory, error) {
+	var doc ovalDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	tests := make(map[string]ovalTest)
+	for _, t := range append(doc.DpkgTests, doc.RPMTests...) {
+		tests[t.ID] = t
+	}
+	variables := make(map[string][]string)
+	for _, v := range doc.Variables {
+		variables[v.ID] = v.Values
+	}
+	objects := make(map[string][]string)
+	for _, o := range append(doc.DpkgObjects, doc.RPMObjects...) {
+		if o.Name.VarRef != "" {
+			objects[o.ID] = variables[o.Name.VarRef]
+		} else {
+			objects[o.ID] = []string{strings.TrimSpace(o.Name.Value)}
+		}
+	}
+	states := make(map[string]ovalState)
+	for _, s := range append(doc.DpkgStates, doc.RPMStates...) {
+		states[s.ID] = s
+	}
+
+	var advisories []Advisory
+	seen := make(map[string]bool)
+	for _, def := range doc.Definitions {
+		if def.Class == "inventory" {
+			continue
+		}
+		var ids []string
+		for _, ref := range def.References {
+			if ref.Source == "CVE" && !contains(ids, ref.RefID) {
+				ids = append(ids, ref.RefID)
+			}
+		}
+		if len(ids) == 0 {
+			fields := strings.Fields(def.Title + " " + def.ID)
+			if len(fields) == 0 {
+				continue
+			}
+			ids = fields[:1]
+		}
+		summary := strings.TrimSpace(def.Title)
+		if summary == "" {
+			summary = strings.TrimSpace(def.Description)
+		}
+
+		for _, ref := range ovalTestRefs(def.Criteria) {
+			test, ok := tests[ref]
+			if !ok {
+				continue
+			}
+			fixed := ""
+			if test.State.Ref != "" {
+				state := states[test.State.Ref]
+				if state.EVR.Value == "" || state.EVR.Operation != "less than" {
+					continue
+				}
+				fixed = strings.TrimPrefix(strings.TrimSpace(state.EVR.Value), "0:")
+			}
+			for _, pkg := range objects[test.Object.Ref] {
+				for _, id := range ids {
+					key := id + "\x00" + pkg + "\x00" + fixed
+					if pkg == "" || seen[key] {
+						continue
+					}
+					seen[key] = true
+					advisories = append(advisories, Advisory{
+						ID: id, Package: pkg, Severity: normalizeSeverity(def.Severity),
+						FixedVersion: fixed, Summary: summary,
+					})
+				}
+			}
+		}
+	}
+	sortAdvisories(advisories)
+	return advisories, nil
+}
+
+// ovalTestRefs returns the tests referenced anywhere in a criteria tree,
+// except negated ones.
+func ovalTestRefs(c ovalCriteria) []string {
+	var refs []string
+	for _, criterion := range c.Criterions {
+		if !criterion.Negate {
+			refs = append(refs, criterion.TestRef)
+		}
+	}
+	for _, sub := range c.Criteria {
+		refs = append(refs, ovalTestRefs(sub)...)
+	}
+	return refs
+}
+
+type osvEntry struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Upstream []string `json:"upstream"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+	Affected         []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string              `json:"type"`
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+		EcosystemSpecific map[string]interface{} `json:"ecosystem_specific"`
+		DatabaseSpecific  map[string]interface{} `json:"database_specific"`
+	} `json:"affected"`
+}
+
+// parseOSV reads OSV records from an ecosystem dump (the all.zip of
+// https://osv-vulnerabilities.storage.googleapis.com), a JSON array or a
+// single record. Each ECOSYSTEM range event pair becomes an advisory; the
+// release comes from the ecosystem, e.g. "Debian:12" or "Ubuntu:22.04:LTS".
+func parseOSV(data []byte) ([]Advisory, error) {
+	var entries []osvEntry
+	switch trimmed := bytes.TrimSpace(data); {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if !strings.HasSuffix(f.Name, ".json") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			var entry osvEntry
+			err = json.NewDecoder(rc).Decode(&entry)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			entries = append(entries, entry)
+		}
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, err
+		}
+	default:
+		var entry osvEntry
+		if err := json.Unmarshal(trimmed, &entry); err != nil {
+			return nil, err
+		}
+		entries = []osvEntry{entry}
+	}
+
+	var advisories []Advisory
+	for _, entry := range entries {
+		var aliases []string
+		for _, alias := range append(entry.Aliases, entry.Upstream...) {
+			if alias != entry.ID && !contains(aliases, alias) {
+				aliases = append(aliases, alias)
+			}
+		}
+		summary := entry.Summary
+		if summary == "" {
+			summary, _, _ = strings.Cut(strings.TrimSpace(entry.Details), "\n")
+		}
+
+		for _, affected := range entry.Affected {
+			severity := osvSeverity(entry, affected.EcosystemSpecific, affected.DatabaseSpecific)
+			base := Advisory{
+				ID: entry.ID, Aliases: aliases, Package: affected.Package.Name,
+				Release: osvRelease(affected.Package.Ecosystem), Ecosystem: affected.Package.Ecosystem,
+				Severity: severity, Summary: summary,
+			}
+			for _, r := range affected.Ranges {
+				if r.Type != "ECOSYSTEM" {
+					continue
+				}
+				introduced, open := "", false
+				for _, event := range r.Events {
+					if v, ok := event["introduced"]; ok {
+						introduced, open = v, true
+						if v == "0" {
+							introduced = ""
+						}
+					}
+					if v, ok := event["fixed"]; ok {
+						adv := base
+						adv.Introduced, adv.FixedVersion = introduced, v
+						advisories = append(advisories, adv)
+						open = false
+					}
+				}
+				if open {
+					adv := base
+					adv.Introduced = introduced
+					advisories = append(advisories, adv)
+				}
+			}
+		}
+	}
+	sortAdvisories(advisories)
+	return advisories, nil
+}
+
+// osvSeverity takes the distribution rating where the record has one: the
+// Debian urgency, the Ubuntu priority or a database severity. CVSS vectors
+// alone are reported as unknown.
+func osvSeverity(entry osvEntry, specific ...map[string]interface{}) string {
+	for _, m := range append(specific, entry.DatabaseSpecific) {
+		for _, key := range []string{"urgency", "severity"} {
+			if s, ok := m[key].(string); ok && s != "" {
+				return normalizeSeverity(s)
+			}
+		}
+	}
+	for _, s := range entry.Severity {
+		if s.Type == "Ubuntu" {
+			return normalizeSeverity(s.Score)
+		}
+	}
+	return "unknown"
+}
+
+// osvDistros maps OSV ecosystem names to os-release IDs.
+var osvDistros = map[string]string{
+	"AlmaLinux":   "almalinux",
+	"Alpine":      "alpine",
+	"Debian":      "debian",
+	"Mageia":      "mageia",
+	"Red Hat":     "rhel",
+	"Rocky Linux": "rocky",
+	"SUSE":        "sles",
+	"openSUSE":    "opensuse-leap",
+	"Ubuntu":      "ubuntu",
+}
+
+// osvDistro returns the os-release ID of an ecosystem such as "Debian:12",
+// or "" for ecosystems that are not distributions.
+func osvDistro(ecosystem string) string {
+	name, _, _ := strings.Cut(ecosystem, ":")
+	return osvDistros[name]
+}
+
+// osvRelease returns the first part of an ecosystem suffix that looks like a
+// version: "12" for "Debian:12", "22.04" for "Ubuntu:Pro:22.04:LTS".
+func osvRelease(ecosystem string) string {
+	parts := strings.Split(ecosystem, ":")
+	for _, part := range parts[1:] {
+		if part != "" && isDigit(part[0]) {
+			return part
+		}
+	}
+	return ""
+}
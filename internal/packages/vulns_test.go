@@ -0,0 +1,187 @@
+package packages
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readVulnData(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", "vulns", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseSecurityTracker(t *testing.T) {
+	advisories, err := parseSecurityTracker(readVulnData(t, "security-tracker.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// CVE-2023-6129 never affected bookworm
+	if len(advisories) != 3 {
+		t.Fatalf("unexpected advisories: %+v", advisories)
+	}
+	curl := advisories[0]
+	if curl.Package != "curl" || curl.FixedVersion != "" || curl.Severity != "medium" || curl.Release != "bookworm" {
+		t.Fatalf("unexpected open advisory: %+v", curl)
+	}
+	kept := forRelease(advisories, map[string]string{"VERSION_CODENAME": "bookworm", "VERSION_ID": "12"})
+	if len(kept) != 2 || kept[1].FixedVersion != "3.0.13-1~deb12u1" {
+		t.Fatalf("unexpected bookworm advisories: %+v", kept)
+	}
+}
+
+func TestParseOVAL(t *testing.T) {
+	advisories, err := parseOVAL(readVulnData(t, "ubuntu.oval.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"CVE-2024-2398 curl  medium",
+		"CVE-2024-0727 libssl3 3.0.2-0ubuntu1.14 low",
+		"CVE-2024-0727 openssl 3.0.2-0ubuntu1.14 low",
+	}
+	if len(advisories) != len(want) {
+		t.Fatalf("unexpected advisories: %+v", advisories)
+	}
+	for i, adv := range advisories {
+		if got := strings.Join([]string{adv.ID, adv.Package, adv.FixedVersion, adv.Severity}, " "); got != want[i] {
+			t.Errorf("advisory %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestParseOSV(t *testing.T) {
+	data := readVulnData(t, "osv.json")
+	if format := detectVulnFormat(data); format != FormatOSV {
+		t.Fatalf("detected %s", format)
+	}
+	advisories, err := parseOSV(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(advisories) != 5 {
+		t.Fatalf("unexpected advisories: %+v", advisories)
+	}
+	bash := advisories[0]
+	if bash.ID != "RLSA-2024:1234" || bash.Release != "9" || bash.Introduced != "5.1" || bash.Severity != "high" ||
+		bash.Summary != "An update for bash is available." || bash.Aliases[0] != "CVE-2024-1111" {
+		t.Fatalf("unexpected advisory: %+v", bash)
+	}
+	kept := forRelease(advisories, map[string]string{"ID": "ubuntu", "VERSION_ID": "22.04"})
+	if len(kept) != 1 || kept[0].FixedVersion != "3.0.2-0ubuntu1.14" || kept[0].Aliases[0] != "CVE-2024-0727" {
+		t.Fatalf("unexpected jammy advisories: %+v", kept)
+	}
+	if kept := forRelease(advisories, map[string]string{"ID": "rocky", "VERSION_ID": "9.3"}); len(kept) != 1 || kept[0].Package != "bash" {
+		t.Fatalf("unexpected Rocky 9.3 advisories: %+v", kept)
+	}
+	// The release of another distribution is no match either
+	if kept := forRelease(advisories, map[string]string{"ID": "debian", "VERSION_ID": "9"}); len(kept) != 0 {
+		t.Fatalf("unexpected Debian 9 advisories: %+v", kept)
+	}
+}
+
+func TestScanVulns(t *testing.T) {
+	var calls []string
+	a := newApt(nil, recorded(t, map[string]string{
+		"dpkg-query -W -f=${Package}\t${Version}\t${source:Package}\t${source:Version}\n": "dpkg-query-source.txt",
+	}, &calls))
+	pkgs := []Package{
+		{Name: "curl", Version: "7.81.0-1ubuntu1.15"},
+		{Name: "libssl3", Version: "3.0.2-0ubuntu1.12"},
+		{Name: "zlib1g", Version: "1:1.2.11.dfsg-2ubuntu9.2"},
+	}
+	oval, _ := parseOVAL(readVulnData(t, "ubuntu.oval.xml"))
+	osv, _ := parseOSV(readVulnData(t, "osv.json"))
+	dbs := []VulnDB{
+		{Name: "jammy-oval", Advisories: oval},
+		{Name: "osv", Advisories: forRelease(osv, map[string]string{"ID": "ubuntu", "VERSION_ID": "22.04"})},
+		{Name: "zlib", Advisories: []Advisory{{ID: "CVE-2022-37434", Package: "zlib", Severity: "medium", FixedVersion: "1:1.2.11.dfsg-2ubuntu9.1"}}},
+	}
+
+	result := scanVulns(pkgs, a.vulnTargets(), dbs, CompareDebVersions)
+	if len(result) != 2 || result[0].Name != "curl" || result[1].Name != "libssl3" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	// libssl3 matches the OVAL entries by binary and source name and the
+	// OSV entry by source name; the CVE is reported once
+	ssl := result[1].Vulnerabilities
+	if len(ssl) != 2 || ssl[0].ID != "CVE-2024-0727" || ssl[0].Database != "jammy-oval" || ssl[1].ID != "UBUNTU-CVE-2024-0727" {
+		t.Fatalf("unexpected libssl3 vulnerabilities: %+v", ssl)
+	}
+
+	var out bytes.Buffer
+	if err := WriteVulnCSV(&out, &VulnReport{Packages: result}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || lines[1] != "curl,7.81.0-1ubuntu1.15,CVE-2024-2398,medium,,curl,jammy-oval,CVE-2024-2398 on Ubuntu 22.04 LTS (jammy) - medium." {
+		t.Fatalf("unexpected CSV:\n%s", out.String())
+	}
+}
+
+func TestImportVulnDB(t *testing.T) {
+	vulnDir = t.TempDir()
+	osReleasePath = filepath.Join(t.TempDir(), "os-release")
+	os.WriteFile(osReleasePath, []byte("ID=debian\nVERSION_ID=\"12\"\nVERSION_CODENAME=bookworm\n"), 0644)
+
+	db, err := ImportVulnDB("debian", "", readVulnData(t, "security-tracker.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Format != FormatSecurityTracker || db.Count != 2 || db.Advisories != nil {
+		t.Fatalf("unexpected import: %+v", db)
+	}
+	if _, err := ImportVulnDB("ubuntu", FormatOSV, readVulnData(t, "osv.json")); err == nil {
+		t.Fatal("expected an import without advisories for this release to fail")
+	}
+	if _, err := ImportVulnDB("../x", "", nil); err == nil {
+		t.Fatal("expected an invalid name to be rejected")
+	}
+
+	dbs, err := ListVulnDBs()
+	if err != nil || len(dbs) != 1 || dbs[0].Name != "debian" || dbs[0].Count != 2 {
+		t.Fatalf("unexpected databases: %+v, %v", dbs, err)
+	}
+	if err := DeleteVulnDB("debian"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteVulnDB("debian"); !errors.Is(err, ErrVulnDBNotFound) {
+		t.Fatalf("expected ErrVulnDBNotFound, got %v", err)
+	}
+	if err := DeleteVulnDB("../x"); !errors.Is(err, ErrInvalidVulnDB) {
+		t.Fatalf("expected ErrInvalidVulnDB, got %v", err)
+	}
+}
+
+func TestOpenSyncedVulnDB(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "osv.json"), []byte("[]"), 0644)
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0600)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "escape"))
+	os.Symlink("osv.json", filepath.Join(dir, "latest"))
+
+	for _, name := range []string{"osv.json", "latest", "sub/../osv.json"} {
+		f, err := OpenSyncedVulnDB(dir, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		f.Close()
+	}
+	for _, name := range []string{"../" + filepath.Base(outside) + "/secret", filepath.Join(outside, "secret"), "escape", "sub", "missing"} {
+		if f, err := OpenSyncedVulnDB(dir, name); err == nil {
+			f.Close()
+			t.Errorf("expected %q to be refused", name)
+		}
+	}
+	if _, err := OpenSyncedVulnDB("", "osv.json"); err == nil {
+		t.Fatal("expected imports by path to need a sync directory")
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"orbit/internal/util"
+)
+
+const (
+	maxGraphDepth = 4
+	maxGraphNodes = 200
+)
+
+// Dependency properties followed when building a graph, in display order.
+var dependencyTypes = []string{"Requires", "Requisite", "BindsTo", "Wants", "PartOf", "After"}
+
+// GraphNode is a unit in a dependency graph.
+type GraphNode struct {
+	Unit   string `json:"unit"`
+	Load   string `json:"load"`
+	Active string `json:"active"`
+	Sub    string `json:"sub"`
+}
+
+// GraphEdge points from a unit to one of its dependencies.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+// DepGraph is the dependency graph reachable from one unit.
+type DepGraph struct {
+	Root      string      `json:"root"`
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Truncated bool        `json:"truncated"`
+}
+
+// BlameEntry is one line of `systemd-analyze blame`.
+type BlameEntry struct {
+	Unit   string  `json:"unit"`
+	TimeMs float64 `json:"timeMs"`
+}
+
+// ChainEntry is one line of `systemd-analyze critical-chain`. ActivatedMs is
+// when the unit became active, StartMs how long it took to start (0 if
+// systemd did not print it), and Depth the position in the tree.
+type ChainEntry struct {
+	Unit        string  `json:"unit"`
+	ActivatedMs float64 `json:"activatedMs"`
+	StartMs     float64 `json:"startMs"`
+	Depth       int     `json:"depth"`
+}
+
+// BootTime is the parsed `systemd-analyze time` summary. Stages not reported
+// on this machine (e.g. firmware in VMs) are 0.
+type BootTime struct {
+	FirmwareMs  float64 `json:"firmwareMs"`
+	LoaderMs    float64 `json:"loaderMs"`
+	KernelMs    float64 `json:"kernelMs"`
+	InitrdMs    float64 `json:"initrdMs"`
+	UserspaceMs float64 `json:"userspaceMs"`
+	TotalMs     float64 `json:"totalMs"`
+	Target      string  `json:"target"`
+	TargetMs    float64 `json:"targetMs"`
+}
+
+// Graph walks the dependencies of unit breadth-first up to depth levels.
+func Graph(unit string, depth int) (*DepGraph, error) {
+	if !isValidUnitName(unit) {
+		return nil, fmt.Errorf("invalid unit name: %s", unit)
+	}
+	if depth <= 0 || depth > maxGraphDepth {
+		depth = 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbusTimeout)
+	defer cancel()
+
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	root := withServiceSuffix(unit)
+	graph := &DepGraph{Root: root, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	seen := map[string]bool{root: true}
+	level := []string{root}
+
+	for d := 0; d <= depth && len(level) > 0; d++ {
+		var next []string
+		for _, name := range level {
+			props, err := conn.GetUnitPropertiesContext(ctx, name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read unit %s: %w", name, err)
+			}
+			graph.Nodes = append(graph.Nodes, GraphNode{
+				Unit:   name,
+				Load:   propString(props, "LoadState"),
+				Active: propString(props, "ActiveState"),
+				Sub:    propString(props, "SubState"),
+			})
+			if d == depth {
+				continue
+			}
+			for _, depType := range dependencyTypes {
+				for _, dep := range propStrings(props, depType) {
+					graph.Edges = append(graph.Edges, GraphEdge{From: name, To: dep, Type: depType})
+					if seen[dep] {
+						continue
+					}
+					if len(seen) >= maxGraphNodes {
+						graph.Truncated = true
+						continue
+					}
+					seen[dep] = true
+					next = append(next, dep)
+				}
+			}
+		}
+		level = next
+	}
+
+	// Drop edges to nodes left out by the node limit
+	graph.Edges = filterEdges(graph.Edges, seen)
+	return graph, nil
+}
+
+func filterEdges(edges []GraphEdge, keep map[string]bool) []GraphEdge {
+	out := edges[:0]
+	for _, e := range edges {
+		if keep[e.To] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Blame returns units ordered by the time they took to initialize during boot.
+func Blame() ([]BlameEntry, error) {
+	output, err := util.RunCommandNoSudo("systemd-analyze", "blame", "--no-pager")
+	if err != nil {
+		return nil, fmt.Errorf("systemd-analyze blame failed: %s", strings.TrimSpace(output))
+	}
+	return parseBlame(output), nil
+}
+
+// CriticalChain returns the time-critical chain of units leading to unit, or
+// to the default target when unit is empty.
+func CriticalChain(unit string) ([]ChainEntry, error) {
+	args := []string{"critical-chain", "--no-pager"}
+	if unit != "" {
+		if !isValidUnitName(unit) {
+			return nil, fmt.Errorf("invalid unit name: %s", unit)
+		}
+		args = append(args, unit)
+	}
+	output, err := util.RunCommandNoSudo("systemd-analyze", args...)
+	if err != nil {
+		return nil, fmt.Errorf("systemd-analyze critical-chain failed: %s", strings.TrimSpace(output))
+	}
+	return parseCriticalChain(output), nil
+}
+
+// GetBootTime returns the boot time split by stage.
+func GetBootTime() (*BootTime, error) {
+	output, err := util.RunCommandNoSudo("systemd-analyze", "time", "--no-pager")
+	if err != nil {
+		return nil, fmt.Errorf("systemd-analyze time failed: %s", strings.TrimSpace(output))
+	}
+	return parseBootTime(output), nil
+}
+
+func parseBlame(output string) []BlameEntry {
+	entries := []BlameEntry{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		unit := fields[len(fields)-1]
+		ms, ok := parseSystemdDuration(strings.Join(fields[:len(fields)-1], " "))
+		if !ok {
+			continue
+		}
+		entries = append(entries, BlameEntry{Unit: unit, TimeMs: ms})
+	}
+	return entries
+}
+
+var chainLine = regexp.MustCompile(`^(\S+) @([^+]+?)(?: \+(.+))?$`)
+
+func parseCriticalChain(output string) []ChainEntry {
+	entries := []ChainEntry{}
+	for _, line := range strings.Split(output, "\n") {
+		// Tree prefix: runs of spaces, "│" and "└─"; two columns per level
+		trimmed := strings.TrimLeft(line, " │└─")
+		if trimmed == "" {
+			continue
+		}
+		m := chainLine.FindStringSubmatch(strings.TrimSpace(trimmed))
+		if m == nil {
+			continue
+		}
+		activated, ok := parseSystemdDuration(m[2])
+		if !ok {
+			continue
+		}
+		entry := ChainEntry{
+			Unit:        m[1],
+			ActivatedMs: activated,
+			Depth:       len([]rune(line[:len(line)-len(trimmed)])) / 2,
+		}
+		if m[3] != "" {
+			entry.StartMs, _ = parseSystemdDuration(m[3])
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+var (
+	bootStage  = regexp.MustCompile(`([0-9][0-9a-z. ]*?) \((firmware|loader|kernel|initrd|userspace)\)`)
+	bootTotal  = regexp.MustCompile(`= ([0-9][0-9a-z. ]*?)\s*$`)
+	bootTarget = regexp.MustCompile(`^(\S+) reached after (.+) in userspace`)
+)
+
+func parseBootTime(output string) *BootTime {
+	bt := &BootTime{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Startup finished in") {
+			for _, m := range bootStage.FindAllStringSubmatch(line, -1) {
+				ms, _ := parseSystemdDuration(m[1])
+				switch m[2] {
+				case "firmware":
+					bt.FirmwareMs = ms
+				case "loader":
+					bt.LoaderMs = ms
+				case "kernel":
+					bt.KernelMs = ms
+				case "initrd":
+					bt.InitrdMs = ms
+				case "userspace":
+					bt.UserspaceMs = ms
+				}
+			}
+			if m := bootTotal.FindStringSubmatch(line); m != nil {
+				bt.TotalMs, _ = parseSystemdDuration(m[1])
+			}
+		} else if m := bootTarget.FindStringSubmatch(line); m != nil {
+			bt.Target = m[1]
+			bt.TargetMs, _ = parseSystemdDuration(m[2])
+		}
+	}
+	return bt
+}
+
+var durationPart = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(y|month|w|d|h|min|s|ms|us|µs)$`)
+
+// parseSystemdDuration parses systemd's human-readable timespans such as
+// "1min 2.345s" or "850ms" into milliseconds.
+func parseSystemdDuration(s string) (float64, bool) {
+	units := map[string]float64{
+		"us": 0.001, "µs": 0.001, "ms": 1, "s": 1000, "min": 60000,
+		"h": 3600000, "d": 86400000, "w": 604800000,
+		"month": 2629800000, "y": 31557600000,
+	}
+	parts := strings.Fields(s)
+	if len(parts) == 0 {
+		return 0, false
+	}
+	var total float64
+	for _, p := range parts {
+		m := durationPart.FindStringSubmatch(p)
+		if m == nil {
+			return 0, false
+		}
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		total += n * units[m[2]]
+	}
+	return total, true
+}
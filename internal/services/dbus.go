@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+)
+
+const dbusTimeout = 10 * time.Second
+
+// Errors returned by Detail and Cat for a name that is not a unit name or
+// that systemd does not know.
+var (
+	ErrInvalidUnit  = errors.New("invalid unit name")
+	ErrUnitNotFound = errors.New("unit not found")
+)
+
+// UnitDetail holds structured unit properties read from the systemd D-Bus API.
+type UnitDetail struct {
+	Unit                   string     `json:"unit"`
+	Description            string     `json:"description"`
+	Load                   string     `json:"load"`
+	Active                 string     `json:"active"`
+	Sub                    string     `json:"sub"`
+	MainPID                uint32     `json:"mainPid"`
+	MemoryCurrent          *uint64    `json:"memoryCurrent"`
+	CPUUsageNSec           *uint64    `json:"cpuUsageNSec"`
+	NRestarts              uint32     `json:"nRestarts"`
+	ActiveEnterTimestamp   *time.Time `json:"activeEnterTimestamp"`
+	ActiveExitTimestamp    *time.Time `json:"activeExitTimestamp"`
+	InactiveEnterTimestamp *time.Time `json:"inactiveEnterTimestamp"`
+	FragmentPath           string     `json:"fragmentPath"`
+	DropInPaths            []string   `json:"dropInPaths"`
+	UnitFileState          string     `json:"unitFileState"`
+	UnitFilePreset         string     `json:"unitFilePreset"`
+	Requires               []string   `json:"requires"`
+	Wants                  []string   `json:"wants"`
+	After                  []string   `json:"after"`
+}
+
+// connect opens a connection to the system manager over D-Bus. Read-only
+// queries need no privileges, so this does not go through sudo.
+func connect(ctx context.Context) (*sddbus.Conn, error) {
+	conn, err := sddbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	return conn, nil
+}
+
+// Detail returns the structured properties of a single unit. A name without
+// a unit type suffix is taken as a service.
+func Detail(unit string) (*UnitDetail, error) {
+	if !isValidUnitName(unit) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidUnit, unit)
+	}
+	unit = withServiceSuffix(unit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbusTimeout)
+	defer cancel()
+
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	props, err := conn.GetAllPropertiesContext(ctx, unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read unit %s: %w", unit, err)
+	}
+	if propString(props, "LoadState") == "not-found" {
+		return nil, fmt.Errorf("%w: %s", ErrUnitNotFound, unit)
+	}
+	return detailFromProperties(unit, props), nil
+}
+
+// detailFromProperties maps a D-Bus property set (all interfaces) onto UnitDetail.
+func detailFromProperties(unit string, props map[string]interface{}) *UnitDetail {
+	d := &UnitDetail{
+		Unit:                   unit,
+		Description:            propString(props, "Description"),
+		Load:                   propString(props, "LoadState"),
+		Active:                 propString(props, "ActiveState"),
+		Sub:                    propString(props, "SubState"),
+		MainPID:                propUint32(props, "MainPID"),
+		MemoryCurrent:          propCounter(props, "MemoryCurrent"),
+		CPUUsageNSec:           propCounter(props, "CPUUsageNSec"),
+		NRestarts:              propUint32(props, "NRestarts"),
+		ActiveEnterTimestamp:   propTimestamp(props, "ActiveEnterTimestamp"),
+		ActiveExitTimestamp:    propTimestamp(props, "ActiveExitTimestamp"),
+		InactiveEnterTimestamp: propTimestamp(props, "InactiveEnterTimestamp"),
+		FragmentPath:           propString(props, "FragmentPath"),
+		DropInPaths:            propStrings(props, "DropInPaths"),
+		UnitFileState:          propString(props, "UnitFileState"),
+		UnitFilePreset:         propString(props, "UnitFilePreset"),
+		Requires:               propStrings(props, "Requires"),
+		Wants:                  propStrings(props, "Wants"),
+		After:                  propStrings(props, "After"),
+	}
+	if id := propString(props, "Id"); id != "" {
+		d.Unit = id
+	}
+	return d
+}
+
+func propString(props map[string]interface{}, key string) string {
+	s, _ := props[key].(string)
+	return s
+}
+
+func propStrings(props map[string]interface{}, key string) []string {
+	if s, ok := props[key].([]string); ok {
+		return s
+	}
+	return []string{}
+}
+
+func propUint32(props map[string]interface{}, key string) uint32 {
+	n, _ := props[key].(uint32)
+	return n
+}
+
+// propCounter returns nil when accounting is disabled; systemd reports that
+// as the maximum uint64 value.
+func propCounter(props map[string]interface{}, key string) *uint64 {
+	n, ok := props[key].(uint64)
+	if !ok || n == math.MaxUint64 {
+		return nil
+	}
+	return &n
+}
+
+// propTimestamp converts a microsecond realtime timestamp; zero means never.
+func propTimestamp(props map[string]interface{}, key string) *time.Time {
+	usec, ok := props[key].(uint64)
+	if !ok || usec == 0 {
+		return nil
+	}
+	t := time.UnixMicro(int64(usec)).UTC()
+	return &t
+}
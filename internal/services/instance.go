@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+var killSignals = []string{"SIGTERM", "SIGKILL", "SIGHUP", "SIGINT", "SIGQUIT", "SIGUSR1", "SIGUSR2", "SIGSTOP", "SIGCONT"}
+
+// SplitInstance splits "foo@bar.service" into the template "foo@.service"
+// and the (still escaped) instance "bar". Non-instance units return "", "".
+func SplitInstance(unit string) (template, instance string) {
+	at := strings.Index(unit, "@")
+	dot := strings.LastIndex(unit, ".")
+	if at < 0 || dot < at {
+		return "", ""
+	}
+	return unit[:at+1] + unit[dot:], unit[at+1 : dot]
+}
+
+// InstanceName builds an instance unit name from a template such as
+// "foo@.service" and a raw instance string, escaping it as systemd-escape does.
+func InstanceName(template, instance string) (string, error) {
+	if !isValidUnitName(template) {
+		return "", fmt.Errorf("invalid unit name: %s", template)
+	}
+	at := strings.Index(template, "@")
+	dot := strings.LastIndex(template, ".")
+	if at < 0 || dot != at+1 {
+		return "", fmt.Errorf("not a template unit: %s", template)
+	}
+	if instance == "" {
+		return "", fmt.Errorf("instance name is required")
+	}
+	return template[:at+1] + EscapeInstance(instance) + template[dot:], nil
+}
+
+// EscapeInstance escapes a string for use as a unit instance name, following
+// the rules of `systemd-escape`: "/" becomes "-", and anything other than
+// ASCII alphanumerics, ":", "_" and "." (except a leading dot) becomes \xNN.
+func EscapeInstance(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == ':' || c == '_' || (c == '.' && i > 0):
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// validateRunnable rejects invalid names and bare templates ("foo@.service"),
+// which systemd cannot start, stop or reload without an instance.
+func validateRunnable(unit string) error {
+	// Validate unit name to prevent injection
+	if !isValidUnitName(unit) {
+		return fmt.Errorf("invalid unit name: %s", unit)
+	}
+	if strings.Contains(unit, "@.") || strings.HasSuffix(unit, "@") {
+		return fmt.Errorf("template unit %s needs an instance name", unit)
+	}
+	return nil
+}
+
+// killArgs validates kill parameters and returns the systemctl arguments.
+func killArgs(unit, signal, whom string) ([]string, error) {
+	if err := validateRunnable(unit); err != nil {
+		return nil, err
+	}
+	if signal == "" {
+		signal = "SIGTERM"
+	}
+	if !strings.HasPrefix(signal, "SIG") {
+		signal = "SIG" + signal
+	}
+	if !contains(killSignals, signal) {
+		return nil, fmt.Errorf("unsupported signal: %s", signal)
+	}
+	if whom == "" {
+		whom = "all"
+	}
+	if whom != "main" && whom != "control" && whom != "all" {
+		return nil, fmt.Errorf("invalid kill target: %s", whom)
+	}
+	return []string{"kill", "--signal=" + signal, "--kill-whom=" + whom, unit}, nil
+}
@@ -1,8 +1,9 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"sort"
 
 	"orbit/internal/util"
 )
@@ -13,56 +14,63 @@ type Service struct {
 	Active      string `json:"active"`
 	Sub         string `json:"sub"`
 	Description string `json:"description"`
+	Template    string `json:"template,omitempty"`
+	Instance    string `json:"instance,omitempty"`
 }
 
 func List() ([]Service, error) {
-	output, err := util.RunCommand("systemctl", "list-units", "--type=service", "--all", "--no-pager", "--plain", "--no-legend")
+	ctx, cancel := context.WithTimeout(context.Background(), dbusTimeout)
+	defer cancel()
+
+	conn, err := connect(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer conn.Close()
 
-	var services []Service
-	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
-		if line == "" {
-			continue
-		}
-		fields := strings.Fields(line)
-		if len(fields) >= 5 {
-			services = append(services, Service{
-				Unit:        fields[0],
-				Load:        fields[1],
-				Active:      fields[2],
-				Sub:         fields[3],
-				Description: strings.Join(fields[4:], " "),
-			})
+	units, err := conn.ListUnitsByPatternsContext(ctx, nil, []string{"*.service"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	services := make([]Service, 0, len(units))
+	for _, u := range units {
+		svc := Service{
+			Unit:        u.Name,
+			Load:        u.LoadState,
+			Active:      u.ActiveState,
+			Sub:         u.SubState,
+			Description: u.Description,
 		}
+		svc.Template, svc.Instance = SplitInstance(u.Name)
+		services = append(services, svc)
 	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Unit < services[j].Unit })
 	return services, nil
 }
 
 func Start(unit string) error {
-	// Validate unit name to prevent injection
-	if !isValidUnitName(unit) {
-		return fmt.Errorf("invalid unit name: %s", unit)
+	if err := validateRunnable(unit); err != nil {
+		return err
 	}
 	_, err := util.RunCommand("systemctl", "start", unit)
 	return err
 }
 
 func Stop(unit string) error {
-	// Validate unit name to prevent injection
-	if !isValidUnitName(unit) {
-		return fmt.Errorf("invalid unit name: %s", unit)
+	if err := validateRunnable(unit); err != nil {
+		return err
 	}
+	markExpected(unit)
 	_, err := util.RunCommand("systemctl", "stop", unit)
 	return err
 }
 
 func Restart(unit string) error {
-	// Validate unit name to prevent injection
-	if !isValidUnitName(unit) {
-		return fmt.Errorf("invalid unit name: %s", unit)
+	if err := validateRunnable(unit); err != nil {
+		return err
 	}
+	markExpected(unit)
 	_, err := util.RunCommand("systemctl", "restart", unit)
 	return err
 }
@@ -81,32 +89,64 @@ func Disable(unit string) error {
 	if !isValidUnitName(unit) {
 		return fmt.Errorf("invalid unit name: %s", unit)
 	}
+	markExpected(unit)
 	_, err := util.RunCommand("systemctl", "disable", unit)
 	return err
 }
 
-func GetStatus(unit string) (string, error) {
+func Mask(unit string) error {
 	// Validate unit name to prevent injection
 	if !isValidUnitName(unit) {
-		return "", fmt.Errorf("invalid unit name: %s", unit)
+		return fmt.Errorf("invalid unit name: %s", unit)
 	}
-	output, err := util.RunCommand("systemctl", "status", unit)
-	return output, err
+	markExpected(unit)
+	_, err := util.RunCommand("systemctl", "mask", unit)
+	return err
 }
 
-func GetLogs(unit string, lines int) (string, error) {
+func Unmask(unit string) error {
 	// Validate unit name to prevent injection
 	if !isValidUnitName(unit) {
-		return "", fmt.Errorf("invalid unit name: %s", unit)
+		return fmt.Errorf("invalid unit name: %s", unit)
 	}
-	
-	// BUG FIX: Proper int to string conversion
-	linesStr := "50"
-	if lines > 0 {
-		linesStr = fmt.Sprintf("%d", lines)
+	_, err := util.RunCommand("systemctl", "unmask", unit)
+	return err
+}
+
+func Reload(unit string) error {
+	if err := validateRunnable(unit); err != nil {
+		return err
+	}
+	_, err := util.RunCommand("systemctl", "reload", unit)
+	return err
+}
+
+func TryRestart(unit string) error {
+	if err := validateRunnable(unit); err != nil {
+		return err
+	}
+	_, err := util.RunCommand("systemctl", "try-restart", unit)
+	return err
+}
+
+func ResetFailed(unit string) error {
+	// Validate unit name to prevent injection
+	if !isValidUnitName(unit) {
+		return fmt.Errorf("invalid unit name: %s", unit)
 	}
-	output, err := util.RunCommand("journalctl", "-u", unit, "-n", linesStr, "--no-pager")
-	return output, err
+	_, err := util.RunCommand("systemctl", "reset-failed", unit)
+	return err
+}
+
+// Kill sends signal to the unit's processes. whom is "main", "control" or "all".
+func Kill(unit, signal, whom string) error {
+	args, err := killArgs(unit, signal, whom)
+	if err != nil {
+		return err
+	}
+	markExpected(unit)
+	_, err = util.RunCommand("systemctl", args...)
+	return err
 }
 
 // isValidUnitName validates systemd unit names to prevent command injection
@@ -114,12 +154,13 @@ func isValidUnitName(unit string) bool {
 	if unit == "" || len(unit) > 256 {
 		return false
 	}
-	// Allow alphanumeric, dash, underscore, dot, @, colon
+	// Allow alphanumeric, dash, underscore, dot, @, colon, and backslash for
+	// escaped template instances (e.g. foo@var-lib-x\x2dy.service)
 	// Typical systemd unit: service.name, service@instance.service
 	for _, c := range unit {
 		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || 
 			(c >= '0' && c <= '9') || c == '-' || c == '_' || 
-			c == '.' || c == '@' || c == ':') {
+			c == '.' || c == '@' || c == ':' || c == '\\') {
 			return false
 		}
 	}
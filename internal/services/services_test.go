@@ -0,0 +1,285 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetailFromProperties(t *testing.T) {
+	props := map[string]interface{}{
+		"Id":                   "nginx.service",
+		"LoadState":            "loaded",
+		"ActiveState":          "active",
+		"MainPID":              uint32(812),
+		"MemoryCurrent":        uint64(4096),
+		"CPUUsageNSec":         uint64(math.MaxUint64),
+		"NRestarts":            uint32(2),
+		"ActiveEnterTimestamp": uint64(1700000000000000),
+		"ActiveExitTimestamp":  uint64(0),
+		"Requires":             []string{"system.slice"},
+	}
+	d := detailFromProperties("nginx", props)
+	if d.Unit != "nginx.service" || d.MainPID != 812 || d.NRestarts != 2 {
+		t.Fatalf("unexpected detail: %+v", d)
+	}
+	if d.MemoryCurrent == nil || *d.MemoryCurrent != 4096 {
+		t.Fatal("expected memory accounting value")
+	}
+	if d.CPUUsageNSec != nil {
+		t.Fatal("expected disabled CPU accounting to be nil")
+	}
+	if d.ActiveEnterTimestamp == nil || d.ActiveEnterTimestamp.Unix() != 1700000000 {
+		t.Fatal("expected active enter timestamp")
+	}
+	if d.ActiveExitTimestamp != nil {
+		t.Fatal("expected zero timestamp to be nil")
+	}
+	if len(d.Requires) != 1 || d.Wants == nil {
+		t.Fatal("expected dependency lists")
+	}
+}
+
+func TestWithServiceSuffix(t *testing.T) {
+	cases := map[string]string{
+		"nginx":             "nginx.service",
+		"nginx.service":     "nginx.service",
+		"getty@tty1":        "getty@tty1.service",
+		"apt-daily.timer":   "apt-daily.timer",
+		"systemd-udevd.old": "systemd-udevd.old.service",
+	}
+	for in, want := range cases {
+		if got := withServiceSuffix(in); got != want {
+			t.Fatalf("withServiceSuffix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestServiceSpecRender(t *testing.T) {
+	spec := ServiceSpec{
+		Name:             "myapp",
+		Description:      "My app at 100% uptime",
+		ExecStart:        "/opt/myapp/bin/myapp --port 8080 --log-format %h",
+		WorkingDirectory: "/srv/%i",
+		User:             "myapp",
+		Environment:      map[string]string{"GREETING": `say "hi" 100%`},
+		NoNewPrivileges:  true,
+		ProtectSystem:    "strict",
+	}
+	unit, err := spec.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Description=My app at 100%% uptime\n",
+		"ExecStart=/opt/myapp/bin/myapp --port 8080 --log-format %%h\n",
+		"WorkingDirectory=/srv/%%i\n",
+		"User=myapp\n",
+		`Environment="GREETING=say \"hi\" 100%%"` + "\n",
+		"Restart=on-failure\n",
+		"NoNewPrivileges=yes\n",
+		"ProtectSystem=strict\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Fatalf("rendered unit missing %q:\n%s", want, unit)
+		}
+	}
+
+	invalid := []ServiceSpec{
+		{Name: "bad name", ExecStart: "/bin/true"},
+		{Name: "app", ExecStart: "relative/path"},
+		{Name: "app", ExecStart: "/bin/true\nExecStartPre=/bin/sh"},
+		{Name: "app", ExecStart: "/bin/true", Restart: "sometimes"},
+		{Name: "app", ExecStart: "/bin/true", Environment: map[string]string{"1X": "y"}},
+	}
+	for _, s := range invalid {
+		if _, err := s.Render(); err == nil {
+			t.Fatalf("expected error for %+v", s)
+		}
+	}
+}
+
+func TestTemplateInstances(t *testing.T) {
+	tmpl, inst := SplitInstance("getty@tty1.service")
+	if tmpl != "getty@.service" || inst != "tty1" {
+		t.Fatalf("unexpected split: %q %q", tmpl, inst)
+	}
+	if tmpl, inst := SplitInstance("nginx.service"); tmpl != "" || inst != "" {
+		t.Fatal("expected non-instance unit to have no template")
+	}
+
+	name, err := InstanceName("mount-backup@.service", "/var/lib/my-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != `mount-backup@-var-lib-my\x2ddata.service` {
+		t.Fatalf("unexpected instance name: %s", name)
+	}
+	if !isValidUnitName(name) {
+		t.Fatal("expected escaped instance name to be valid")
+	}
+	if _, err := InstanceName("nginx.service", "x"); err == nil {
+		t.Fatal("expected error for non-template unit")
+	}
+	if err := validateRunnable("getty@.service"); err == nil {
+		t.Fatal("expected bare template to be rejected")
+	}
+}
+
+func TestKillArgs(t *testing.T) {
+	args, err := killArgs("nginx.service", "HUP", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "kill --signal=SIGHUP --kill-whom=main nginx.service" {
+		t.Fatalf("unexpected args: %v", args)
+	}
+	if _, err := killArgs("nginx.service", "SIGSEGV", ""); err == nil {
+		t.Fatal("expected unsupported signal to fail")
+	}
+	if _, err := killArgs("nginx.service", "", "everyone"); err == nil {
+		t.Fatal("expected invalid target to fail")
+	}
+}
+
+func TestParseSystemdAnalyze(t *testing.T) {
+	blame := parseBlame("1min 2.500s apt-daily.service\n    850ms systemd-udevd.service\n 120us foo.mount\n")
+	if len(blame) != 3 || blame[0].Unit != "apt-daily.service" || blame[0].TimeMs != 62500 || blame[2].TimeMs != 0.12 {
+		t.Fatalf("unexpected blame: %+v", blame)
+	}
+
+	chain := parseCriticalChain(`The time when unit became active or started is printed after the "@" character.
+The time the unit took to start is printed after the "+" character.
+
+graphical.target @1min 30.020s
+└─multi-user.target @1min 30.020s
+  └─docker.service @1min 10.425s +19.593s
+    └─network-online.target @1min 10.422s
+`)
+	if len(chain) != 4 {
+		t.Fatalf("unexpected chain: %+v", chain)
+	}
+	if chain[2].Unit != "docker.service" || chain[2].Depth != 2 || chain[2].StartMs != 19593 || chain[2].ActivatedMs != 70425 {
+		t.Fatalf("unexpected chain entry: %+v", chain[2])
+	}
+
+	bt := parseBootTime("Startup finished in 2.153s (kernel) + 1min 5.002s (userspace) = 1min 7.155s \ngraphical.target reached after 1min 4.900s in userspace.\n")
+	if bt.KernelMs != 2153 || bt.UserspaceMs != 65002 || bt.TotalMs != 67155 || bt.Target != "graphical.target" || bt.TargetMs != 64900 {
+		t.Fatalf("unexpected boot time: %+v", bt)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	running := Service{Unit: "app.service", Active: "active", Sub: "running"}
+	failed := Service{Unit: "app.service", Active: "failed", Sub: "failed"}
+	restarting := Service{Unit: "app.service", Active: "activating", Sub: "auto-restart"}
+
+	if ev := transition(running, failed); ev == nil || ev.Kind != "failed" || ev.From != "active" {
+		t.Fatalf("expected failed event, got %+v", ev)
+	}
+	if ev := transition(running, restarting); ev == nil || ev.Kind != "auto-restart" {
+		t.Fatalf("expected auto-restart event, got %+v", ev)
+	}
+	if ev := transition(failed, failed); ev != nil {
+		t.Fatal("expected no event without a state change")
+	}
+
+	markExpected("app")
+	if !consumeExpected("app.service") || consumeExpected("app.service") {
+		t.Fatal("expected marker to be consumed once")
+	}
+}
+
+func TestDetailInvalidUnit(t *testing.T) {
+	if _, err := Detail("a;b"); !errors.Is(err, ErrInvalidUnit) {
+		t.Fatalf("expected ErrInvalidUnit, got %v", err)
+	}
+	if _, err := Cat("../nginx"); !errors.Is(err, ErrInvalidUnit) {
+		t.Fatalf("expected ErrInvalidUnit, got %v", err)
+	}
+}
+
+func TestCrashLoop(t *testing.T) {
+	start := time.Now()
+	var count int
+	for i := 0; i < crashLoopRestarts; i++ {
+		count = countRestart("loop.service", start.Add(time.Duration(i)*time.Minute))
+	}
+	ev := Event{Unit: "loop.service", Kind: "auto-restart", Critical: true, Restarts: count}
+	if !needsAlert(ev) {
+		t.Fatalf("expected %d restarts to alert", count)
+	}
+	if ev.Critical = false; needsAlert(ev) {
+		t.Fatal("expected no alert for a unit that is not critical")
+	}
+	// Older restarts fall out of the window
+	if n := countRestart("loop.service", start.Add(crashLoopWindow+2*time.Minute)); n != crashLoopRestarts-2 {
+		t.Fatalf("expected %d restarts within the window, got %d", crashLoopRestarts-2, n)
+	}
+	resetRestarts("loop.service")
+	if n := countRestart("loop.service", start); n != 1 {
+		t.Fatalf("expected the count to restart, got %d", n)
+	}
+}
+
+func TestEventsLogRotation(t *testing.T) {
+	oldPath, oldEvents := eventsLogPath, events
+	eventsLogPath = filepath.Join(t.TempDir(), "service-events.log")
+	t.Cleanup(func() { eventsLogPath, events = oldPath, oldEvents })
+
+	journal := []string{strings.Repeat("x", 64*1024)}
+	for i := 0; i < 40; i++ {
+		recordEvent(Event{Unit: fmt.Sprintf("app%d.service", i), Kind: "failed", Journal: journal})
+	}
+	info, err := os.Stat(eventsLogPath)
+	if err != nil || info.Size() >= maxEventsLogSize {
+		t.Fatalf("expected the log to be rotated: %v %v", info, err)
+	}
+	if _, err := os.Stat(eventsLogPath + ".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	events = nil
+	loadEvents()
+	if len(events) == 0 || len(events) >= 40 || events[len(events)-1].Unit != "app39.service" {
+		t.Fatalf("unexpected events after loading: %d", len(events))
+	}
+}
+
+func TestParseUnitList(t *testing.T) {
+	output := "dbus.service                    loaded    active   running D-Bus User Message Bus\n" +
+		"● gone.service                  not-found inactive dead    gone.service\n" +
+		"sync@docs.service               loaded    failed   failed  File sync for docs\n"
+	units := parseUnitList(output)
+	if len(units) != 3 {
+		t.Fatalf("unexpected units: %+v", units)
+	}
+	if u := units[0]; u.Unit != "dbus.service" || u.Load != "loaded" || u.Sub != "running" || u.Description != "D-Bus User Message Bus" {
+		t.Fatalf("unexpected unit: %+v", u)
+	}
+	if u := units[1]; u.Unit != "gone.service" || u.Load != "not-found" || u.Active != "inactive" {
+		t.Fatalf("unexpected unit: %+v", u)
+	}
+	if u := units[2]; u.Template != "sync@.service" || u.Instance != "docs" || u.Active != "failed" {
+		t.Fatalf("unexpected unit: %+v", u)
+	}
+}
+
+func TestScratchDropIns(t *testing.T) {
+	current := []UnitFile{
+		{Path: "/usr/lib/systemd/system/foo.service.d/override.conf", Content: "[Service]\nNice=5\n"},
+		{Path: "/etc/systemd/system/foo.service.d/limits.conf", Content: "[Service]\nLimitNOFILE=4096\n"},
+		{Path: "/run/systemd/system/foo.service.d/limits.conf", Content: "[Service]\nLimitNOFILE=1024\n"},
+		{Path: "/etc/systemd/system/foo.service.d/override.conf", Content: "[Service]\nNice=10\n"},
+	}
+	dropIns := scratchDropIns(current, "/etc/systemd/system/foo.service.d/override.conf", "[Service]\nNice=bogus\n")
+	if len(dropIns) != 2 || dropIns["override.conf"] != "[Service]\nNice=bogus\n" || dropIns["limits.conf"] != "[Service]\nLimitNOFILE=4096\n" {
+		t.Fatalf("unexpected drop-ins: %q", dropIns)
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ServiceSpec describes a simple long-running service to generate a unit for.
+type ServiceSpec struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	ExecStart        string            `json:"execStart"`
+	WorkingDirectory string            `json:"workingDirectory"`
+	User             string            `json:"user"`
+	Group            string            `json:"group"`
+	Environment      map[string]string `json:"environment"`
+	Restart          string            `json:"restart"`
+	RestartSec       int               `json:"restartSec"`
+
+	// Hardening options
+	NoNewPrivileges bool   `json:"noNewPrivileges"`
+	ProtectSystem   string `json:"protectSystem"`
+	ProtectHome     string `json:"protectHome"`
+	PrivateTmp      bool   `json:"privateTmp"`
+
+	Enable bool `json:"enable"`
+	Start  bool `json:"start"`
+}
+
+var (
+	restartPolicies = []string{"no", "always", "on-success", "on-failure", "on-abnormal", "on-abort", "on-watchdog"}
+	protectSystem   = []string{"true", "full", "strict"}
+	protectHome     = []string{"true", "read-only", "tmpfs"}
+)
+
+// CreateService renders spec into /etc/systemd/system/<name>.service, verifies
+// and installs it, reloads systemd and optionally enables and starts it.
+// Existing units are never overwritten.
+func CreateService(spec ServiceSpec) error {
+	content, err := spec.Render()
+	if err != nil {
+		return err
+	}
+	unit := spec.Name + ".service"
+	path := filepath.Join(systemUnitDir, unit)
+
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("unit %s already exists", unit)
+	}
+	if _, err := Detail(unit); err == nil {
+		return fmt.Errorf("unit %s already exists", unit)
+	}
+
+	if err := verifyUnit(unit, content, nil); err != nil {
+		return err
+	}
+	if err := installFile(content, path, "orbit-unit-"+unit); err != nil {
+		return err
+	}
+	if err := DaemonReload(); err != nil {
+		return err
+	}
+
+	if spec.Enable {
+		if err := Enable(unit); err != nil {
+			return fmt.Errorf("unit installed but enable failed: %w", err)
+		}
+	}
+	if spec.Start {
+		if err := Start(unit); err != nil {
+			return fmt.Errorf("unit installed but start failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Render validates the spec and returns the unit file content.
+func (s ServiceSpec) Render() (string, error) {
+	if !isValidDropInName(s.Name) {
+		return "", fmt.Errorf("invalid service name: %s", s.Name)
+	}
+	if s.ExecStart == "" || !strings.HasPrefix(s.ExecStart, "/") {
+		return "", fmt.Errorf("exec command must start with an absolute path")
+	}
+	for field, value := range map[string]string{
+		"description": s.Description, "exec command": s.ExecStart, "working directory": s.WorkingDirectory,
+	} {
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("%s must be a single line", field)
+		}
+	}
+	if s.WorkingDirectory != "" && !filepath.IsAbs(s.WorkingDirectory) {
+		return "", fmt.Errorf("working directory must be an absolute path")
+	}
+	if s.User != "" && !isValidAccountName(s.User) {
+		return "", fmt.Errorf("invalid user: %s", s.User)
+	}
+	if s.Group != "" && !isValidAccountName(s.Group) {
+		return "", fmt.Errorf("invalid group: %s", s.Group)
+	}
+	restart := s.Restart
+	if restart == "" {
+		restart = "on-failure"
+	}
+	if !contains(restartPolicies, restart) {
+		return "", fmt.Errorf("invalid restart policy: %s", restart)
+	}
+	if s.RestartSec < 0 {
+		return "", fmt.Errorf("invalid restart delay: %d", s.RestartSec)
+	}
+	if s.ProtectSystem != "" && !contains(protectSystem, s.ProtectSystem) {
+		return "", fmt.Errorf("invalid ProtectSystem value: %s", s.ProtectSystem)
+	}
+	if s.ProtectHome != "" && !contains(protectHome, s.ProtectHome) {
+		return "", fmt.Errorf("invalid ProtectHome value: %s", s.ProtectHome)
+	}
+
+	description := s.Description
+	if description == "" {
+		description = s.Name
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by Orbit\n")
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", escapeSpecifiers(description))
+	b.WriteString("After=network-online.target\nWants=network-online.target\n\n")
+
+	b.WriteString("[Service]\nType=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", escapeSpecifiers(s.ExecStart))
+	if s.WorkingDirectory != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", escapeSpecifiers(s.WorkingDirectory))
+	}
+	if s.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", s.User)
+	}
+	if s.Group != "" {
+		fmt.Fprintf(&b, "Group=%s\n", s.Group)
+	}
+
+	keys := make([]string, 0, len(s.Environment))
+	for k := range s.Environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := s.Environment[k]
+		if !isValidEnvName(k) {
+			return "", fmt.Errorf("invalid environment variable name: %s", k)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return "", fmt.Errorf("environment variable %s must be a single line", k)
+		}
+		fmt.Fprintf(&b, "Environment=\"%s=%s\"\n", k, escapeUnitValue(v))
+	}
+
+	fmt.Fprintf(&b, "Restart=%s\n", restart)
+	if s.RestartSec > 0 {
+		fmt.Fprintf(&b, "RestartSec=%d\n", s.RestartSec)
+	}
+	if s.NoNewPrivileges {
+		b.WriteString("NoNewPrivileges=yes\n")
+	}
+	if s.ProtectSystem != "" {
+		fmt.Fprintf(&b, "ProtectSystem=%s\n", s.ProtectSystem)
+	}
+	if s.ProtectHome != "" {
+		fmt.Fprintf(&b, "ProtectHome=%s\n", s.ProtectHome)
+	}
+	if s.PrivateTmp {
+		b.WriteString("PrivateTmp=yes\n")
+	}
+
+	b.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+	return b.String(), nil
+}
+
+// escapeUnitValue escapes a value for use inside a double-quoted unit setting.
+// Specifiers (%) are doubled so they are taken literally.
+func escapeUnitValue(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`)
+	return r.Replace(v)
+}
+
+// escapeSpecifiers doubles % in a free-text setting so systemd does not
+// expand it as a specifier, e.g. %h in a description.
+func escapeSpecifiers(v string) string {
+	return strings.ReplaceAll(v, "%", "%%")
+}
+
+func isValidEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidAccountName accepts user and group names as shadow-utils does by default.
+func isValidAccountName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	if !((name[0] >= 'a' && name[0] <= 'z') || name[0] == '_') {
+		return false
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"orbit/internal/util"
+)
+
+const systemUnitDir = "/etc/systemd/system"
+
+// UnitFile is one file contributing to a unit's effective configuration.
+type UnitFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// UnitFiles is the effective configuration of a unit, like `systemctl cat`.
+type UnitFiles struct {
+	Unit     string     `json:"unit"`
+	Fragment UnitFile   `json:"fragment"`
+	DropIns  []UnitFile `json:"dropIns"`
+	// Vendor is true when the fragment lives outside /etc, i.e. it ships with a package.
+	Vendor bool `json:"vendor"`
+}
+
+// Cat returns the unit fragment and its drop-ins in the order systemd applies them.
+func Cat(unit string) (*UnitFiles, error) {
+	detail, err := Detail(unit)
+	if err != nil {
+		return nil, err
+	}
+	if detail.FragmentPath == "" {
+		return nil, fmt.Errorf("unit %s has no unit file", detail.Unit)
+	}
+
+	fragment, err := os.ReadFile(detail.FragmentPath)
+	if err != nil {
+		return nil, err
+	}
+	files := &UnitFiles{
+		Unit:     detail.Unit,
+		Fragment: UnitFile{Path: detail.FragmentPath, Content: string(fragment)},
+		DropIns:  []UnitFile{},
+		Vendor:   !strings.HasPrefix(detail.FragmentPath, "/etc/"),
+	}
+	for _, path := range detail.DropInPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		files.DropIns = append(files.DropIns, UnitFile{Path: path, Content: string(data)})
+	}
+	return files, nil
+}
+
+// WriteDropIn creates or replaces /etc/systemd/system/<unit>.d/<name>.conf.
+// The resulting unit is checked with systemd-analyze verify before the file
+// is installed, and systemd is reloaded afterwards.
+func WriteDropIn(unit, name, content string) error {
+	if !isValidUnitName(unit) {
+		return fmt.Errorf("invalid unit name: %s", unit)
+	}
+	if !isValidDropInName(name) {
+		return fmt.Errorf("invalid drop-in name: %s", name)
+	}
+
+	current, err := Cat(unit)
+	if err != nil {
+		return err
+	}
+	target := dropInPath(current.Unit, name)
+
+	// Rebuild the unit in a scratch directory, replacing the edited drop-in
+	dropIns := scratchDropIns(current.DropIns, target, content)
+	if err := verifyUnit(current.Unit, current.Fragment.Content, dropIns); err != nil {
+		return err
+	}
+
+	if err := installFile(content, target, fmt.Sprintf("orbit-dropin-%s-%s", current.Unit, name)); err != nil {
+		return err
+	}
+	return DaemonReload()
+}
+
+// DeleteDropIn removes a drop-in created under /etc/systemd/system/<unit>.d.
+func DeleteDropIn(unit, name string) error {
+	if !isValidUnitName(unit) {
+		return fmt.Errorf("invalid unit name: %s", unit)
+	}
+	if !isValidDropInName(name) {
+		return fmt.Errorf("invalid drop-in name: %s", name)
+	}
+	unit = withServiceSuffix(unit)
+	if _, err := util.RunCommand("rm", "-f", dropInPath(unit, name)); err != nil {
+		return fmt.Errorf("failed to remove drop-in: %w", err)
+	}
+	// Leave no empty <unit>.d directory behind; rmdir fails harmlessly if not empty
+	util.RunCommand("rmdir", filepath.Join(systemUnitDir, unit+".d"))
+	return DaemonReload()
+}
+
+// Revert drops all local overrides of a unit and returns it to the vendor version.
+func Revert(unit string) error {
+	if !isValidUnitName(unit) {
+		return fmt.Errorf("invalid unit name: %s", unit)
+	}
+	if output, err := util.RunCommand("systemctl", "revert", unit); err != nil {
+		return fmt.Errorf("failed to revert %s: %s", unit, strings.TrimSpace(output))
+	}
+	return DaemonReload()
+}
+
+// DaemonReload makes systemd re-read all unit files.
+func DaemonReload() error {
+	if output, err := util.RunCommand("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("daemon-reload failed: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// scratchDropIns returns the drop-ins by file name as systemd would apply
+// them once content is written to target. A drop-in in /etc hides one of the
+// same name in /run, which hides one in /usr/lib or /lib; target is in /etc,
+// so it replaces every drop-in named like it.
+func scratchDropIns(current []UnitFile, target, content string) map[string]string {
+	name := filepath.Base(target)
+	dropIns := make(map[string]string)
+	paths := make(map[string]string)
+	for _, d := range current {
+		base := filepath.Base(d.Path)
+		if base == name {
+			continue
+		}
+		if prev, ok := paths[base]; ok && dropInPriority(prev) >= dropInPriority(d.Path) {
+			continue
+		}
+		paths[base] = d.Path
+		dropIns[base] = d.Content
+	}
+	dropIns[name] = content
+	return dropIns
+}
+
+func dropInPriority(path string) int {
+	switch {
+	case strings.HasPrefix(path, "/etc/"):
+		return 2
+	case strings.HasPrefix(path, "/run/"):
+		return 1
+	}
+	return 0
+}
+
+// verifyUnit lays out a unit and its drop-ins, keyed by file name, in a temp
+// directory and runs systemd-analyze verify on it. verify searches the unit's
+// own directory first, so the drop-ins there take effect.
+func verifyUnit(unit, fragment string, dropIns map[string]string) error {
+	tmpDir, err := os.MkdirTemp("/tmp", "orbit-unit-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	unitPath := filepath.Join(tmpDir, unit)
+	if err := os.WriteFile(unitPath, []byte(fragment), 0644); err != nil {
+		return fmt.Errorf("failed to write temp unit: %w", err)
+	}
+	if len(dropIns) > 0 {
+		dir := filepath.Join(tmpDir, unit+".d")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create temp drop-in dir: %w", err)
+		}
+		for name, content := range dropIns {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				return fmt.Errorf("failed to write temp drop-in: %w", err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbusTimeout)
+	defer cancel()
+	output, err := util.CommandContext(ctx, "systemd-analyze", "verify", unitPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unit verification failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// installFile writes content to a temp file and moves it into place with
+// mode 0644, creating parent directories as needed. tmpName prefixes the
+// randomly named temp file.
+func installFile(content, dest, tmpName string) error {
+	tmp, err := os.CreateTemp("", tmpName+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(content)
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if output, err := util.RunCommand("install", "-D", "-m", "0644", tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to install %s: %s", dest, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// withServiceSuffix completes a bare name like "nginx" the way systemctl does.
+func withServiceSuffix(unit string) string {
+	for _, suffix := range []string{".service", ".socket", ".timer", ".target", ".mount", ".path", ".slice", ".scope", ".device", ".swap", ".automount"} {
+		if strings.HasSuffix(unit, suffix) {
+			return unit
+		}
+	}
+	return unit + ".service"
+}
+
+func dropInPath(unit, name string) string {
+	return filepath.Join(systemUnitDir, unit+".d", name+".conf")
+}
+
+// isValidDropInName accepts a drop-in base name without the .conf suffix.
+func isValidDropInName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9') || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"orbit/internal/util"
+)
+
+// Actions that can be run against a login user's service manager.
+var userActions = []string{"start", "stop", "restart", "reload", "try-restart", "enable", "disable", "mask", "unmask", "reset-failed"}
+
+// userSystemctl runs systemctl against the per-user manager of a login user
+// (systemctl --user --machine=<user>@). The user's manager must be running,
+// i.e. the user is logged in or has lingering enabled.
+func userSystemctl(user string, args ...string) (string, error) {
+	if !isValidAccountName(user) {
+		return "", fmt.Errorf("invalid user: %s", user)
+	}
+	fullArgs := append([]string{"--user", "--machine=" + user + "@"}, args...)
+	output, err := util.RunCommand("systemctl", fullArgs...)
+	if err != nil {
+		return output, fmt.Errorf("systemctl --user failed for %s: %s", user, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// UserList returns the service units of a login user's manager.
+func UserList(user string) ([]Service, error) {
+	// --output=json needs systemd 246; the plain table works everywhere
+	output, err := userSystemctl(user, "list-units", "--type=service", "--all", "--no-pager", "--plain", "--no-legend", "--full")
+	if err != nil {
+		return nil, err
+	}
+	services := parseUnitList(output)
+	sort.Slice(services, func(i, j int) bool { return services[i].Unit < services[j].Unit })
+	return services, nil
+}
+
+// parseUnitList reads `systemctl list-units --plain --no-legend`:
+//
+//	dbus.service      loaded    active   running D-Bus User Message Bus
+//	● gone.service    not-found inactive dead    gone.service
+func parseUnitList(output string) []Service {
+	services := []Service{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		// Older releases mark failed and missing units even with --plain
+		if len(fields) > 0 && (fields[0] == "●" || fields[0] == "*") {
+			fields = fields[1:]
+		}
+		if len(fields) < 4 {
+			continue
+		}
+		svc := Service{
+			Unit:        fields[0],
+			Load:        fields[1],
+			Active:      fields[2],
+			Sub:         fields[3],
+			Description: strings.Join(fields[4:], " "),
+		}
+		svc.Template, svc.Instance = SplitInstance(svc.Unit)
+		services = append(services, svc)
+	}
+	return services
+}
+
+// UserAction runs a unit action such as "start" or "mask" in a login user's manager.
+func UserAction(user, action, unit string) error {
+	if !contains(userActions, action) {
+		return fmt.Errorf("unsupported action: %s", action)
+	}
+	switch action {
+	case "start", "stop", "restart", "reload", "try-restart":
+		if err := validateRunnable(unit); err != nil {
+			return err
+		}
+	default:
+		if !isValidUnitName(unit) {
+			return fmt.Errorf("invalid unit name: %s", unit)
+		}
+	}
+	_, err := userSystemctl(user, action, unit)
+	return err
+}
+
+// UserKill sends a signal to a unit in a login user's manager.
+func UserKill(user, unit, signal, whom string) error {
+	args, err := killArgs(unit, signal, whom)
+	if err != nil {
+		return err
+	}
+	_, err = userSystemctl(user, args...)
+	return err
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"orbit/internal/journal"
+)
+
+const (
+	maxEvents      = 500
+	pollInterval   = 5 * time.Second
+	journalContext = 20
+	// A failure within this window after a stop, restart, kill, disable or
+	// mask issued through Orbit is considered expected and does not raise an
+	// alert.
+	expectedWindow = 30 * time.Second
+	// The events log is rotated to a single .1 file beyond this size.
+	maxEventsLogSize = 1 << 20
+	// A critical unit restarted automatically this often within the window
+	// is alerted on as a crash loop.
+	crashLoopRestarts = 5
+	crashLoopWindow   = 10 * time.Minute
+)
+
+// eventsLogPath keeps the events across restarts of Orbit; tests replace it.
+var eventsLogPath = "/var/log/orbit/service-events.log"
+
+// Event records a unit entering the failed state or being auto-restarted.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Unit     string    `json:"unit"`
+	Kind     string    `json:"kind"` // "failed" or "auto-restart"
+	From     string    `json:"from"`
+	Sub      string    `json:"sub"`
+	Critical bool      `json:"critical"`
+	Restarts int       `json:"restarts,omitempty"` // auto-restarts within crashLoopWindow
+	Expected bool      `json:"expected"`
+	Journal  []string  `json:"journal"`
+}
+
+// WatcherConfig controls the failed-unit watcher.
+type WatcherConfig struct {
+	CriticalUnits []string
+	AlertWebhook  string
+}
+
+var (
+	eventsMu sync.Mutex
+	events   []Event
+
+	expectedMu sync.Mutex
+	expected   = make(map[string]time.Time)
+
+	restartsMu sync.Mutex
+	restarts   = make(map[string][]time.Time)
+)
+
+// StartWatcher polls systemd for unit state changes in the background and
+// records failures and automatic restarts.
+func StartWatcher(cfg WatcherConfig) {
+	loadEvents()
+
+	critical := make(map[string]bool)
+	for _, u := range cfg.CriticalUnits {
+		critical[withServiceSuffix(u)] = true
+	}
+
+	go func() {
+		var last map[string]Service
+		for {
+			current, err := List()
+			if err != nil {
+				log.Printf("service watcher: %v", err)
+				time.Sleep(pollInterval * 6)
+				continue
+			}
+
+			states := make(map[string]Service, len(current))
+			for _, svc := range current {
+				states[svc.Unit] = svc
+			}
+			if last != nil {
+				for unit, svc := range states {
+					prev, ok := last[unit]
+					if !ok {
+						continue
+					}
+					if ev := transition(prev, svc); ev != nil {
+						ev.Critical = critical[unit]
+						ev.Expected = consumeExpected(unit)
+						if ev.Kind == "auto-restart" && !ev.Expected {
+							ev.Restarts = countRestart(unit, ev.Time)
+						}
+						ev.Journal = recentJournal(unit)
+						recordEvent(*ev)
+						if needsAlert(*ev) {
+							if ev.Kind == "auto-restart" {
+								resetRestarts(unit)
+							}
+							go sendAlert(cfg.AlertWebhook, *ev)
+						}
+					}
+				}
+			}
+			last = states
+			time.Sleep(pollInterval)
+		}
+	}()
+}
+
+// Events returns recorded events, newest first, optionally for one unit.
+func Events(unit string, limit int) []Event {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	if unit != "" {
+		unit = withServiceSuffix(unit)
+	}
+	out := []Event{}
+	for i := len(events) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if unit == "" || events[i].Unit == unit {
+			out = append(out, events[i])
+		}
+	}
+	return out
+}
+
+// transition returns an event when a unit moved into the failed state or
+// into auto-restart since the previous poll.
+func transition(prev, cur Service) *Event {
+	switch {
+	case cur.Active == "failed" && prev.Active != "failed":
+		return &Event{Time: time.Now().UTC(), Unit: cur.Unit, Kind: "failed", From: prev.Active, Sub: cur.Sub}
+	case cur.Sub == "auto-restart" && prev.Sub != "auto-restart":
+		return &Event{Time: time.Now().UTC(), Unit: cur.Unit, Kind: "auto-restart", From: prev.Active, Sub: cur.Sub}
+	}
+	return nil
+}
+
+// needsAlert reports whether an event is an unexpected failure or a crash
+// loop of a critical unit.
+func needsAlert(ev Event) bool {
+	if !ev.Critical || ev.Expected {
+		return false
+	}
+	return ev.Kind == "failed" || ev.Kind == "auto-restart" && ev.Restarts >= crashLoopRestarts
+}
+
+// countRestart records an automatic restart of unit and returns the number
+// of restarts within crashLoopWindow.
+func countRestart(unit string, at time.Time) int {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+	kept := []time.Time{}
+	for _, t := range restarts[unit] {
+		if at.Sub(t) < crashLoopWindow {
+			kept = append(kept, t)
+		}
+	}
+	restarts[unit] = append(kept, at)
+	return len(restarts[unit])
+}
+
+// resetRestarts starts counting anew after a crash loop was alerted on.
+func resetRestarts(unit string) {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+	delete(restarts, unit)
+}
+
+// markExpected notes that Orbit itself is about to stop, restart, signal,
+// disable or mask a unit.
+func markExpected(unit string) {
+	expectedMu.Lock()
+	defer expectedMu.Unlock()
+	expected[withServiceSuffix(unit)] = time.Now()
+}
+
+func consumeExpected(unit string) bool {
+	expectedMu.Lock()
+	defer expectedMu.Unlock()
+	t, ok := expected[unit]
+	delete(expected, unit)
+	return ok && time.Since(t) < expectedWindow
+}
+
+func recentJournal(unit string) []string {
+	page, err := journal.Search(journal.Query{Unit: unit, Limit: journalContext})
+	if err != nil {
+		return []string{}
+	}
+	lines := make([]string, 0, len(page.Entries))
+	// Entries come newest first; keep them in log order
+	for i := len(page.Entries) - 1; i >= 0; i-- {
+		e := page.Entries[i]
+		lines = append(lines, fmt.Sprintf("%s %s", e.Time.Format(time.RFC3339), e.Message))
+	}
+	return lines
+}
+
+func recordEvent(ev Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	events = append(events, ev)
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(eventsLogPath), 0750); err != nil {
+		return
+	}
+	if info, err := os.Stat(eventsLogPath); err == nil && info.Size()+int64(len(data)) >= maxEventsLogSize {
+		os.Rename(eventsLogPath, eventsLogPath+".1")
+	}
+	f, err := os.OpenFile(eventsLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s\n", data)
+}
+
+// loadEvents restores the most recent events from the events log and the
+// rotated one before it.
+func loadEvents() {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	for _, path := range []string{eventsLogPath + ".1", eventsLogPath} {
+		data := readLogTail(path, maxEventsLogSize)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var ev Event
+			if err := json.Unmarshal(scanner.Bytes(), &ev); err == nil {
+				events = append(events, ev)
+			}
+		}
+	}
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+}
+
+// readLogTail returns at most the last limit bytes of a log, starting at a
+// line boundary, so a log written before rotation existed is not read whole.
+func readLogTail(path string, limit int64) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	offset := info.Size() - limit
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil
+	}
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		} else {
+			data = nil
+		}
+	}
+	return data
+}
+
+// sendAlert logs the failure or crash loop and posts it to the configured webhook, if any.
+func sendAlert(webhook string, ev Event) {
+	text := fmt.Sprintf("critical unit %s failed", ev.Unit)
+	if ev.Kind == "auto-restart" {
+		text = fmt.Sprintf("critical unit %s restarted %d times within %s", ev.Unit, ev.Restarts, crashLoopWindow)
+	}
+	log.Printf("ALERT: %s (was %s)", text, ev.From)
+	if webhook == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"text":  "Orbit: " + text,
+		"event": ev,
+	})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("alert webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("alert webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,211 @@
+package users
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Group is a local group. Members are the users listed in /etc/group, which
+// have it as a supplementary group; PrimaryMembers are the users whose
+// primary group it is.
+type Group struct {
+	Name           string   `json:"name"`
+	GID            string   `json:"gid"`
+	Members        []string `json:"members"`
+	PrimaryMembers []string `json:"primaryMembers"`
+}
+
+// ListGroups returns the local groups sorted by GID.
+func ListGroups() ([]Group, error) {
+	output, err := query("getent", "group")
+	if err != nil {
+		return nil, err
+	}
+	groups := parseGroups(output)
+
+	if passwd, err := query("getent", "passwd"); err == nil {
+		byGID := make(map[string]*Group)
+		for i := range groups {
+			byGID[groups[i].GID] = &groups[i]
+		}
+		for _, line := range strings.Split(passwd, "\n") {
+			parts := strings.Split(line, ":")
+			if len(parts) >= 4 {
+				if g, ok := byGID[parts[3]]; ok {
+					g.PrimaryMembers = append(g.PrimaryMembers, parts[0])
+				}
+			}
+		}
+	}
+	return groups, nil
+}
+
+// parseGroups reads `getent group` lines (name:password:gid:member,member).
+func parseGroups(output string) []Group {
+	groups := []Group{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.Split(line, ":")
+		if len(parts) < 4 {
+			continue
+		}
+		g := Group{Name: parts[0], GID: parts[2], Members: []string{}, PrimaryMembers: []string{}}
+		for _, member := range strings.Split(parts[3], ",") {
+			if member != "" {
+				g.Members = append(g.Members, member)
+			}
+		}
+		groups = append(groups, g)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, _ := strconv.Atoi(groups[i].GID)
+		b, _ := strconv.Atoi(groups[j].GID)
+		return a < b
+	})
+	return groups
+}
+
+// supplementaryGroups returns the groups that list username as a member.
+func supplementaryGroups(groups []Group, username string) []string {
+	names := []string{}
+	for _, g := range groups {
+		for _, member := range g.Members {
+			if member == username {
+				names = append(names, g.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// CreateGroup adds a group. A gid of -1 lets groupadd pick the next free one;
+// system groups are allocated from the system GID range.
+func CreateGroup(name string, gid int, system bool) error {
+	if !isValidGroupName(name) {
+		return fmt.Errorf("invalid group name: %s", name)
+	}
+	args := []string{}
+	if gid >= 0 {
+		if owner, err := query("getent", "group", strconv.Itoa(gid)); err == nil && owner != "" {
+			return fmt.Errorf("GID %d is already used by %s", gid, strings.SplitN(owner, ":", 2)[0])
+		}
+		args = append(args, "-g", strconv.Itoa(gid))
+	}
+	if system {
+		args = append(args, "-r")
+	}
+
+	output, err := run("groupadd", append(args, name)...)
+	if err != nil {
+		return fmt.Errorf("failed to create group %s: %s", name, commandError(output, err))
+	}
+	return nil
+}
+
+// DeleteGroup removes a group. groupdel refuses to remove a user's primary
+// group.
+func DeleteGroup(name string) error {
+	if !isValidGroupName(name) {
+		return fmt.Errorf("invalid group name: %s", name)
+	}
+	output, err := run("groupdel", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete group %s: %s", name, commandError(output, err))
+	}
+	return nil
+}
+
+// RenameGroup changes a group's name, keeping its GID and members.
+func RenameGroup(name, newName string) error {
+	if !isValidGroupName(name) {
+		return fmt.Errorf("invalid group name: %s", name)
+	}
+	if !isValidGroupName(newName) {
+		return fmt.Errorf("invalid group name: %s", newName)
+	}
+	output, err := run("groupmod", "-n", newName, name)
+	if err != nil {
+		return fmt.Errorf("failed to rename group %s: %s", name, commandError(output, err))
+	}
+	return nil
+}
+
+// AddMember adds a user to a group as a supplementary member.
+func AddMember(group, username string) error {
+	return gpasswd("-a", group, username)
+}
+
+// RemoveMember removes a user from a group's supplementary members.
+func RemoveMember(group, username string) error {
+	return gpasswd("-d", group, username)
+}
+
+func gpasswd(flag, group, username string) error {
+	if !isValidGroupName(group) {
+		return fmt.Errorf("invalid group name: %s", group)
+	}
+	if !isValidUsername(username) {
+		return fmt.Errorf("invalid username: %s", username)
+	}
+	output, err := run("gpasswd", flag, username, group)
+	if err != nil {
+		return fmt.Errorf("failed to update group %s: %s", group, commandError(output, err))
+	}
+	return nil
+}
+
+// SetUserGroups changes a user's primary group, when primary is set, and
+// replaces its supplementary groups, when groups is not nil. An empty groups
+// list removes the user from all supplementary groups.
+func SetUserGroups(username, primary string, groups []string) error {
+	if !isValidUsername(username) {
+		return fmt.Errorf("invalid username: %s", username)
+	}
+	var args []string
+	if primary != "" {
+		if !isValidGroupName(primary) {
+			return fmt.Errorf("invalid group name: %s", primary)
+		}
+		args = append(args, "-g", primary)
+	}
+	if groups != nil {
+		if err := validateGroupNames(groups); err != nil {
+			return err
+		}
+		args = append(args, "-G", strings.Join(groups, ","))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	output, err := run("usermod", append(args, username)...)
+	if err != nil {
+		return fmt.Errorf("failed to set groups of %s: %s", username, commandError(output, err))
+	}
+	return nil
+}
+
+// isValidGroupName checks group names, which follow the same rules as user
+// names.
+func isValidGroupName(name string) bool {
+	return isValidUsername(name)
+}
+
+func validateGroupNames(groups []string) error {
+	for _, g := range groups {
+		if !isValidGroupName(g) {
+			return fmt.Errorf("invalid group name: %s", g)
+		}
+	}
+	return nil
+}
+
+// commandError prefers the tool's own message over the exit status.
+func commandError(output string, err error) string {
+	if msg := strings.TrimSpace(output); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
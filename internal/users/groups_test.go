@@ -0,0 +1,91 @@
+package users
+
+import (
+	"strings"
+	"testing"
+)
+
+const getentGroup = `root:x:0:
+sudo:x:27:alice,bob
+docker:x:998:alice
+alice:x:1000:
+bob:x:1001:
+`
+
+const getentPasswd = `root:x:0:0:root:/root:/bin/bash
+alice:x:1000:1000:Alice:/home/alice:/bin/bash
+bob:x:1001:27::/home/bob:/bin/sh
+`
+
+// stub replaces the command runners for a test and records the commands run.
+// /etc/shells and /etc/login.defs are read from testdata.
+func stub(t *testing.T, outputs map[string]string) *[]string {
+	var calls []string
+	fn := func(command string, args ...string) (string, error) {
+		cmdline := strings.Join(append([]string{command}, args...), " ")
+		calls = append(calls, cmdline)
+		return outputs[cmdline], nil
+	}
+	oldRun, oldQuery, oldShells, oldLoginDefs := run, query, shellsPath, loginDefsPath
+	run, query = fn, fn
+	shellsPath, loginDefsPath = "testdata/shells", "testdata/login.defs"
+	t.Cleanup(func() { run, query, shellsPath, loginDefsPath = oldRun, oldQuery, oldShells, oldLoginDefs })
+	return &calls
+}
+
+func TestListGroups(t *testing.T) {
+	stub(t, map[string]string{"getent group": getentGroup, "getent passwd": getentPasswd})
+
+	groups, err := ListGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 5 || groups[1].Name != "sudo" || strings.Join(groups[1].Members, ",") != "alice,bob" {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+	if strings.Join(groups[1].PrimaryMembers, ",") != "bob" || len(groups[2].PrimaryMembers) != 0 {
+		t.Fatalf("unexpected primary members: %+v", groups)
+	}
+	if got := strings.Join(supplementaryGroups(groups, "alice"), ","); got != "sudo,docker" {
+		t.Fatalf("supplementary groups of alice = %s", got)
+	}
+}
+
+func TestGroupCommands(t *testing.T) {
+	calls := stub(t, map[string]string{"getent group 27": "sudo:x:27:alice,bob\n"})
+
+	if err := CreateGroup("deploy", 2000, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateGroup("backup", 27, true); err == nil || !strings.Contains(err.Error(), "used by sudo") {
+		t.Fatalf("expected a GID conflict, got %v", err)
+	}
+	if err := Create("carol", "", CreateOptions{PrimaryGroup: "deploy", Groups: []string{"sudo", "docker"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUserGroups("carol", "", []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddMember("docker", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameGroup("deploy", "deployers"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"getent group 2000",
+		"groupadd -g 2000 deploy",
+		"getent group 27",
+		"useradd -m -s /bin/bash -g deploy -G sudo,docker carol",
+		"usermod -G  carol",
+		"gpasswd -a bob docker",
+		"groupmod -n deployers deploy",
+	}
+	if strings.Join(*calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected commands:\n%s", strings.Join(*calls, "\n"))
+	}
+	if SetUserGroups("carol", "", []string{"wheel;rm"}) == nil || RenameGroup("deploy", "Deploy") == nil {
+		t.Fatal("expected invalid group names to be rejected")
+	}
+}
@@ -0,0 +1,296 @@
+package users
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// shellsPath lists the valid login shells; loginDefsPath sets the UID range
+// of human users.
+var (
+	shellsPath    = "/etc/shells"
+	loginDefsPath = "/etc/login.defs"
+)
+
+// nologinShells disable interactive logins. Distributions do not always list
+// them in /etc/shells, but they are valid shells to assign.
+var nologinShells = []string{"/usr/sbin/nologin", "/sbin/nologin", "/bin/false", "/usr/bin/false"}
+
+const (
+	maxID   = 4294967294 // (uid_t)-1 is reserved
+	maxDays = 99999
+)
+
+// Aging is a user's password aging policy from /etc/shadow. Day counts of -1
+// are unset. MustChange means the password has to be changed at next login.
+type Aging struct {
+	LastChanged  string `json:"lastChanged,omitempty"`
+	MinDays      int    `json:"minDays"`
+	MaxDays      int    `json:"maxDays"`
+	WarnDays     int    `json:"warnDays"`
+	InactiveDays int    `json:"inactiveDays"`
+	MustChange   bool   `json:"mustChange"`
+}
+
+// Update is a partial change to a user; nil fields are left as they are.
+// Expires is a YYYY-MM-DD date, or empty to never expire. The aging day
+// counts take -1 to remove the limit. GID sets the primary group.
+type Update struct {
+	Shell        *string `json:"shell"`
+	Comment      *string `json:"comment"`
+	Home         *string `json:"home"`
+	MoveHome     bool    `json:"moveHome"`
+	UID          *int    `json:"uid"`
+	GID          *int    `json:"gid"`
+	Expires      *string `json:"expires"`
+	MinDays      *int    `json:"minDays"`
+	MaxDays      *int    `json:"maxDays"`
+	WarnDays     *int    `json:"warnDays"`
+	InactiveDays *int    `json:"inactiveDays"`
+	Password     *string `json:"password"`
+	MustChange   bool    `json:"mustChange"`
+}
+
+// Modify applies an update with usermod, then resets the password, then
+// applies expiry and aging with chage, so MustChange also covers a password
+// just set.
+func Modify(username string, u Update) error {
+	if !isValidUsername(username) {
+		return fmt.Errorf("invalid username: %s", username)
+	}
+	usermodArgs, err := usermodArgs(username, u)
+	if err != nil {
+		return err
+	}
+	chageArgs, err := chageArgs(u)
+	if err != nil {
+		return err
+	}
+	if u.Password != nil && (*u.Password == "" || strings.ContainsAny(*u.Password, "\r\n")) {
+		return fmt.Errorf("invalid password")
+	}
+
+	if len(usermodArgs) > 0 {
+		output, err := run("usermod", append(usermodArgs, username)...)
+		if err != nil {
+			return fmt.Errorf("failed to modify user %s: %s", username, commandError(output, err))
+		}
+	}
+	if u.Password != nil {
+		if err := ChangePassword(username, *u.Password); err != nil {
+			return err
+		}
+	}
+	if len(chageArgs) > 0 {
+		output, err := run("chage", append(chageArgs, username)...)
+		if err != nil {
+			return fmt.Errorf("failed to set password aging of %s: %s", username, commandError(output, err))
+		}
+	}
+	return nil
+}
+
+func usermodArgs(username string, u Update) ([]string, error) {
+	var args []string
+	if u.Shell != nil {
+		if err := validateShell(*u.Shell); err != nil {
+			return nil, err
+		}
+		args = append(args, "-s", *u.Shell)
+	}
+	if u.Comment != nil {
+		if !isValidComment(*u.Comment) {
+			return nil, fmt.Errorf("invalid comment")
+		}
+		args = append(args, "-c", *u.Comment)
+	}
+	if u.Home != nil {
+		if !isValidHome(*u.Home) {
+			return nil, fmt.Errorf("invalid home directory: %s", *u.Home)
+		}
+		args = append(args, "-d", *u.Home)
+		if u.MoveHome {
+			args = append(args, "-m")
+		}
+	}
+	if u.UID != nil {
+		uid := *u.UID
+		if uid <= 0 || uid > maxID {
+			return nil, fmt.Errorf("invalid UID: %d", uid)
+		}
+		if owner, err := query("getent", "passwd", strconv.Itoa(uid)); err == nil && owner != "" {
+			if name := strings.SplitN(owner, ":", 2)[0]; name != username {
+				return nil, fmt.Errorf("UID %d is already used by %s", uid, name)
+			}
+		}
+		args = append(args, "-u", strconv.Itoa(uid))
+	}
+	if u.GID != nil {
+		gid := *u.GID
+		if gid < 0 || gid > maxID {
+			return nil, fmt.Errorf("invalid GID: %d", gid)
+		}
+		if group, err := query("getent", "group", strconv.Itoa(gid)); err != nil || group == "" {
+			return nil, fmt.Errorf("no group with GID %d", gid)
+		}
+		args = append(args, "-g", strconv.Itoa(gid))
+	}
+	return args, nil
+}
+
+func chageArgs(u Update) ([]string, error) {
+	var args []string
+	if u.Expires != nil {
+		if *u.Expires == "" {
+			args = append(args, "-E", "-1")
+		} else if _, err := time.Parse("2006-01-02", *u.Expires); err != nil {
+			return nil, fmt.Errorf("invalid expiry date: %s", *u.Expires)
+		} else {
+			args = append(args, "-E", *u.Expires)
+		}
+	}
+	for _, limit := range []struct {
+		flag  string
+		value *int
+	}{
+		{"-m", u.MinDays}, {"-M", u.MaxDays}, {"-W", u.WarnDays}, {"-I", u.InactiveDays},
+	} {
+		if limit.value == nil {
+			continue
+		}
+		if *limit.value < -1 || *limit.value > maxDays {
+			return nil, fmt.Errorf("invalid number of days: %d", *limit.value)
+		}
+		args = append(args, limit.flag, strconv.Itoa(*limit.value))
+	}
+	if u.MustChange {
+		args = append(args, "-d", "0")
+	}
+	return args, nil
+}
+
+// validateShell accepts the shells listed in /etc/shells and the nologin
+// shells.
+func validateShell(shell string) error {
+	for _, s := range nologinShells {
+		if shell == s {
+			return nil
+		}
+	}
+	data, err := os.ReadFile(shellsPath)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", shellsPath, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && line == shell {
+			return nil
+		}
+	}
+	return fmt.Errorf("shell is not listed in %s: %s", shellsPath, shell)
+}
+
+// isValidComment rejects what would break the passwd line; commas are
+// allowed as GECOS field separators.
+func isValidComment(comment string) bool {
+	if len(comment) > 255 {
+		return false
+	}
+	for _, c := range comment {
+		if c == ':' || unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidHome(home string) bool {
+	if len(home) > 4096 || !filepath.IsAbs(home) || filepath.Clean(home) != home || home == "/" {
+		return false
+	}
+	for _, c := range home {
+		if c == ':' || unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// uidRange returns UID_MIN and UID_MAX from /etc/login.defs, defaulting to
+// the shadow-utils values.
+func uidRange() (int, int) {
+	uidMin, uidMax := 1000, 60000
+	data, _ := os.ReadFile(loginDefsPath)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "UID_MIN":
+			uidMin = n
+		case "UID_MAX":
+			uidMax = n
+		}
+	}
+	return uidMin, uidMax
+}
+
+func isSystemUID(uid string, uidMin, uidMax int) bool {
+	n, err := strconv.Atoi(uid)
+	return err != nil || n < uidMin || n > uidMax
+}
+
+type shadowEntry struct {
+	expires string
+	aging   Aging
+}
+
+// parseShadow reads `getent shadow` lines
+// (name:password:lastchg:min:max:warn:inactive:expire:), where dates are days
+// since the epoch and empty fields are unset. A lastchg of 0 forces a
+// password change at next login.
+func parseShadow(output string) map[string]shadowEntry {
+	entries := make(map[string]shadowEntry)
+	days := func(field string) int {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	date := func(field string) string {
+		n := days(field)
+		if n <= 0 {
+			return ""
+		}
+		return time.Unix(int64(n)*86400, 0).UTC().Format("2006-01-02")
+	}
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.Split(line, ":")
+		if len(parts) < 8 {
+			continue
+		}
+		entries[parts[0]] = shadowEntry{
+			expires: date(parts[7]),
+			aging: Aging{
+				LastChanged:  date(parts[2]),
+				MinDays:      days(parts[3]),
+				MaxDays:      days(parts[4]),
+				WarnDays:     days(parts[5]),
+				InactiveDays: days(parts[6]),
+				MustChange:   parts[2] == "0",
+			},
+		}
+	}
+	return entries
+}
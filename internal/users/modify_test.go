@@ -0,0 +1,88 @@
+package users
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	calls := stub(t, map[string]string{
+		"getent passwd 1500": "",
+		"getent group 27":    "sudo:x:27:alice,bob\n",
+	})
+	var passwords []string
+	oldChpasswd := chpasswd
+	chpasswd = func(input string) error {
+		passwords = append(passwords, input)
+		return nil
+	}
+	t.Cleanup(func() { chpasswd = oldChpasswd })
+
+	shell, comment, home, expires, password := "/usr/bin/zsh", "Carol,,,", "/srv/carol", "2030-01-31", "s3cret:pw"
+	uid, gid, maxDays, inactive := 1500, 27, 90, -1
+	err := Modify("carol", Update{
+		Shell: &shell, Comment: &comment, Home: &home, MoveHome: true, UID: &uid, GID: &gid,
+		Expires: &expires, MaxDays: &maxDays, InactiveDays: &inactive, Password: &password, MustChange: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"getent passwd 1500",
+		"getent group 27",
+		"usermod -s /usr/bin/zsh -c Carol,,, -d /srv/carol -m -u 1500 -g 27 carol",
+		"chage -E 2030-01-31 -M 90 -I -1 -d 0 carol",
+	}
+	if strings.Join(*calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected commands:\n%s", strings.Join(*calls, "\n"))
+	}
+	if len(passwords) != 1 || passwords[0] != "carol:s3cret:pw" {
+		t.Fatalf("unexpected chpasswd input: %q", passwords)
+	}
+
+	*calls = nil
+	never := ""
+	if err := Modify("carol", Update{Expires: &never}); err != nil || strings.Join(*calls, "") != "chage -E -1 carol" {
+		t.Fatalf("unexpected result: %v, %q", err, *calls)
+	}
+
+	fish, badHome, badDate, root, bad := "/usr/bin/fish", "/srv/../etc", "31/01/2030", 0, "a\nroot:x"
+	for _, u := range []Update{{Shell: &fish}, {Home: &badHome}, {Expires: &badDate}, {UID: &root}, {Password: &bad}, {Comment: &bad}} {
+		if err := Modify("carol", u); err == nil {
+			t.Errorf("expected %+v to be rejected", u)
+		}
+	}
+	nologin := "/usr/sbin/nologin"
+	if err := Modify("carol", Update{Shell: &nologin}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListSystemUsers(t *testing.T) {
+	stub(t, map[string]string{
+		"getent passwd": getentPasswd + "nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin\n",
+		"getent group":  getentGroup,
+		"getent shadow": "root:*:19000:0:99999:7:::\nalice:$6$x:19737:0:90:7:14:22000:\nbob:!:0::::::\n",
+	})
+
+	all, err := List(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || !all[0].System || all[1].System || !all[3].System {
+		t.Fatalf("unexpected users: %+v", all)
+	}
+	alice := all[1]
+	if alice.Comment != "Alice" || alice.Expires != "2030-03-27" || alice.Aging.LastChanged != "2024-01-15" ||
+		alice.Aging.MaxDays != 90 || alice.Aging.InactiveDays != 14 || alice.Aging.MustChange {
+		t.Fatalf("unexpected alice: %+v %+v", alice, alice.Aging)
+	}
+	if bob := all[2]; !bob.Aging.MustChange || bob.Aging.MaxDays != -1 || bob.Expires != "" {
+		t.Fatalf("unexpected bob: %+v %+v", bob, bob.Aging)
+	}
+
+	human, err := List(false)
+	if err != nil || len(human) != 2 || human[0].Username != "alice" || human[1].Username != "bob" {
+		t.Fatalf("unexpected human users: %+v, %v", human, err)
+	}
+}
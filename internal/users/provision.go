@@ -0,0 +1,303 @@
+package users
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"orbit/internal/jobs"
+	"orbit/internal/util"
+)
+
+const (
+	// MaxProvisionSize is the largest CSV or JSON import accepted.
+	MaxProvisionSize = 4 << 20
+	maxProvisionRows = 1000
+	// generatedPasswordLength hex characters give 80 bits.
+	generatedPasswordLength = 20
+)
+
+// ProvisionRow is one account of a bulk import. Keys are authorized_keys
+// lines. With GeneratePassword a random password is set that has to be
+// changed at first login; without a password the account cannot log in with
+// one.
+type ProvisionRow struct {
+	Username         string   `json:"username"`
+	Groups           []string `json:"groups"`
+	Shell            string   `json:"shell"`
+	Comment          string   `json:"comment"`
+	Keys             []string `json:"keys"`
+	Password         string   `json:"password"`
+	GeneratePassword bool     `json:"generatePassword"`
+}
+
+// ProvisionResult is the outcome of one row, numbered from 1. Status is
+// "valid" or "invalid" in a dry run, and "created", "partial" (created, but
+// keys or password aging failed) or "failed" when applied.
+type ProvisionResult struct {
+	Row      int      `json:"row"`
+	Username string   `json:"username"`
+	Status   string   `json:"status"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// Credential is a generated one-time password. They are only returned when
+// the import starts and are never kept in the job.
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ParseProvisionRows reads an import in the given format, "csv" or "json",
+// detecting it from the first character when empty. JSON is an array of
+// rows. CSV has a header naming its columns: username, groups (separated by
+// commas, semicolons or spaces), shell, comment, keys (one per line),
+// password and generate_password.
+func ParseProvisionRows(data []byte, format string) ([]ProvisionRow, error) {
+	if format == "" {
+		format = "csv"
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			format = "json"
+		}
+	}
+
+	var rows []ProvisionRow
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+	case "csv":
+		var err error
+		if rows, err = parseProvisionCSV(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown import format: %s", format)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows to import")
+	}
+	if len(rows) > maxProvisionRows {
+		return nil, fmt.Errorf("at most %d rows can be imported at once", maxProvisionRows)
+	}
+	return rows, nil
+}
+
+func parseProvisionCSV(data []byte) ([]ProvisionRow, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "username", "groups", "shell", "comment", "keys", "password", "generate_password":
+		default:
+			return nil, fmt.Errorf("unknown CSV column: %s", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, fmt.Errorf("CSV has no username column")
+	}
+
+	rows := []ProvisionRow{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := ProvisionRow{
+			Username: field("username"),
+			Groups: strings.FieldsFunc(field("groups"), func(c rune) bool {
+				return c == ',' || c == ';' || c == ' '
+			}),
+			Shell:    field("shell"),
+			Comment:  field("comment"),
+			Password: field("password"),
+		}
+		for _, key := range strings.Split(field("keys"), "\n") {
+			if key = strings.TrimSpace(key); key != "" {
+				row.Keys = append(row.Keys, key)
+			}
+		}
+		if generate := field("generate_password"); generate != "" {
+			if row.GeneratePassword, err = parseYesNo(generate); err != nil {
+				return nil, fmt.Errorf("row %d: invalid generate_password: %s", len(rows)+1, generate)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y":
+		return true, nil
+	case "no", "n":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// CheckProvision validates every row without changing anything: the
+// username, that the account does not exist yet and is not repeated, that
+// the groups exist, the shell, the keys and the password.
+func CheckProvision(rows []ProvisionRow) ([]ProvisionResult, error) {
+	groups, err := ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, g := range groups {
+		known[g.Name] = true
+	}
+
+	results := make([]ProvisionResult, len(rows))
+	seen := make(map[string]int)
+	for i, row := range rows {
+		var errs []string
+		switch {
+		case !isValidUsername(row.Username):
+			errs = append(errs, fmt.Sprintf("invalid username: %s", row.Username))
+		case seen[row.Username] > 0:
+			errs = append(errs, fmt.Sprintf("%s is also on row %d", row.Username, seen[row.Username]))
+		default:
+			seen[row.Username] = i + 1
+			if output, err := query("getent", "passwd", row.Username); err == nil && strings.TrimSpace(output) != "" {
+				errs = append(errs, fmt.Sprintf("user %s already exists", row.Username))
+			}
+		}
+		for _, g := range row.Groups {
+			if !isValidGroupName(g) {
+				errs = append(errs, fmt.Sprintf("invalid group name: %s", g))
+			} else if !known[g] {
+				errs = append(errs, fmt.Sprintf("group not found: %s", g))
+			}
+		}
+		if row.Shell != "" {
+			if err := validateShell(row.Shell); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if !isValidComment(row.Comment) {
+			errs = append(errs, "invalid comment")
+		}
+		for _, line := range row.Keys {
+			if err := checkKeyLine(line); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if strings.ContainsAny(row.Password, "\r\n") {
+			errs = append(errs, "invalid password")
+		}
+		if row.Password != "" && row.GeneratePassword {
+			errs = append(errs, "a password cannot be both given and generated")
+		}
+
+		results[i] = ProvisionResult{Row: i + 1, Username: row.Username, Status: "valid", Errors: errs}
+		if len(errs) > 0 {
+			results[i].Status = "invalid"
+		}
+	}
+	return results, nil
+}
+
+func checkKeyLine(line string) error {
+	pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	return checkKeyStrength(newAuthorizedKey(pub, comment, options))
+}
+
+// Provision checks the rows and, when all are valid, creates the accounts in
+// a background job whose result is the per-row outcome. The generated
+// passwords are returned here only.
+func Provision(rows []ProvisionRow) (jobs.Job, []Credential, error) {
+	results, err := CheckProvision(rows)
+	if err != nil {
+		return jobs.Job{}, nil, err
+	}
+	invalid := 0
+	for _, r := range results {
+		if r.Status == "invalid" {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return jobs.Job{}, nil, fmt.Errorf("%d of %d rows are invalid; run a dry run for details", invalid, len(rows))
+	}
+
+	credentials := []Credential{}
+	passwords := make([]string, len(rows))
+	for i, row := range rows {
+		passwords[i] = row.Password
+		if row.GeneratePassword {
+			passwords[i] = util.GenerateRandomString(generatedPasswordLength)
+			credentials = append(credentials, Credential{Username: row.Username, Password: passwords[i]})
+		}
+	}
+
+	job := jobs.Start("user-provision", func() (interface{}, error) {
+		results := make([]ProvisionResult, len(rows))
+		failed := 0
+		for i, row := range rows {
+			results[i] = provisionRow(i+1, row, passwords[i])
+			if results[i].Status != "created" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return results, fmt.Errorf("%d of %d accounts were not fully provisioned", failed, len(rows))
+		}
+		return results, nil
+	})
+	return job, credentials, nil
+}
+
+// provisionRow creates one account, adds its keys and, for a generated
+// password, forces a change at first login.
+func provisionRow(n int, row ProvisionRow, password string) ProvisionResult {
+	result := ProvisionResult{Row: n, Username: row.Username, Status: "created"}
+	opts := CreateOptions{Groups: row.Groups, Shell: row.Shell, Comment: row.Comment}
+	if err := Create(row.Username, password, opts); err != nil {
+		result.Status = "failed"
+		result.Errors = []string{err.Error()}
+		return result
+	}
+	for _, key := range row.Keys {
+		if _, err := AddKey(row.Username, key); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	if row.GeneratePassword {
+		if output, err := run("chage", "-d", "0", row.Username); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to expire password: %s", commandError(output, err)))
+		}
+	}
+	if len(result.Errors) > 0 {
+		result.Status = "partial"
+	}
+	return result
+}
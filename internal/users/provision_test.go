@@ -0,0 +1,146 @@
+package users
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"orbit/internal/jobs"
+)
+
+func TestParseProvisionRows(t *testing.T) {
+	data, err := os.ReadFile("testdata/provision.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseProvisionRows(data, ""); err == nil || !strings.Contains(err.Error(), "row 4") {
+		t.Fatalf("expected the generate_password of row 4 to be refused, got %v", err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	rows, err := ParseProvisionRows([]byte(strings.Join(lines[:4], "\n")), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0].Groups, ",") != "sudo,docker" || len(rows[0].Keys) != 1 ||
+		!rows[0].GeneratePassword || rows[1].GeneratePassword || strings.Join(rows[2].Groups, ",") != "sudo,admins" {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+
+	rows, err = ParseProvisionRows([]byte(` [{"username": "erin", "groups": ["docker"], "generatePassword": true}]`), "")
+	if err != nil || len(rows) != 1 || rows[0].Username != "erin" || !rows[0].GeneratePassword {
+		t.Fatalf("unexpected JSON rows: %+v, %v", rows, err)
+	}
+	if _, err := ParseProvisionRows([]byte("name,shell\nerin,/bin/sh\n"), "csv"); err == nil {
+		t.Fatal("expected an unknown column to be refused")
+	}
+}
+
+func TestProvision(t *testing.T) {
+	calls := stub(t, map[string]string{
+		"getent group":        getentGroup,
+		"getent passwd":       getentPasswd,
+		"getent passwd alice": "alice:x:1000:1000:Alice:/home/alice:/bin/bash\n",
+	})
+	var keyFiles []string
+	oldRunInput := runInput
+	runInput = func(input, command string, args ...string) (string, error) {
+		keyFiles = append(keyFiles, input)
+		return "", nil
+	}
+	var passwords []string
+	oldChpasswd := chpasswd
+	chpasswd = func(input string) error {
+		passwords = append(passwords, input)
+		return nil
+	}
+	t.Cleanup(func() { chpasswd, runInput = oldChpasswd, oldRunInput })
+
+	data, err := os.ReadFile("testdata/provision.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := ParseProvisionRows([]byte(strings.Join(strings.Split(string(data), "\n")[:4], "\n")), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows = append(rows, ProvisionRow{Username: "dave", Password: "pw", GeneratePassword: true})
+
+	results, err := CheckProvision(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status []string
+	for _, r := range results {
+		status = append(status, r.Status)
+	}
+	if got := strings.Join(status, ","); got != "valid,valid,invalid,invalid" {
+		t.Fatalf("statuses = %s: %+v", got, results)
+	}
+	errs := strings.Join(results[2].Errors, "; ")
+	for _, want := range []string{"alice already exists", "group not found: admins", "/bin/fish", "invalid public key"} {
+		if !strings.Contains(errs, want) {
+			t.Errorf("row 3 errors %q lack %q", errs, want)
+		}
+	}
+	if errs := strings.Join(results[3].Errors, "; "); !strings.Contains(errs, "also on row 2") || !strings.Contains(errs, "both given and generated") {
+		t.Errorf("unexpected row 4 errors: %s", errs)
+	}
+	if _, _, err := Provision(rows); err == nil || !strings.Contains(err.Error(), "2 of 4 rows are invalid") {
+		t.Fatalf("expected invalid rows to stop the import, got %v", err)
+	}
+
+	// carol exists once useradd has run, for her key to be added
+	*calls = nil
+	stubbed := run
+	created := func(command string, args ...string) (string, error) {
+		cmdline := strings.Join(append([]string{command}, args...), " ")
+		if strings.Contains(strings.Join(*calls, "\n"), "useradd") {
+			switch cmdline {
+			case "getent passwd carol":
+				return "carol:x:1002:1002:Carol:/home/carol:/bin/bash\n", nil
+			case "runuser -u carol -- stat -c %F /home/carol":
+				return "directory\n", nil
+			}
+		}
+		return stubbed(command, args...)
+	}
+	run, query = created, created
+	job, credentials, err := Provision(rows[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 1 || credentials[0].Username != "carol" || len(credentials[0].Password) != generatedPasswordLength {
+		t.Fatalf("unexpected credentials: %+v", credentials)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == "running" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		job, _ = jobs.Get(job.ID)
+	}
+	results, ok := job.Result.([]ProvisionResult)
+	if job.Status != "succeeded" || !ok || len(results) != 2 || results[0].Status != "created" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if len(passwords) != 1 || passwords[0] != "carol:"+credentials[0].Password {
+		t.Fatalf("unexpected chpasswd input: %q", passwords)
+	}
+	if len(keyFiles) != 1 || !strings.HasSuffix(keyFiles[0], "carol@laptop\n") {
+		t.Fatalf("unexpected authorized_keys: %q", keyFiles)
+	}
+	joined := strings.Join(*calls, "\n")
+	for _, want := range []string{
+		"useradd -m -s /bin/bash -c Carol -G sudo,docker carol",
+		"runuser -u carol -- install -d -m 0700 /home/carol/.ssh",
+		"chage -d 0 carol",
+		"useradd -m -s /bin/bash -G docker dave",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("%q was not run:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "chage -d 0 dave") {
+		t.Error("dave has no generated password to expire")
+	}
+}
@@ -0,0 +1,299 @@
+package users
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuotaFilesystem is a filesystem with quota support. User and Group report
+// whether that quota type is turned on.
+type QuotaFilesystem struct {
+	Mount      string      `json:"mount"`
+	Device     string      `json:"device"`
+	User       bool        `json:"user"`
+	Group      bool        `json:"group"`
+	UserGrace  *QuotaGrace `json:"userGrace,omitempty"`
+	GroupGrace *QuotaGrace `json:"groupGrace,omitempty"`
+}
+
+// QuotaGrace is how long a soft block or file limit may be exceeded for, as
+// repquota prints it ("7days", "12:00").
+type QuotaGrace struct {
+	Block string `json:"block"`
+	File  string `json:"file"`
+}
+
+// QuotaEntry is the usage and limits of one user or group on one filesystem.
+// Block figures are in KiB; a limit of 0 is no limit. The grace fields are
+// set while a soft limit is exceeded and tell when it starts being enforced
+// as a hard one.
+type QuotaEntry struct {
+	Type           string     `json:"type"` // "user" or "group"
+	Name           string     `json:"name"`
+	Mount          string     `json:"mount"`
+	Device         string     `json:"device"`
+	UsedKB         int64      `json:"usedKB"`
+	SoftKB         int64      `json:"softKB"`
+	HardKB         int64      `json:"hardKB"`
+	BlockGraceEnds *time.Time `json:"blockGraceEnds,omitempty"`
+	Files          int64      `json:"files"`
+	SoftFiles      int64      `json:"softFiles"`
+	HardFiles      int64      `json:"hardFiles"`
+	FileGraceEnds  *time.Time `json:"fileGraceEnds,omitempty"`
+}
+
+// QuotaReport is the quota state of all quota-enabled filesystems.
+type QuotaReport struct {
+	Filesystems []QuotaFilesystem `json:"filesystems"`
+	Entries     []QuotaEntry      `json:"entries"`
+}
+
+// Quotas detects the quota-enabled filesystems with `quotaon -pa` and reads
+// user and group usage and limits with `repquota`.
+func Quotas() (*QuotaReport, error) {
+	filesystems, err := quotaFilesystems()
+	if err != nil {
+		return nil, err
+	}
+	report := &QuotaReport{Filesystems: filesystems, Entries: []QuotaEntry{}}
+	if len(filesystems) == 0 {
+		return report, nil
+	}
+
+	output, err := run("repquota", "-a", "-u", "-g", "-p")
+	if err != nil && !strings.Contains(output, "*** Report") {
+		return nil, fmt.Errorf("repquota failed: %s", commandError(output, err))
+	}
+	entries, grace := parseRepquota(output)
+	for i := range entries {
+		entries[i].Mount = mountOf(filesystems, entries[i].Device)
+	}
+	for i, fs := range report.Filesystems {
+		report.Filesystems[i].UserGrace = grace["user "+fs.Device]
+		report.Filesystems[i].GroupGrace = grace["group "+fs.Device]
+	}
+	report.Entries = entries
+	return report, nil
+}
+
+// userQuotas returns the user quota entries by user name, or nil where quotas
+// are not in use, for the user list.
+func userQuotas() map[string][]QuotaEntry {
+	filesystems, err := quotaFilesystems()
+	if err != nil || len(filesystems) == 0 {
+		return nil
+	}
+	output, err := run("repquota", "-a", "-u", "-p")
+	if err != nil && !strings.Contains(output, "*** Report") {
+		return nil
+	}
+	entries, _ := parseRepquota(output)
+	byName := make(map[string][]QuotaEntry)
+	for _, e := range entries {
+		e.Mount = mountOf(filesystems, e.Device)
+		byName[e.Name] = append(byName[e.Name], e)
+	}
+	return byName
+}
+
+// SetQuota sets the block (KiB) and file limits of a user or group on a
+// quota-enabled filesystem. 0 removes a limit.
+func SetQuota(kind, name, mount string, softKB, hardKB, softFiles, hardFiles int64) error {
+	flag, err := quotaFlag(kind)
+	if err != nil {
+		return err
+	}
+	if (kind == "user" && !isValidUsername(name)) || (kind == "group" && !isValidGroupName(name)) {
+		return fmt.Errorf("invalid %s name: %s", kind, name)
+	}
+	if softKB < 0 || hardKB < 0 || softFiles < 0 || hardFiles < 0 {
+		return fmt.Errorf("quota limits cannot be negative")
+	}
+	if (hardKB > 0 && softKB > hardKB) || (hardFiles > 0 && softFiles > hardFiles) {
+		return fmt.Errorf("soft limits cannot exceed hard limits")
+	}
+	if err := checkQuotaMount(mount, kind); err != nil {
+		return err
+	}
+
+	args := []string{flag, name}
+	for _, n := range []int64{softKB, hardKB, softFiles, hardFiles} {
+		args = append(args, strconv.FormatInt(n, 10))
+	}
+	output, err := run("setquota", append(args, mount)...)
+	if err != nil {
+		return fmt.Errorf("failed to set quota of %s on %s: %s", name, mount, commandError(output, err))
+	}
+	return nil
+}
+
+// SetQuotaGrace sets the grace periods, in seconds, of a quota type on a
+// filesystem.
+func SetQuotaGrace(kind, mount string, blockSeconds, fileSeconds int64) error {
+	flag, err := quotaFlag(kind)
+	if err != nil {
+		return err
+	}
+	if blockSeconds < 0 || fileSeconds < 0 {
+		return fmt.Errorf("grace periods cannot be negative")
+	}
+	if err := checkQuotaMount(mount, kind); err != nil {
+		return err
+	}
+	output, err := run("setquota", "-t", flag, strconv.FormatInt(blockSeconds, 10), strconv.FormatInt(fileSeconds, 10), mount)
+	if err != nil {
+		return fmt.Errorf("failed to set grace periods on %s: %s", mount, commandError(output, err))
+	}
+	return nil
+}
+
+func quotaFlag(kind string) (string, error) {
+	switch kind {
+	case "user":
+		return "-u", nil
+	case "group":
+		return "-g", nil
+	}
+	return "", fmt.Errorf("invalid quota type: %s", kind)
+}
+
+// checkQuotaMount only lets limits be set on mount points quotaon reports, so
+// arbitrary paths never reach setquota.
+func checkQuotaMount(mount, kind string) error {
+	filesystems, err := quotaFilesystems()
+	if err != nil {
+		return err
+	}
+	for _, fs := range filesystems {
+		if fs.Mount == mount {
+			if (kind == "user" && !fs.User) || (kind == "group" && !fs.Group) {
+				return fmt.Errorf("%s quotas are not enabled on %s", kind, mount)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no quota-enabled filesystem mounted at %s", mount)
+}
+
+// quotaStatus matches `quotaon -p` lines such as
+// "user quota on /home (/dev/sdb1) is on (enforced)".
+var quotaStatus = regexp.MustCompile(`^(user|group|project) quota on (\S+) \((\S+)\) is (on|off)`)
+
+func quotaFilesystems() ([]QuotaFilesystem, error) {
+	// quotaon -p exits non-zero when a quota is off, so go by the output
+	output, err := run("quotaon", "-pa")
+	filesystems := parseQuotaon(output)
+	if err != nil && len(filesystems) == 0 && strings.TrimSpace(output) != "" {
+		return nil, fmt.Errorf("quotaon failed: %s", commandError(output, err))
+	}
+	return filesystems, nil
+}
+
+func parseQuotaon(output string) []QuotaFilesystem {
+	filesystems := []QuotaFilesystem{}
+	index := make(map[string]int)
+	for _, line := range strings.Split(output, "\n") {
+		m := quotaStatus.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		i, ok := index[m[2]]
+		if !ok {
+			i = len(filesystems)
+			index[m[2]] = i
+			filesystems = append(filesystems, QuotaFilesystem{Mount: m[2], Device: m[3]})
+		}
+		on := m[4] == "on"
+		switch m[1] {
+		case "user":
+			filesystems[i].User = on
+		case "group":
+			filesystems[i].Group = on
+		}
+	}
+	return filesystems
+}
+
+func mountOf(filesystems []QuotaFilesystem, device string) string {
+	for _, fs := range filesystems {
+		if fs.Device == device {
+			return fs.Mount
+		}
+	}
+	return ""
+}
+
+var (
+	repquotaHeader = regexp.MustCompile(`^\*\*\* Report for (user|group) quotas on device (\S+)`)
+	repquotaGrace  = regexp.MustCompile(`^Block grace time: ([^;]+); Inode grace time: (.+)$`)
+)
+
+// parseRepquota reads `repquota -p` output, where grace columns are the Unix
+// time the grace period ends, or 0:
+//
+//	*** Report for user quotas on device /dev/sdb1
+//	Block grace time: 7days; Inode grace time: 7days
+//	                        Block limits                File limits
+//	User            used    soft    hard  grace    used  soft  hard  grace
+//	----------------------------------------------------------------------
+//	alice     +-  120000  100000  150000 1705000000    50     0     0      0
+//
+// It also returns the grace periods by quota type and device, such as
+// "user /dev/sdb1".
+func parseRepquota(output string) ([]QuotaEntry, map[string]*QuotaGrace) {
+	entries := []QuotaEntry{}
+	grace := make(map[string]*QuotaGrace)
+	var kind, device string
+	graceEnd := func(field string) *time.Time {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n <= 0 {
+			return nil
+		}
+		t := time.Unix(n, 0).UTC()
+		return &t
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if m := repquotaHeader.FindStringSubmatch(line); m != nil {
+			kind, device = m[1], m[2]
+			continue
+		}
+		if m := repquotaGrace.FindStringSubmatch(strings.TrimSpace(line)); m != nil && device != "" {
+			grace[kind+" "+device] = &QuotaGrace{Block: m[1], File: m[2]}
+			continue
+		}
+		fields := strings.Fields(line)
+		if kind == "" || len(fields) != 10 || len(fields[1]) != 2 || strings.Trim(fields[1], "+-") != "" {
+			continue
+		}
+		var n [8]int64
+		valid := true
+		for i, f := range []string{fields[2], fields[3], fields[4], fields[5], fields[6], fields[7], fields[8], fields[9]} {
+			v, err := strconv.ParseInt(f, 10, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			n[i] = v
+		}
+		if !valid {
+			continue
+		}
+		entries = append(entries, QuotaEntry{
+			Type:           kind,
+			Name:           strings.TrimPrefix(fields[0], "#"),
+			Device:         device,
+			UsedKB:         n[0],
+			SoftKB:         n[1],
+			HardKB:         n[2],
+			BlockGraceEnds: graceEnd(fields[5]),
+			Files:          n[4],
+			SoftFiles:      n[5],
+			HardFiles:      n[6],
+			FileGraceEnds:  graceEnd(fields[9]),
+		})
+	}
+	return entries, grace
+}
@@ -0,0 +1,86 @@
+package users
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const quotaon = `group quota on / (/dev/sda1) is off
+user quota on / (/dev/sda1) is off
+group quota on /home (/dev/sdb1) is on (enforced)
+user quota on /home (/dev/sdb1) is on (enforced)
+`
+
+func TestQuotas(t *testing.T) {
+	repquota, err := os.ReadFile("testdata/repquota.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub(t, map[string]string{"quotaon -pa": quotaon, "repquota -a -u -g -p": string(repquota)})
+
+	report, err := Quotas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Filesystems) != 2 || report.Filesystems[0].User || !report.Filesystems[1].Group {
+		t.Fatalf("unexpected filesystems: %+v", report.Filesystems)
+	}
+	if fs := report.Filesystems[1]; fs.Mount != "/home" || *fs.UserGrace != (QuotaGrace{"7days", "7days"}) ||
+		*fs.GroupGrace != (QuotaGrace{"1days", "12:00"}) {
+		t.Fatalf("unexpected /home: %+v", fs)
+	}
+	if len(report.Entries) != 5 {
+		t.Fatalf("expected 5 entries, got %+v", report.Entries)
+	}
+	alice := report.Entries[1]
+	if alice.Name != "alice" || alice.Mount != "/home" || alice.UsedKB != 120000 || alice.HardKB != 150000 ||
+		alice.BlockGraceEnds == nil || alice.BlockGraceEnds.Unix() != 1705000000 || alice.FileGraceEnds != nil {
+		t.Fatalf("unexpected alice: %+v", alice)
+	}
+	if report.Entries[2].Name != "1005" || report.Entries[2].HardFiles != 200 {
+		t.Fatalf("unexpected unnamed user: %+v", report.Entries[2])
+	}
+	docker := report.Entries[4]
+	if docker.Type != "group" || docker.Files != 120 || docker.FileGraceEnds == nil {
+		t.Fatalf("unexpected docker: %+v", docker)
+	}
+}
+
+func TestSetQuota(t *testing.T) {
+	calls := stub(t, map[string]string{"quotaon -pa": quotaon})
+
+	if err := SetQuota("user", "alice", "/home", 100000, 150000, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetQuotaGrace("group", "/home", 86400, 43200); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		kind, name, mount string
+		soft, hard        int64
+		want              string
+	}{
+		{"user", "alice", "/", 0, 0, "not enabled"},
+		{"user", "alice", "/srv", 0, 0, "no quota-enabled filesystem"},
+		{"user", "alice", "/home", 200, 100, "cannot exceed"},
+		{"user", "alice", "/home", -1, 0, "negative"},
+		{"user", "-alice", "/home", 0, 0, "invalid user name"},
+		{"project", "alice", "/home", 0, 0, "invalid quota type"},
+	} {
+		if err := SetQuota(c.kind, c.name, c.mount, c.soft, c.hard, 0, 0); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("SetQuota(%s, %s, %s) = %v, want %q", c.kind, c.name, c.mount, err, c.want)
+		}
+	}
+
+	var setquota []string
+	for _, call := range *calls {
+		if strings.HasPrefix(call, "setquota") {
+			setquota = append(setquota, call)
+		}
+	}
+	want := "setquota -u alice 100000 150000 0 0 /home,setquota -t -g 86400 43200 /home"
+	if got := strings.Join(setquota, ","); got != want {
+		t.Fatalf("setquota calls = %s", got)
+	}
+}
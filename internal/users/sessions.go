@@ -0,0 +1,319 @@
+package users
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"orbit/internal/journal"
+)
+
+// procUptime gives the clock that logind's monotonic timestamps count from.
+var procUptime = "/proc/uptime"
+
+const defaultLoginLimit = 100
+
+// Session is an active login. ID is the logind session ID; sessions read from
+// utmp, when logind is not available, have none and cannot be terminated.
+type Session struct {
+	ID          string    `json:"id,omitempty"`
+	Username    string    `json:"username"`
+	UID         string    `json:"uid,omitempty"`
+	TTY         string    `json:"tty"`
+	RemoteHost  string    `json:"remoteHost"`
+	Service     string    `json:"service,omitempty"`
+	Type        string    `json:"type,omitempty"`
+	State       string    `json:"state,omitempty"`
+	Leader      string    `json:"leader,omitempty"`
+	Since       time.Time `json:"since"`
+	IdleSeconds int64     `json:"idleSeconds"`
+}
+
+// Login is a login history or failed login record. Status is "active",
+// "logged out", "gone" (no logout recorded), "crash", "down" or "failed".
+type Login struct {
+	Username string     `json:"username"`
+	TTY      string     `json:"tty"`
+	Host     string     `json:"host"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"`
+	Status   string     `json:"status"`
+}
+
+// loginctlProperties are the session properties read with
+// `loginctl show-session`. The monotonic timestamps avoid parsing the
+// localized wall clock format.
+var loginctlProperties = []string{
+	"Id", "Name", "User", "TTY", "RemoteHost", "Service", "Type", "Class", "State",
+	"Leader", "TimestampMonotonic", "IdleHint", "IdleSinceHintMonotonic",
+}
+
+// Sessions returns the active logins from logind, or from utmp through `who`
+// when loginctl is not available.
+func Sessions() ([]Session, error) {
+	output, err := query("loginctl", "list-sessions", "--no-legend")
+	if err != nil {
+		return utmpSessions()
+	}
+	var ids []string
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && isValidSessionID(fields[0]) {
+			ids = append(ids, fields[0])
+		}
+	}
+	if len(ids) == 0 {
+		return []Session{}, nil
+	}
+
+	args := []string{"show-session"}
+	for _, p := range loginctlProperties {
+		args = append(args, "-p", p)
+	}
+	output, err = query("loginctl", append(args, ids...)...)
+	if err != nil {
+		return nil, fmt.Errorf("loginctl failed: %s", commandError(output, err))
+	}
+	return parseLoginctlSessions(output, uptime(), time.Now()), nil
+}
+
+// parseLoginctlSessions reads the blank-line separated property blocks of
+// `loginctl show-session`. Timestamps are monotonic microseconds, converted
+// with the system uptime.
+func parseLoginctlSessions(output string, up time.Duration, now time.Time) []Session {
+	sessions := []Session{}
+	since := func(usec string) time.Time {
+		n, err := strconv.ParseInt(usec, 10, 64)
+		if err != nil || n <= 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Duration(n)*time.Microsecond - up).Truncate(time.Second)
+	}
+	for _, block := range strings.Split(strings.TrimSpace(output), "\n\n") {
+		props := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok {
+				props[key] = value
+			}
+		}
+		if props["Id"] == "" || strings.HasPrefix(props["Class"], "manager") {
+			continue
+		}
+		s := Session{
+			ID:         props["Id"],
+			Username:   props["Name"],
+			UID:        props["User"],
+			TTY:        props["TTY"],
+			RemoteHost: props["RemoteHost"],
+			Service:    props["Service"],
+			Type:       props["Type"],
+			State:      props["State"],
+			Leader:     props["Leader"],
+			Since:      since(props["TimestampMonotonic"]),
+		}
+		if props["IdleHint"] == "yes" {
+			if idleSince := since(props["IdleSinceHintMonotonic"]); !idleSince.IsZero() {
+				s.IdleSeconds = int64(now.Sub(idleSince).Seconds())
+			}
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+func uptime() time.Duration {
+	data, _ := os.ReadFile(procUptime)
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	secs, _ := strconv.ParseFloat(fields[0], 64)
+	return time.Duration(secs * float64(time.Second))
+}
+
+func utmpSessions() ([]Session, error) {
+	output, err := query("who", "-u")
+	if err != nil {
+		return nil, fmt.Errorf("who failed: %s", commandError(output, err))
+	}
+	return parseWho(output, time.Now()), nil
+}
+
+// parseWho reads `who -u` lines:
+//
+//	alice    pts/0        2024-01-10 10:12 00:05        1234 (10.0.0.5)
+//
+// The idle column is "." for activity in the last minute and "old" after a
+// day.
+func parseWho(output string, now time.Time) []Session {
+	sessions := []Session{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		s := Session{Username: fields[0], TTY: fields[1], Leader: fields[5]}
+		s.Since, _ = time.ParseInLocation("2006-01-02 15:04", fields[2]+" "+fields[3], now.Location())
+		switch idle := fields[4]; idle {
+		case ".":
+		case "old":
+			s.IdleSeconds = 24 * 60 * 60
+		default:
+			if h, m, ok := strings.Cut(idle, ":"); ok {
+				hours, _ := strconv.Atoi(h)
+				minutes, _ := strconv.Atoi(m)
+				s.IdleSeconds = int64(hours*3600 + minutes*60)
+			}
+		}
+		if len(fields) > 6 {
+			s.RemoteHost = strings.Trim(fields[6], "()")
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// TerminateSession ends a logind session and kills its processes.
+func TerminateSession(id string) error {
+	if !isValidSessionID(id) {
+		return fmt.Errorf("invalid session ID: %s", id)
+	}
+	output, err := run("loginctl", "terminate-session", id)
+	if err != nil {
+		return fmt.Errorf("failed to terminate session %s: %s", id, commandError(output, err))
+	}
+	return nil
+}
+
+// LoginHistory returns up to limit logins from wtmp, newest first.
+func LoginHistory(limit int) ([]Login, error) {
+	output, err := query("last", lastArgs(limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("last failed: %s", commandError(output, err))
+	}
+	return parseLast(output, ""), nil
+}
+
+// FailedLogins returns up to limit failed login attempts from btmp, newest
+// first. Where btmp cannot be read, sshd and PAM failures are taken from the
+// journal instead.
+func FailedLogins(limit int) ([]Login, error) {
+	output, err := run("lastb", lastArgs(limit)...)
+	if err == nil {
+		return parseLast(output, "failed"), nil
+	}
+
+	if limit <= 0 {
+		limit = defaultLoginLimit
+	}
+	page, jerr := journal.Search(journal.Query{Grep: "Failed .* for .* from|authentication failure", Limit: limit})
+	if jerr != nil {
+		return nil, fmt.Errorf("lastb failed: %s; %v", commandError(output, err), jerr)
+	}
+	logins := []Login{}
+	for _, entry := range page.Entries {
+		if login, ok := parseAuthFailure(entry); ok {
+			logins = append(logins, login)
+		}
+	}
+	return logins, nil
+}
+
+func lastArgs(limit int) []string {
+	if limit <= 0 {
+		limit = defaultLoginLimit
+	}
+	return []string{"-w", "-i", "--time-format", "iso", "-n", strconv.Itoa(limit)}
+}
+
+// parseLast reads `last`/`lastb -w -i --time-format iso` output:
+//
+//	alice    pts/0        10.0.0.5         2024-01-10T10:12:33+00:00 - 2024-01-10T11:00:01+00:00  (00:47)
+//	bob      pts/1        0.0.0.0          2024-01-10T12:00:00+00:00   still logged in
+//
+// Reboot and shutdown records are skipped. status overrides the status
+// derived from the record, for lastb.
+func parseLast(output, status string) []Login {
+	logins := []Login{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] == "reboot" || fields[0] == "shutdown" {
+			continue
+		}
+		start, err := parseLastTime(fields[3])
+		if err != nil {
+			continue
+		}
+		login := Login{Username: fields[0], TTY: fields[1], Host: fields[2], Start: start, Status: status}
+		if login.Host == "0.0.0.0" {
+			login.Host = ""
+		}
+
+		rest := fields[4:]
+		switch {
+		case len(rest) >= 2 && rest[0] == "still":
+			login.Status = "active"
+		case len(rest) >= 1 && rest[0] == "gone":
+			login.Status = "gone"
+		case len(rest) >= 2 && rest[0] == "-":
+			if end, err := parseLastTime(rest[1]); err == nil {
+				login.End = &end
+				login.Status = "logged out"
+			} else {
+				login.Status = rest[1]
+			}
+		}
+		if status != "" {
+			login.Status = status
+		}
+		logins = append(logins, login)
+	}
+	return logins
+}
+
+func parseLastTime(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02T15:04:05-07:00", value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02T15:04:05-0700", value)
+	}
+	return t, err
+}
+
+var (
+	sshdFailure = regexp.MustCompile(`Failed \S+ for (?:invalid user )?(\S+) from (\S+)`)
+	pamFailure  = regexp.MustCompile(`authentication failure;.*\brhost=(\S*).*\buser=(\S+)`)
+	pamService  = regexp.MustCompile(`pam_\w+\(([^:)]+)`)
+)
+
+// parseAuthFailure turns an sshd "Failed password for alice from 10.0.0.5"
+// or a PAM "authentication failure; ... rhost= user=alice" journal message
+// into a failed login. sshd logs both for a password failure, so PAM
+// messages from sshd are skipped.
+func parseAuthFailure(entry journal.Entry) (Login, bool) {
+	if m := sshdFailure.FindStringSubmatch(entry.Message); m != nil {
+		return Login{Username: m[1], TTY: "ssh", Host: m[2], Start: entry.Time, Status: "failed"}, true
+	}
+	if m := pamFailure.FindStringSubmatch(entry.Message); m != nil && entry.Identifier != "sshd" {
+		tty := entry.Identifier
+		if s := pamService.FindStringSubmatch(entry.Message); s != nil {
+			tty = s[1]
+		}
+		return Login{Username: m[2], TTY: tty, Host: m[1], Start: entry.Time, Status: "failed"}, true
+	}
+	return Login{}, false
+}
+
+// isValidSessionID accepts logind session IDs such as "3" or "c1".
+func isValidSessionID(id string) bool {
+	if id == "" || len(id) > 32 {
+		return false
+	}
+	for _, c := range id {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
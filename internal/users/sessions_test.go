@@ -0,0 +1,143 @@
+package users
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"orbit/internal/journal"
+)
+
+const loginctlShow = `Id=3
+Name=alice
+User=1000
+TTY=pts/0
+RemoteHost=10.0.0.5
+Service=sshd
+Type=tty
+Class=user
+State=active
+Leader=1234
+TimestampMonotonic=3600000000
+IdleHint=yes
+IdleSinceHintMonotonic=7000000000
+
+Id=c1
+Name=alice
+User=1000
+TTY=
+RemoteHost=
+Service=systemd-user
+Type=unspecified
+Class=manager
+State=active
+Leader=1200
+TimestampMonotonic=3500000000
+IdleHint=no
+IdleSinceHintMonotonic=0
+
+Id=5
+Name=bob
+User=1001
+TTY=tty1
+RemoteHost=
+Service=login
+Type=tty
+Class=user
+State=active
+Leader=2000
+TimestampMonotonic=7100000000
+IdleHint=no
+IdleSinceHintMonotonic=0
+`
+
+func TestSessions(t *testing.T) {
+	calls := stub(t, map[string]string{
+		"loginctl list-sessions --no-legend": "      3 1000 alice -     pts/0 active no\n     c1 1000 alice -     -     active no\n      5 1001 bob   seat0 tty1  active no\n",
+		"loginctl show-session -p Id -p Name -p User -p TTY -p RemoteHost -p Service -p Type -p Class -p State -p Leader -p TimestampMonotonic -p IdleHint -p IdleSinceHintMonotonic 3 c1 5": loginctlShow,
+	})
+	if _, err := Sessions(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 2 {
+		t.Fatalf("unexpected commands: %q", *calls)
+	}
+
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	sessions := parseLoginctlSessions(loginctlShow, 2*time.Hour, now)
+	if len(sessions) != 2 {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+	alice := sessions[0]
+	if alice.ID != "3" || alice.RemoteHost != "10.0.0.5" || alice.TTY != "pts/0" || alice.Leader != "1234" ||
+		!alice.Since.Equal(now.Add(-time.Hour)) || alice.IdleSeconds != 200 {
+		t.Fatalf("unexpected session: %+v", alice)
+	}
+	if bob := sessions[1]; bob.IdleSeconds != 0 || bob.TTY != "tty1" {
+		t.Fatalf("unexpected session: %+v", bob)
+	}
+
+	who := parseWho("alice    pts/0        2024-01-10 10:12 00:05        1234 (10.0.0.5)\nbob      tty1         2024-01-10 11:58   .          2000\n", now)
+	if len(who) != 2 || who[0].IdleSeconds != 300 || who[0].RemoteHost != "10.0.0.5" || who[1].RemoteHost != "" ||
+		!who[1].Since.Equal(time.Date(2024, 1, 10, 11, 58, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected utmp sessions: %+v", who)
+	}
+
+	if err := TerminateSession("3"); err != nil || (*calls)[len(*calls)-1] != "loginctl terminate-session 3" {
+		t.Fatalf("unexpected terminate: %v %q", err, *calls)
+	}
+	if TerminateSession("3; reboot") == nil {
+		t.Fatal("expected an invalid session ID to be rejected")
+	}
+}
+
+func TestParseLast(t *testing.T) {
+	output := `bob      tty1         0.0.0.0          2024-01-10T12:00:00+00:00   still logged in
+alice    pts/0        10.0.0.5         2024-01-10T10:12:33+00:00 - 2024-01-10T11:00:01+00:00  (00:47)
+alice    pts/1        10.0.0.5         2024-01-09T09:00:00+00:00 - crash                      (01:00)
+carol    pts/2        10.0.0.7         2024-01-08T09:00:00+00:00   gone - no logout
+reboot   system boot  6.1.0-18-amd64   2024-01-08T08:00:00+00:00   still running
+
+wtmp begins 2024-01-01T00:00:00+00:00
+`
+	logins := parseLast(output, "")
+	if len(logins) != 4 {
+		t.Fatalf("unexpected logins: %+v", logins)
+	}
+	var got []string
+	for _, l := range logins {
+		got = append(got, l.Username+" "+l.Host+" "+l.Status)
+	}
+	if strings.Join(got, ",") != "bob  active,alice 10.0.0.5 logged out,alice 10.0.0.5 crash,carol 10.0.0.7 gone" {
+		t.Fatalf("unexpected logins: %q", got)
+	}
+	if end := logins[1].End; end == nil || end.Sub(logins[1].Start) != 47*time.Minute+28*time.Second {
+		t.Fatalf("unexpected end: %v", end)
+	}
+
+	failed := parseLast("root     ssh:notty    203.0.113.9      2024-01-10T10:00:00+0000 - 2024-01-10T10:00:00+0000  (00:00)\n", "failed")
+	if len(failed) != 1 || failed[0].Status != "failed" || failed[0].TTY != "ssh:notty" {
+		t.Fatalf("unexpected failed logins: %+v", failed)
+	}
+}
+
+func TestParseAuthFailure(t *testing.T) {
+	for _, tc := range []struct {
+		entry journal.Entry
+		want  string
+	}{
+		{journal.Entry{Identifier: "sshd", Message: "Failed password for invalid user admin from 203.0.113.9 port 51234 ssh2"}, "admin ssh 203.0.113.9"},
+		{journal.Entry{Identifier: "sshd", Message: "Failed publickey for alice from 10.0.0.5 port 2222 ssh2: ED25519 SHA256:abc"}, "alice ssh 10.0.0.5"},
+		{journal.Entry{Identifier: "sshd", Message: "pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=10.0.0.5  user=alice"}, ""},
+		{journal.Entry{Identifier: "su", Message: "pam_unix(su:auth): authentication failure; logname=bob uid=1001 euid=0 tty=/dev/pts/1 ruser=bob rhost=  user=root"}, "root su "},
+	} {
+		login, ok := parseAuthFailure(tc.entry)
+		got := ""
+		if ok {
+			got = login.Username + " " + login.TTY + " " + login.Host
+		}
+		if got != tc.want {
+			t.Errorf("parseAuthFailure(%q) = %q, want %q", tc.entry.Message, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package users
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"orbit/internal/util"
+)
+
+// minRSABits is the smallest RSA key accepted; DSA keys are always refused.
+const minRSABits = 2048
+
+// AuthorizedKey is a public key in a user's ~/.ssh/authorized_keys. Line is
+// its 1-based line number in the file.
+type AuthorizedKey struct {
+	Type        string   `json:"type"`
+	Bits        int      `json:"bits,omitempty"`
+	Fingerprint string   `json:"fingerprint"`
+	Comment     string   `json:"comment"`
+	Options     []string `json:"options"`
+	Line        int      `json:"line"`
+}
+
+// account is the passwd entry the key file belongs to.
+type account struct {
+	name, home, uid, gid string
+}
+
+// runInput runs a command through sudo with input on stdin.
+var runInput = func(input, command string, args ...string) (string, error) {
+	cmd := exec.Command("sudo", append([]string{"-n", command}, args...)...)
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// asUser runs commands as the key file's owner. Home directories are under
+// the user's control, so anything done in them as root could be redirected
+// through a symbolic link; as the user, a link only reaches what the user
+// could already read or write.
+func (acct account) asUser() runFunc {
+	return func(command string, args ...string) (string, error) {
+		return run("runuser", append([]string{"-u", acct.name, "--", command}, args...)...)
+	}
+}
+
+// ListKeys returns the keys in a user's authorized_keys. Lines that are not
+// valid keys are skipped here and kept when the file is rewritten.
+func ListKeys(username string) ([]AuthorizedKey, error) {
+	acct, err := lookupAccount(username)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readAuthorizedKeys(acct)
+	if err != nil {
+		return nil, err
+	}
+	return parseAuthorizedKeys(content), nil
+}
+
+// AddKey validates a single authorized_keys line, with optional options and
+// comment, and appends it to the user's file. Weak and already authorized
+// keys are rejected.
+func AddKey(username, line string) (*AuthorizedKey, error) {
+	acct, err := lookupAccount(username)
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" || strings.ContainsAny(line, "\r\n") {
+		return nil, fmt.Errorf("exactly one key is required")
+	}
+	pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	key := newAuthorizedKey(pub, comment, options)
+	if err := checkKeyStrength(key); err != nil {
+		return nil, err
+	}
+
+	content, err := readAuthorizedKeys(acct)
+	if err != nil {
+		return nil, err
+	}
+	existing := parseAuthorizedKeys(content)
+	for _, k := range existing {
+		if k.Fingerprint == key.Fingerprint {
+			return nil, fmt.Errorf("key %s is already authorized (line %d)", key.Fingerprint, k.Line)
+		}
+	}
+
+	// Re-render the line so only what the parser understood is written
+	normalized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if len(options) > 0 {
+		normalized = strings.Join(options, ",") + " " + normalized
+	}
+	if comment != "" {
+		normalized += " " + comment
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += normalized + "\n"
+	if err := writeAuthorizedKeys(acct, content); err != nil {
+		return nil, err
+	}
+	key.Line = strings.Count(content, "\n")
+	return &key, nil
+}
+
+// RemoveKey removes every line holding the key with the given SHA256
+// fingerprint.
+func RemoveKey(username, fingerprint string) error {
+	acct, err := lookupAccount(username)
+	if err != nil {
+		return err
+	}
+	content, err := readAuthorizedKeys(acct)
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	removed := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err == nil && ssh.FingerprintSHA256(pub) == fingerprint {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return fmt.Errorf("key not found: %s", fingerprint)
+	}
+	return writeAuthorizedKeys(acct, strings.Join(kept, ""))
+}
+
+func parseAuthorizedKeys(content string) []AuthorizedKey {
+	keys := []AuthorizedKey{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			continue
+		}
+		key := newAuthorizedKey(pub, comment, options)
+		key.Line = i + 1
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func newAuthorizedKey(pub ssh.PublicKey, comment string, options []string) AuthorizedKey {
+	if options == nil {
+		options = []string{}
+	}
+	return AuthorizedKey{
+		Type:        pub.Type(),
+		Bits:        keyBits(pub),
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		Comment:     comment,
+		Options:     options,
+	}
+}
+
+func keyBits(pub ssh.PublicKey) int {
+	if cert, ok := pub.(*ssh.Certificate); ok {
+		pub = cert.Key
+	}
+	crypto, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := crypto.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	case *dsa.PublicKey:
+		return k.P.BitLen()
+	}
+	return 0
+}
+
+func checkKeyStrength(key AuthorizedKey) error {
+	switch {
+	case strings.HasPrefix(key.Type, ssh.KeyAlgoDSA):
+		return fmt.Errorf("DSA keys are not accepted")
+	case strings.HasPrefix(key.Type, ssh.KeyAlgoRSA) && key.Bits < minRSABits:
+		return fmt.Errorf("RSA keys must have at least %d bits, this one has %d", minRSABits, key.Bits)
+	}
+	return nil
+}
+
+func lookupAccount(username string) (account, error) {
+	if !isValidUsername(username) {
+		return account{}, fmt.Errorf("invalid username: %s", username)
+	}
+	output, err := query("getent", "passwd", username)
+	parts := strings.Split(strings.TrimSpace(output), ":")
+	if err != nil || len(parts) < 7 {
+		return account{}, fmt.Errorf("user not found: %s", username)
+	}
+	acct := account{name: username, home: parts[5], uid: parts[2], gid: parts[3]}
+	if !isValidHome(acct.home) {
+		return account{}, fmt.Errorf("user %s has no usable home directory", username)
+	}
+	return acct, nil
+}
+
+// fileType returns stat's file type for path ("directory", "regular file",
+// "symbolic link", ...), or "" when it does not exist.
+func fileType(path string) (string, error) {
+	return statType(run, path)
+}
+
+func statType(r runFunc, path string) (string, error) {
+	output, err := r("stat", "-c", "%F", path)
+	if err != nil {
+		if strings.Contains(output, "No such file") {
+			return "", nil
+		}
+		return "", fmt.Errorf("cannot stat %s: %s", path, commandError(output, err))
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// readAuthorizedKeys returns the user's authorized_keys, empty when missing.
+// It is read as the user, so a link to a file the user cannot read fails;
+// symbolic links are refused as well.
+func readAuthorizedKeys(acct account) (string, error) {
+	path := filepath.Join(acct.home, ".ssh", "authorized_keys")
+	for _, p := range []string{filepath.Dir(path), path} {
+		t, err := statType(acct.asUser(), p)
+		if err != nil {
+			return "", err
+		}
+		if t == "" {
+			return "", nil
+		}
+		if t == "symbolic link" {
+			return "", fmt.Errorf("%s is a symbolic link", p)
+		}
+	}
+	output, err := acct.asUser()("cat", "--", path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", path, commandError(output, err))
+	}
+	return output, nil
+}
+
+// writeAuthorizedKeys replaces the user's authorized_keys atomically: the new
+// content is written to a temporary file in ~/.ssh with mode 0600, then
+// renamed over the old file. ~/.ssh is created with mode 0700 when missing.
+// Every step runs as the user.
+func writeAuthorizedKeys(acct account, content string) error {
+	sshDir := filepath.Join(acct.home, ".ssh")
+	dest := filepath.Join(sshDir, "authorized_keys")
+	user := acct.asUser()
+
+	homeType, err := statType(user, acct.home)
+	if err != nil {
+		return err
+	}
+	if homeType != "directory" {
+		return fmt.Errorf("home directory %s does not exist", acct.home)
+	}
+	dirType, err := statType(user, sshDir)
+	if err != nil {
+		return err
+	}
+	switch dirType {
+	case "":
+		if output, err := user("install", "-d", "-m", "0700", sshDir); err != nil {
+			return fmt.Errorf("failed to create %s: %s", sshDir, commandError(output, err))
+		}
+	case "directory":
+	default:
+		return fmt.Errorf("%s is not a directory", sshDir)
+	}
+
+	staging := filepath.Join(sshDir, ".authorized_keys.orbit-"+util.GenerateRandomString(8))
+	if output, err := user("install", "-m", "0600", "/dev/null", staging); err != nil {
+		return fmt.Errorf("failed to write %s: %s", dest, commandError(output, err))
+	}
+	output, err := runInput(content, "runuser", "-u", acct.name, "--", "dd", "of="+staging, "status=none")
+	if err == nil {
+		// mv -T renames over dest itself, never into it or through a link
+		output, err = user("mv", "-f", "-T", staging, dest)
+	}
+	if err != nil {
+		user("rm", "-f", staging)
+		return fmt.Errorf("failed to write %s: %s", dest, commandError(output, err))
+	}
+	return nil
+}
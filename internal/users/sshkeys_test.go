@@ -0,0 +1,158 @@
+package users
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeHome stands in for the privileged runner with an in-memory home
+// directory, so the commands used to read and replace the key file can be
+// checked along with the resulting content. Everything in the home directory
+// has to run as the user.
+type fakeHome struct {
+	types map[string]string
+	files map[string]string
+	calls []string
+}
+
+func (f *fakeHome) run(t *testing.T) runFunc {
+	return func(command string, args ...string) (string, error) {
+		f.calls = append(f.calls, strings.Join(append([]string{command}, args...), " "))
+		if command == "getent" {
+			return "dev:x:1001:1001:Dev:/home/dev:/bin/bash\n", nil
+		}
+		if command != "runuser" || len(args) < 4 || strings.Join(args[:3], " ") != "-u dev --" {
+			t.Fatalf("%s ran as root", strings.Join(append([]string{command}, args...), " "))
+		}
+		command, args = args[3], args[4:]
+		last := args[len(args)-1]
+		switch command {
+		case "stat":
+			if f.types[last] == "" {
+				return "stat: cannot statx '" + last + "': No such file or directory\n", os.ErrNotExist
+			}
+			return f.types[last] + "\n", nil
+		case "cat":
+			return f.files[last], nil
+		case "install":
+			if args[0] == "-d" {
+				f.types[last] = "directory"
+				return "", nil
+			}
+			f.types[last], f.files[last] = "regular file", ""
+		case "mv":
+			src := args[len(args)-2]
+			f.types[last], f.files[last] = f.types[src], f.files[src]
+			delete(f.types, src)
+			delete(f.files, src)
+		}
+		return "", nil
+	}
+}
+
+// runInput takes what is piped to `dd of=` as the user.
+func (f *fakeHome) runInput(t *testing.T) func(input, command string, args ...string) (string, error) {
+	return func(input, command string, args ...string) (string, error) {
+		cmdline := strings.Join(append([]string{command}, args...), " ")
+		f.calls = append(f.calls, cmdline)
+		if !strings.HasPrefix(cmdline, "runuser -u dev -- dd of=") {
+			t.Fatalf("unexpected command: %s", cmdline)
+		}
+		path := strings.TrimPrefix(args[4], "of=")
+		if f.types[path] != "regular file" {
+			t.Fatalf("%s was not created with mode 0600 first", path)
+		}
+		f.files[path] = input
+		return "", nil
+	}
+}
+
+func authorizedLine(t *testing.T, key interface{}, comment string) string {
+	pub, err := ssh.NewPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) + " " + comment
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	home := &fakeHome{types: map[string]string{"/home/dev": "directory"}, files: map[string]string{}}
+	fn := home.run(t)
+	oldRun, oldQuery, oldRunInput := run, query, runInput
+	run, query, runInput = fn, fn, home.runInput(t)
+	t.Cleanup(func() { run, query, runInput = oldRun, oldQuery, oldRunInput })
+
+	edKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public()
+	ed := authorizedLine(t, edKey, "dev@laptop")
+	key, err := AddKey("dev", `from="10.0.0.0/8",no-agent-forwarding `+ed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Type != "ssh-ed25519" || key.Bits != 256 || key.Comment != "dev@laptop" || len(key.Options) != 2 || key.Line != 1 {
+		t.Fatalf("unexpected key: %+v", key)
+	}
+	if home.types["/home/dev/.ssh"] != "directory" || !strings.Contains(strings.Join(home.calls, "\n"), "runuser -u dev -- install -d -m 0700 /home/dev/.ssh") {
+		t.Fatalf("~/.ssh was not created:\n%s", strings.Join(home.calls, "\n"))
+	}
+	last := home.calls[len(home.calls)-1]
+	if !strings.HasPrefix(last, "runuser -u dev -- mv -f -T /home/dev/.ssh/.authorized_keys.orbit-") || !strings.HasSuffix(last, " /home/dev/.ssh/authorized_keys") {
+		t.Fatalf("unexpected final command: %s", last)
+	}
+	if len(home.files) != 1 {
+		t.Fatalf("staging file left behind: %v", home.files)
+	}
+
+	if _, err := AddKey("dev", ed+" again"); err == nil || !strings.Contains(err.Error(), "already authorized") {
+		t.Fatalf("expected a duplicate to be rejected, got %v", err)
+	}
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddKey("dev", authorizedLine(t, &weak.PublicKey, "old")); err == nil || !strings.Contains(err.Error(), "2048") {
+		t.Fatalf("expected a 1024-bit RSA key to be rejected, got %v", err)
+	}
+	for _, bad := range []string{"", "ssh-ed25519 AAAAnotbase64", ed + "\n" + ed} {
+		if _, err := AddKey("dev", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+
+	strong, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	home.files["/home/dev/.ssh/authorized_keys"] += "# deploy key\n"
+	if _, err := AddKey("dev", authorizedLine(t, &strong.PublicKey, "ci")); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ListKeys("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[1].Type != "ssh-rsa" || keys[1].Bits != 2048 || keys[1].Line != 3 {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	if err := RemoveKey("dev", key.Fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	content := home.files["/home/dev/.ssh/authorized_keys"]
+	if strings.Contains(content, "dev@laptop") || !strings.HasPrefix(content, "# deploy key\nssh-rsa ") {
+		t.Fatalf("unexpected content after removal:\n%s", content)
+	}
+	if err := RemoveKey("dev", key.Fingerprint); err == nil {
+		t.Fatal("expected removing a missing key to fail")
+	}
+
+	home.types["/home/dev/.ssh/authorized_keys"] = "symbolic link"
+	if _, err := ListKeys("dev"); err == nil {
+		t.Fatal("expected a symlinked key file to be refused")
+	}
+}
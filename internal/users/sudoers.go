@@ -0,0 +1,435 @@
+package users
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"orbit/internal/util"
+)
+
+// sudoersPath is the main sudoers file, which Orbit reads but never writes;
+// drop-ins are managed in sudoersDir.
+var (
+	sudoersPath = "/etc/sudoers"
+	sudoersDir  = "/etc/sudoers.d"
+)
+
+// SudoRule is a user specification from a sudoers file, such as
+// "%sudo ALL=(ALL:ALL) ALL". Users holds the names, %groups and aliases it
+// applies to.
+type SudoRule struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Users    []string `json:"users"`
+	Hosts    string   `json:"hosts"`
+	RunAs    string   `json:"runAs"`
+	Commands string   `json:"commands"`
+	NoPasswd bool     `json:"noPasswd"`
+	Raw      string   `json:"raw"`
+}
+
+// SudoGrant is a rule as it applies to one user. Via is "user" for rules
+// naming the user, the %group it is a member of, or the User_Alias.
+type SudoGrant struct {
+	Username string `json:"username"`
+	Via      string `json:"via"`
+	SudoRule
+}
+
+// SudoersFile is a drop-in in /etc/sudoers.d. sudo skips Ignored files,
+// whose names contain a dot or end in "~".
+type SudoersFile struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Ignored bool   `json:"ignored"`
+}
+
+// SudoAccess is the effective sudo configuration: the grants per user, the
+// rules they come from and the drop-in files.
+type SudoAccess struct {
+	Grants []SudoGrant   `json:"grants"`
+	Rules  []SudoRule    `json:"rules"`
+	Files  []SudoersFile `json:"files"`
+}
+
+// Sudo reads /etc/sudoers and its drop-ins and resolves who may run what.
+func Sudo() (*SudoAccess, error) {
+	main, err := readRootFile(sudoersPath)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ListSudoers()
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string][]string)
+	rules := parseSudoers(sudoersPath, main, aliases)
+	for _, f := range files {
+		if !f.Ignored {
+			rules = append(rules, parseSudoers(f.Path, f.Content, aliases)...)
+		}
+	}
+	if rules == nil {
+		rules = []SudoRule{}
+	}
+
+	users, err := List(true)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	return &SudoAccess{Grants: resolveSudo(rules, aliases, users, groups), Rules: rules, Files: files}, nil
+}
+
+// ListSudoers returns the drop-ins in /etc/sudoers.d with their content.
+func ListSudoers() ([]SudoersFile, error) {
+	output, err := run("ls", "-1A", sudoersDir)
+	if err != nil {
+		if strings.Contains(output, "No such file") {
+			return []SudoersFile{}, nil
+		}
+		return nil, fmt.Errorf("cannot list %s: %s", sudoersDir, commandError(output, err))
+	}
+	files := []SudoersFile{}
+	for _, name := range strings.Split(strings.TrimSpace(output), "\n") {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(sudoersDir, name)
+		if t, err := fileType(path); err != nil || t != "regular file" {
+			continue
+		}
+		content, err := readRootFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, SudoersFile{
+			Name:    name,
+			Path:    path,
+			Content: content,
+			Ignored: strings.Contains(name, ".") || strings.HasSuffix(name, "~"),
+		})
+	}
+	return files, nil
+}
+
+// SaveSudoers creates or replaces a drop-in. The content is checked with
+// `visudo -cf` first and installed as root:root 0440 by renaming it into
+// place, so sudo never reads a partial file. If the complete configuration
+// no longer passes `visudo -c`, or Orbit can no longer use sudo, the previous
+// file is restored.
+func SaveSudoers(name, content string) error {
+	if err := checkDropInName(name); err != nil {
+		return err
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	tmp, err := os.CreateTemp("", "orbit-sudoers-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(content)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+	if output, err := run("visudo", "-cf", tmp.Name()); err != nil {
+		msg := strings.ReplaceAll(commandError(output, err), tmp.Name(), name)
+		return fmt.Errorf("sudoers syntax check failed: %s", msg)
+	}
+
+	path := filepath.Join(sudoersDir, name)
+	previous, err := fileType(path)
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		// Keep the old file under a name sudo ignores until the new one is
+		// known to be good
+		if output, err := run("cp", "-p", path, path+".orbit-old"); err != nil {
+			return fmt.Errorf("failed to back up %s: %s", path, commandError(output, err))
+		}
+		defer run("rm", "-f", path+".orbit-old")
+	}
+	if err := installSudoers(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	if err := verifySudoers(); err != nil {
+		revert := rollbackRunner()
+		if previous != "" {
+			revert("mv", "-f", "-T", path+".orbit-old", path)
+		} else {
+			revert("rm", "-f", path)
+		}
+		return fmt.Errorf("%v, change reverted", err)
+	}
+	return nil
+}
+
+// DeleteSudoers removes a drop-in. It is moved aside first and put back if
+// the remaining configuration fails the same checks as SaveSudoers.
+func DeleteSudoers(name string) error {
+	if err := checkDropInName(name); err != nil {
+		return err
+	}
+	path := filepath.Join(sudoersDir, name)
+	t, err := fileType(path)
+	if err != nil {
+		return err
+	}
+	if t == "" {
+		return fmt.Errorf("sudoers file not found: %s", name)
+	}
+	if output, err := run("mv", "-f", "-T", path, path+".orbit-old"); err != nil {
+		return fmt.Errorf("failed to delete %s: %s", path, commandError(output, err))
+	}
+	if err := verifySudoers(); err != nil {
+		rollbackRunner()("mv", "-f", "-T", path+".orbit-old", path)
+		return fmt.Errorf("%v, file restored", err)
+	}
+	run("rm", "-f", path+".orbit-old")
+	return nil
+}
+
+// verifySudoers checks the complete configuration with `visudo -c`, then
+// that Orbit can still run commands through `sudo -n`, which rules such as
+// "root ALL=(ALL) !ALL" or "Defaults requiretty" would prevent.
+func verifySudoers() error {
+	if output, err := run("visudo", "-c"); err != nil {
+		return fmt.Errorf("sudoers configuration check failed: %s", commandError(output, err))
+	}
+	if output, err := run("true"); err != nil {
+		return fmt.Errorf("the change would stop Orbit from using sudo: %s", commandError(output, err))
+	}
+	return nil
+}
+
+// rollbackRunner returns the runner that undoes a sudoers change. When the
+// change broke sudo, only running without it can, which works as root.
+func rollbackRunner() runFunc {
+	if os.Geteuid() == 0 {
+		return query
+	}
+	return run
+}
+
+func installSudoers(src, dest string) error {
+	staging := filepath.Join(sudoersDir, ".orbit-"+util.GenerateRandomString(8))
+	if output, err := run("install", "-o", "root", "-g", "root", "-m", "0440", src, staging); err != nil {
+		return fmt.Errorf("failed to write %s: %s", dest, commandError(output, err))
+	}
+	if output, err := run("mv", "-f", "-T", staging, dest); err != nil {
+		run("rm", "-f", staging)
+		return fmt.Errorf("failed to write %s: %s", dest, commandError(output, err))
+	}
+	return nil
+}
+
+// checkDropInName accepts names sudo reads: no dot, no trailing "~".
+func checkDropInName(name string) error {
+	if name == "" || len(name) > 64 {
+		return fmt.Errorf("invalid sudoers file name: %s", name)
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_') {
+			return fmt.Errorf("invalid sudoers file name: %s", name)
+		}
+	}
+	return nil
+}
+
+func readRootFile(path string) (string, error) {
+	output, err := run("cat", "--", path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", path, commandError(output, err))
+	}
+	return output, nil
+}
+
+// sudoTag matches a command tag such as "NOPASSWD:" before the commands.
+var sudoTag = regexp.MustCompile(`^([A-Z_]+):\s*`)
+
+// parseSudoers reads the user specifications of a sudoers file and adds its
+// User_Alias definitions to aliases. Defaults, other aliases and include
+// directives are skipped.
+func parseSudoers(file, content string, aliases map[string][]string) []SudoRule {
+	var rules []SudoRule
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := lines[i]
+		// A trailing backslash continues the line
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimRight(strings.TrimSuffix(line, "\\"), " \t") + " " + strings.TrimSpace(lines[i])
+		}
+		line = stripSudoersComment(line)
+		if line == "" || strings.HasPrefix(line, "@include") || strings.HasPrefix(line, "Defaults") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "User_Alias":
+			for _, def := range strings.Split(strings.TrimPrefix(line, "User_Alias"), ":") {
+				name, members, ok := strings.Cut(def, "=")
+				if ok {
+					aliases[strings.TrimSpace(name)] = splitSudoList(members)
+				}
+			}
+			continue
+		case "Host_Alias", "Runas_Alias", "Cmnd_Alias", "Cmd_Alias":
+			continue
+		}
+
+		left, right, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		who := strings.Fields(left)
+		if len(who) < 2 {
+			continue
+		}
+		rule := SudoRule{
+			File:  file,
+			Line:  lineNo,
+			Users: splitSudoList(strings.Join(who[:len(who)-1], " ")),
+			Hosts: who[len(who)-1],
+			Raw:   strings.TrimSpace(line),
+		}
+		right = strings.TrimSpace(right)
+		if strings.HasPrefix(right, "(") {
+			if end := strings.Index(right, ")"); end > 0 {
+				rule.RunAs = right[1:end]
+				right = strings.TrimSpace(right[end+1:])
+			}
+		}
+		for {
+			m := sudoTag.FindStringSubmatch(right)
+			if m == nil {
+				break
+			}
+			switch m[1] {
+			case "NOPASSWD":
+				rule.NoPasswd = true
+			case "PASSWD":
+				rule.NoPasswd = false
+			}
+			right = right[len(m[0]):]
+		}
+		rule.Commands = right
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// stripSudoersComment removes a "#" comment. "#include" lines are treated as
+// comments too; "#1000" at the start of a list is a UID, not a comment.
+func stripSudoersComment(line string) string {
+	line = strings.TrimSpace(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] != '#' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' && (i == 0 || strings.ContainsRune(" ,%!", rune(line[i-1]))) {
+			continue
+		}
+		return strings.TrimSpace(line[:i])
+	}
+	return line
+}
+
+func splitSudoList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// resolveSudo expands the rules to the users they apply to. Negated entries
+// ("!alice") are left out, as is anything that names no existing user.
+func resolveSudo(rules []SudoRule, aliases map[string][]string, users []User, groups []Group) []SudoGrant {
+	byUID := make(map[string]string)
+	for _, u := range users {
+		byUID[u.UID] = u.Username
+	}
+	members := func(g Group) []string {
+		return append(append([]string{}, g.Members...), g.PrimaryMembers...)
+	}
+
+	grants := []SudoGrant{}
+	seen := make(map[string]bool)
+	add := func(username, via string, rule SudoRule) {
+		key := fmt.Sprintf("%s\x00%s\x00%s:%d", username, via, rule.File, rule.Line)
+		if !seen[key] {
+			seen[key] = true
+			grants = append(grants, SudoGrant{Username: username, Via: via, SudoRule: rule})
+		}
+	}
+
+	var expand func(entry, via string, rule SudoRule, depth int)
+	expand = func(entry, via string, rule SudoRule, depth int) {
+		switch {
+		case depth > 8 || strings.HasPrefix(entry, "!"):
+		case entry == "ALL":
+			for _, u := range users {
+				add(u.Username, "ALL", rule)
+			}
+		case strings.HasPrefix(entry, "%#"):
+			for _, g := range groups {
+				if g.GID == entry[2:] {
+					for _, m := range members(g) {
+						add(m, "%"+g.Name, rule)
+					}
+				}
+			}
+		case strings.HasPrefix(entry, "%"):
+			name := strings.TrimPrefix(strings.TrimPrefix(entry, "%"), ":")
+			for _, g := range groups {
+				if g.Name == name {
+					for _, m := range members(g) {
+						add(m, "%"+g.Name, rule)
+					}
+				}
+			}
+		case strings.HasPrefix(entry, "#"):
+			if name, ok := byUID[entry[1:]]; ok {
+				add(name, via, rule)
+			}
+		case aliases[entry] != nil:
+			for _, member := range aliases[entry] {
+				expand(member, entry, rule, depth+1)
+			}
+		default:
+			for _, u := range users {
+				if u.Username == entry {
+					add(entry, via, rule)
+				}
+			}
+		}
+	}
+	for _, rule := range rules {
+		for _, entry := range rule.Users {
+			expand(entry, "user", rule, 0)
+		}
+	}
+
+	sort.SliceStable(grants, func(i, j int) bool { return grants[i].Username < grants[j].Username })
+	return grants
+}
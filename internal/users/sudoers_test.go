@@ -0,0 +1,139 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testSudoers = `# /etc/sudoers
+Defaults	env_reset
+Defaults	secure_path="/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin"
+
+User_Alias OPS = bob, %docker
+Cmnd_Alias RESTART = /usr/bin/systemctl restart nginx
+
+root	ALL=(ALL:ALL) ALL
+%sudo	ALL=(ALL:ALL) ALL  # admins
+OPS ALL = (root) NOPASSWD: RESTART, \
+	/usr/bin/journalctl
+
+@includedir /etc/sudoers.d
+`
+
+func TestSudo(t *testing.T) {
+	stub(t, map[string]string{
+		"cat -- /etc/sudoers":               testSudoers,
+		"ls -1A /etc/sudoers.d":             "README\ndeploy\norbit\nold.bak\n",
+		"stat -c %F /etc/sudoers.d/README":  "regular file\n",
+		"stat -c %F /etc/sudoers.d/deploy":  "regular file\n",
+		"stat -c %F /etc/sudoers.d/orbit":   "regular file\n",
+		"stat -c %F /etc/sudoers.d/old.bak": "regular file\n",
+		"cat -- /etc/sudoers.d/README":      "# Files in this directory are read by sudo\n",
+		"cat -- /etc/sudoers.d/deploy":      "#1000 ALL=(www-data) NOPASSWD: /usr/bin/rsync\n",
+		"cat -- /etc/sudoers.d/orbit":       "orbit ALL=(ALL) NOPASSWD: ALL\n",
+		"cat -- /etc/sudoers.d/old.bak":     "bob ALL=(ALL) ALL\n",
+		"getent passwd":                     getentPasswd,
+		"getent group":                      getentGroup,
+	})
+
+	access, err := Sudo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(access.Files) != 4 || !access.Files[3].Ignored || access.Files[1].Ignored {
+		t.Fatalf("unexpected files: %+v", access.Files)
+	}
+	if len(access.Rules) != 5 {
+		t.Fatalf("unexpected rules: %+v", access.Rules)
+	}
+	ops := access.Rules[2]
+	if ops.Line != 10 || ops.RunAs != "root" || !ops.NoPasswd || ops.Commands != "RESTART, /usr/bin/journalctl" ||
+		strings.Join(ops.Users, ",") != "OPS" {
+		t.Fatalf("unexpected OPS rule: %+v", ops)
+	}
+	if r := access.Rules[1]; r.Commands != "ALL" || r.NoPasswd || r.RunAs != "ALL:ALL" {
+		t.Fatalf("unexpected %%sudo rule: %+v", r)
+	}
+
+	var got []string
+	for _, g := range access.Grants {
+		got = append(got, g.Username+" via "+g.Via+" "+g.File)
+	}
+	want := []string{
+		"alice via %sudo /etc/sudoers",
+		"alice via %docker /etc/sudoers",
+		"alice via user /etc/sudoers.d/deploy",
+		"bob via %sudo /etc/sudoers",
+		"bob via OPS /etc/sudoers",
+		"root via user /etc/sudoers",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected grants:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestSaveSudoers(t *testing.T) {
+	var calls []string
+	visudoFails, sudoFails := false, false
+	fn := func(command string, args ...string) (string, error) {
+		cmdline := strings.Join(append([]string{command}, args...), " ")
+		calls = append(calls, cmdline)
+		switch {
+		case command == "visudo" && args[0] == "-cf" && visudoFails:
+			return args[1] + ":1:5: syntax error\n", errors.New("exit status 1")
+		case command == "true" && sudoFails:
+			return "sudo: a password is required\n", errors.New("exit status 1")
+		case cmdline == "stat -c %F /etc/sudoers.d/deploy":
+			return "regular file\n", nil
+		}
+		return "", nil
+	}
+	oldRun, oldQuery := run, query
+	run, query = fn, fn
+	t.Cleanup(func() { run, query = oldRun, oldQuery })
+
+	if err := SaveSudoers("deploy", "alice ALL=(ALL) /usr/bin/rsync"); err != nil {
+		t.Fatal(err)
+	}
+	var sequence []string
+	for _, c := range calls {
+		sequence = append(sequence, strings.Fields(c)[0])
+	}
+	if strings.Join(sequence, " ") != "visudo stat cp install mv visudo true rm" {
+		t.Fatalf("unexpected commands:\n%s", strings.Join(calls, "\n"))
+	}
+	if install := calls[3]; !strings.HasPrefix(install, "install -o root -g root -m 0440 ") || !strings.Contains(install, " /etc/sudoers.d/.orbit-") {
+		t.Fatalf("unexpected install: %s", install)
+	}
+
+	calls, visudoFails = nil, true
+	err := SaveSudoers("deploy", "alice ALL=")
+	if err == nil || !strings.Contains(err.Error(), "deploy:1:5: syntax error") || len(calls) != 1 {
+		t.Fatalf("expected the syntax check to stop the change, got %v after %q", err, calls)
+	}
+
+	calls, visudoFails, sudoFails = nil, false, true
+	err = SaveSudoers("deploy", "root ALL=(ALL) !ALL")
+	if err == nil || !strings.Contains(err.Error(), "stop Orbit from using sudo") {
+		t.Fatalf("expected a change breaking sudo to be refused, got %v", err)
+	}
+	if got := strings.Join(calls, "\n"); !strings.Contains(got, "mv -f -T /etc/sudoers.d/deploy.orbit-old /etc/sudoers.d/deploy") {
+		t.Fatalf("the previous file was not restored:\n%s", got)
+	}
+
+	calls = nil
+	if err := DeleteSudoers("deploy"); err == nil || !strings.Contains(err.Error(), "file restored") {
+		t.Fatalf("expected a deletion breaking sudo to be reverted, got %v", err)
+	}
+	if got := strings.Join(calls, "\n"); strings.Contains(got, "rm ") || !strings.HasSuffix(got, "mv -f -T /etc/sudoers.d/deploy.orbit-old /etc/sudoers.d/deploy") {
+		t.Fatalf("unexpected commands:\n%s", got)
+	}
+
+	sudoFails = false
+	for _, name := range []string{"deploy.bak", "../sudoers", ""} {
+		if SaveSudoers(name, "") == nil || DeleteSudoers(name) == nil {
+			t.Errorf("expected %q to be refused", name)
+		}
+	}
+}
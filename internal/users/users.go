@@ -9,22 +9,74 @@ import (
 	"orbit/internal/util"
 )
 
+// runFunc runs a command and returns its combined output. run goes through
+// sudo for changes; query runs directly and is used for lookups.
+type runFunc func(command string, args ...string) (string, error)
+
+var (
+	run   runFunc = util.RunCommand
+	query runFunc = util.RunCommandNoSudo
+)
+
+// chpasswd feeds user:password lines to chpasswd on stdin, keeping passwords
+// off the command line.
+var chpasswd = func(input string) error {
+	cmd := exec.Command("sudo", "-n", "chpasswd")
+	cmd.Stdin = bytes.NewBufferString(input)
+	return cmd.Run()
+}
+
+// User is a local account. Groups lists its supplementary groups; the primary
+// group is GID. System users are those outside the UID_MIN..UID_MAX range of
+// /etc/login.defs. Expires and Aging come from /etc/shadow and are left out
+// when it cannot be read.
 type User struct {
-	Username string `json:"username"`
-	UID      string `json:"uid"`
-	GID      string `json:"gid"`
-	Home     string `json:"home"`
-	Shell    string `json:"shell"`
-	Locked   bool   `json:"locked"`
+	Username string   `json:"username"`
+	UID      string   `json:"uid"`
+	GID      string   `json:"gid"`
+	Comment  string   `json:"comment"`
+	Home     string   `json:"home"`
+	Shell    string   `json:"shell"`
+	Locked   bool     `json:"locked"`
+	System   bool     `json:"system"`
+	Groups   []string `json:"groups"`
+	Expires  string   `json:"expires,omitempty"`
+	Aging    *Aging   `json:"aging,omitempty"`
+	// Quotas is the user's disk usage on quota-enabled filesystems
+	Quotas []QuotaEntry `json:"quotas,omitempty"`
+}
+
+// CreateOptions are the optional settings of a new user. Without a
+// PrimaryGroup useradd creates a group named after the user; Shell defaults
+// to /bin/bash and Home to useradd's default.
+type CreateOptions struct {
+	PrimaryGroup string   `json:"primaryGroup"`
+	Groups       []string `json:"groups"`
+	Shell        string   `json:"shell"`
+	Home         string   `json:"home"`
+	Comment      string   `json:"comment"`
 }
 
-func List() ([]User, error) {
-	output, err := util.RunCommandNoSudo("getent", "passwd")
+// List returns the local users, leaving out system users unless
+// includeSystem is set.
+func List(includeSystem bool) ([]User, error) {
+	output, err := query("getent", "passwd")
 	if err != nil {
 		return nil, err
 	}
+	groups, err := ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	// Only root can read /etc/shadow
+	shadow := map[string]shadowEntry{}
+	if out, err := run("getent", "shadow"); err == nil {
+		shadow = parseShadow(out)
+	}
+	uidMin, uidMax := uidRange()
+	quotas := userQuotas()
 
-	var users []User
+	users := []User{}
 	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
 		if line == "" {
 			continue
@@ -32,15 +84,29 @@ func List() ([]User, error) {
 		parts := strings.Split(line, ":")
 		if len(parts) >= 7 {
 			username := parts[0]
+			system := isSystemUID(parts[2], uidMin, uidMax)
+			if system && !includeSystem {
+				continue
+			}
 			locked := isUserLocked(username)
-			users = append(users, User{
+			user := User{
 				Username: username,
 				UID:      parts[2],
 				GID:      parts[3],
+				Comment:  parts[4],
 				Home:     parts[5],
 				Shell:    parts[6],
 				Locked:   locked,
-			})
+				System:   system,
+				Groups:   supplementaryGroups(groups, username),
+			}
+			if entry, ok := shadow[username]; ok {
+				user.Expires = entry.expires
+				aging := entry.aging
+				user.Aging = &aging
+			}
+			user.Quotas = quotas[username]
+			users = append(users, user)
 		}
 	}
 	return users, nil
@@ -51,7 +117,7 @@ func isUserLocked(username string) bool {
 	if !isValidUsername(username) {
 		return false
 	}
-	output, err := util.RunCommand("passwd", "-S", username)
+	output, err := run("passwd", "-S", username)
 	if err != nil {
 		// If command fails, assume not locked (user might not exist)
 		return false
@@ -60,23 +126,56 @@ func isUserLocked(username string) bool {
 	return strings.Contains(output, " L ")
 }
 
-func Create(username, password string) error {
+func Create(username, password string, opts CreateOptions) error {
 	// Validate username to prevent injection
 	if !isValidUsername(username) {
 		return fmt.Errorf("invalid username: %s", username)
 	}
-	
+	if strings.ContainsAny(password, "\r\n") {
+		return fmt.Errorf("invalid password")
+	}
+	shell := opts.Shell
+	if shell == "" {
+		shell = "/bin/bash"
+	}
+	if err := validateShell(shell); err != nil {
+		return err
+	}
+	args := []string{"-m", "-s", shell}
+	if opts.Home != "" {
+		if !isValidHome(opts.Home) {
+			return fmt.Errorf("invalid home directory: %s", opts.Home)
+		}
+		args = append(args, "-d", opts.Home)
+	}
+	if opts.Comment != "" {
+		if !isValidComment(opts.Comment) {
+			return fmt.Errorf("invalid comment")
+		}
+		args = append(args, "-c", opts.Comment)
+	}
+	if opts.PrimaryGroup != "" {
+		if !isValidGroupName(opts.PrimaryGroup) {
+			return fmt.Errorf("invalid group name: %s", opts.PrimaryGroup)
+		}
+		args = append(args, "-g", opts.PrimaryGroup)
+	}
+	if len(opts.Groups) > 0 {
+		if err := validateGroupNames(opts.Groups); err != nil {
+			return err
+		}
+		args = append(args, "-G", strings.Join(opts.Groups, ","))
+	}
+
 	// Create user
-	_, err := util.RunCommand("useradd", "-m", "-s", "/bin/bash", username)
+	output, err := run("useradd", append(args, username)...)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create user %s: %s", username, commandError(output, err))
 	}
 
 	// BUG FIX: Set password via stdin pipe
 	if password != "" {
-		cmd := exec.Command("sudo", "-n", "chpasswd")
-		cmd.Stdin = bytes.NewBufferString(username + ":" + password)
-		if err := cmd.Run(); err != nil {
+		if err := chpasswd(username + ":" + password); err != nil {
 			return fmt.Errorf("failed to set password: %v", err)
 		}
 	}
@@ -89,11 +188,11 @@ func Delete(username string) error {
 	if !isValidUsername(username) {
 		return fmt.Errorf("invalid username: %s", username)
 	}
-	output, err := util.RunCommand("userdel", "-r", username)
+	output, err := run("userdel", "-r", username)
 	if err != nil {
 		// userdel exit status 8 usually means "user is currently logged in"
 		if strings.Contains(output, "currently logged in") {
-			return fmt.Errorf("cannot delete user %s: user is currently logged in", username)
+			return fmt.Errorf("cannot delete user %s: user is currently logged in, terminate the sessions first", username)
 		}
 		return fmt.Errorf("failed to delete user %s: %v", username, err)
 	}
@@ -105,7 +204,7 @@ func Lock(username string) error {
 	if !isValidUsername(username) {
 		return fmt.Errorf("invalid username: %s", username)
 	}
-	_, err := util.RunCommand("usermod", "-L", username)
+	_, err := run("usermod", "-L", username)
 	return err
 }
 
@@ -114,7 +213,7 @@ func Unlock(username string) error {
 	if !isValidUsername(username) {
 		return fmt.Errorf("invalid username: %s", username)
 	}
-	_, err := util.RunCommand("usermod", "-U", username)
+	_, err := run("usermod", "-U", username)
 	return err
 }
 
@@ -123,11 +222,13 @@ func ChangePassword(username, password string) error {
 	if !isValidUsername(username) {
 		return fmt.Errorf("invalid username: %s", username)
 	}
+	// chpasswd reads one user:password pair per line
+	if password == "" || strings.ContainsAny(password, "\r\n") {
+		return fmt.Errorf("invalid password")
+	}
 	
 	// Set password via stdin pipe
-	cmd := exec.Command("sudo", "-n", "chpasswd")
-	cmd.Stdin = bytes.NewBufferString(username + ":" + password)
-	if err := cmd.Run(); err != nil {
+	if err := chpasswd(username + ":" + password); err != nil {
 		return fmt.Errorf("failed to change password: %v", err)
 	}
 	return nil
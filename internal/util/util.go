@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -88,3 +89,9 @@ func RunCommandNoSudo(command string, args ...string) (string, error) {
 	return string(output), err
 }
 
+// CommandContext returns a sudo-wrapped command bound to ctx, for callers that
+// need to stream output instead of waiting for it.
+func CommandContext(ctx context.Context, command string, args ...string) *exec.Cmd {
+	fullArgs := append([]string{"-n", command}, args...)
+	return exec.CommandContext(ctx, "sudo", fullArgs...)
+}
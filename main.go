@@ -15,6 +15,8 @@ import (
 	"orbit/internal/auth"
 	"orbit/internal/config"
 	"orbit/internal/middleware"
+	"orbit/internal/packages"
+	"orbit/internal/services"
 )
 
 const Version = "1.2.1"
@@ -42,6 +44,15 @@ func main() {
 	// Initialize auth
 	auth.Init(cfg)
 
+	// Pick the package manager backend (apt or dnf/yum)
+	log.Printf("Package manager: %s", packages.Detect().Name())
+
+	// Watch for failed units in the background
+	services.StartWatcher(services.WatcherConfig{
+		CriticalUnits: cfg.CriticalUnits,
+		AlertWebhook:  cfg.AlertWebhook,
+	})
+
 	handler := middleware.SecurityHeaders(
 		middleware.CSRF(
 			middleware.AuditLog(
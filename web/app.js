@@ -456,27 +456,48 @@ function displayPackages(packages) {
     `;
 }
 
+// describePlan summarises a previewed package transaction for confirmation.
+function describePlan(plan) {
+    const list = (items) => items.map(i => i.name + (i.newVersion ? ` ${i.newVersion}` : '')).join(', ');
+    const lines = [];
+    if (plan.install.length) lines.push(`Install: ${list(plan.install)}`);
+    if (plan.upgrade.length) lines.push(`Upgrade: ${list(plan.upgrade)}`);
+    if (plan.remove.length) lines.push(`REMOVE: ${list(plan.remove)}`);
+    if (!lines.length) lines.push('Nothing to do.');
+    lines.push(`Download: ${formatBytes(plan.downloadSize)}`);
+    lines.push(plan.diskDelta < 0
+        ? `Disk space freed: ${formatBytes(-plan.diskDelta)}`
+        : `Disk space used: ${formatBytes(plan.diskDelta)}`);
+    return lines.join('\n');
+}
+
+// changePackage previews an install or removal and runs it once the user
+// confirms that exact plan.
+async function changePackage(action, name, purge) {
+    const body = { package: name, purge };
+    const plan = await api(`/packages/${action}/preview`, {
+        method: 'POST',
+        body: JSON.stringify(body),
+    });
+    if (!confirm(`${describePlan(plan)}\n\nProceed?`)) return false;
+    await api(`/packages/${action}`, {
+        method: 'POST',
+        body: JSON.stringify({ ...body, token: plan.token }),
+    });
+    return true;
+}
+
 window.removePackage = async function(name) {
-    if (!confirm(`Remove package ${name}?`)) return;
     try {
-        await api('/packages/remove', {
-            method: 'POST',
-            body: JSON.stringify({ package: name, purge: false }),
-        });
-        loadPackages();
+        if (await changePackage('remove', name, false)) loadPackages();
     } catch (error) {
         alert('Failed to remove package: ' + error.message);
     }
 };
 
 window.purgePackage = async function(name) {
-    if (!confirm(`Purge package ${name} (including config files)?`)) return;
     try {
-        await api('/packages/remove', {
-            method: 'POST',
-            body: JSON.stringify({ package: name, purge: true }),
-        });
-        loadPackages();
+        if (await changePackage('remove', name, true)) loadPackages();
     } catch (error) {
         alert('Failed to purge package: ' + error.message);
     }
@@ -500,10 +521,7 @@ document.getElementById('btnInstallPackage')?.addEventListener('click', async ()
     const pkg = prompt('Enter package name to install:');
     if (!pkg) return;
     try {
-        await api('/packages/install', {
-            method: 'POST',
-            body: JSON.stringify({ package: pkg }),
-        });
+        if (!await changePackage('install', pkg, false)) return;
         alert('Package installed successfully');
         loadPackages();
     } catch (error) {
@@ -522,9 +540,10 @@ document.getElementById('btnUpdate').addEventListener('click', async () => {
 });
 
 document.getElementById('btnUpgrade').addEventListener('click', async () => {
-    if (!confirm('Upgrade all packages? This may take a while.')) return;
     try {
-        await api('/packages/update', { method: 'POST', body: JSON.stringify({ upgrade: true }) });
+        const plan = await api('/packages/upgrade/simulate', { method: 'POST', body: JSON.stringify({}) });
+        if (!confirm(`${describePlan(plan)}\n\nUpgrade all packages? This may take a while.`)) return;
+        await api('/packages/upgrade', { method: 'POST', body: JSON.stringify({ token: plan.token }) });
         alert('Packages upgraded successfully');
         loadPackages();
     } catch (error) {
@@ -680,10 +699,10 @@ function displayNetwork(data) {
         <div class="firewall-add">
             <button class="btn-success" onclick="addFirewallRule()">Add Rule</button>
         </div>
-        ${data.firewallRules.map((rule, idx) => `
+        ${data.firewallRules.map(rule => `
             <div class="firewall-rule-item">
-                <code>${escapeHtml(rule)}</code>
-                <button class="btn-danger" onclick="deleteFirewallRule('${idx + 1}')">Delete</button>
+                <code>${escapeHtml(rule.raw)}</code>
+                <button class="btn-danger" onclick="deleteFirewallRule('${rule.number}')">Delete</button>
             </div>
         `).join('')}
     `;
@@ -767,10 +786,12 @@ window.addFirewallRule = async function() {
     const port = prompt('Enter port:');
     if (!port) return;
     const protocol = prompt('Enter protocol (tcp/udp):', 'tcp');
+    const from = prompt('Allow from (address, CIDR or any):', 'any');
+    if (!from) return;
     try {
-        await api('/network/firewall/allow', {
+        await api('/network/firewall/rules', {
             method: 'POST',
-            body: JSON.stringify({ port, protocol }),
+            body: JSON.stringify({ action: 'allow', port, protocol, from }),
         });
         loadNetwork();
     } catch (error) {
@@ -1214,18 +1235,77 @@ document.getElementById('btnSaveConfig')?.addEventListener('click', async () =>
 });
 
 // Logs
-document.getElementById('btnLoadLogs').addEventListener('click', async () => {
+let logsCursor = null;
+let logsStream = null;
+
+function logsParams() {
+    const params = new URLSearchParams();
     const unit = document.getElementById('logsUnit').value.trim();
-    if (!unit) {
-        alert('Please enter a service unit name');
-        return;
+    const priority = document.getElementById('logsPriority').value;
+    const grep = document.getElementById('logsGrep').value.trim();
+    if (unit) params.set('unit', unit);
+    if (priority) params.set('priority', priority);
+    if (grep) params.set('grep', grep);
+    return params;
+}
+
+function formatLogEntry(entry) {
+    const source = entry.identifier || entry.unit || '';
+    const pid = entry.pid ? `[${entry.pid}]` : '';
+    return `${new Date(entry.time).toLocaleString()} ${source}${pid}: ${entry.message}`;
+}
+
+function stopLogsStream() {
+    if (logsStream) {
+        logsStream.close();
+        logsStream = null;
     }
+    document.getElementById('btnFollowLogs').textContent = 'Follow';
+}
+
+async function loadLogs(older) {
+    const params = logsParams();
+    params.set('limit', '100');
+    if (older && logsCursor) params.set('cursor', logsCursor);
     try {
-        const data = await api(`/logs?unit=${encodeURIComponent(unit)}&lines=100`);
-        document.getElementById('logsOutput').textContent = data.logs;
+        const data = await api(`/logs?${params}`);
+        const output = document.getElementById('logsOutput');
+        // Entries arrive newest first; show them oldest first
+        const text = data.entries.slice().reverse().map(formatLogEntry).join('\n');
+        if (older) {
+            output.textContent = text + (text ? '\n' : '') + output.textContent;
+        } else {
+            output.textContent = text;
+            output.scrollTop = output.scrollHeight;
+        }
+        logsCursor = data.nextCursor || null;
+        document.getElementById('btnOlderLogs').style.display = logsCursor ? '' : 'none';
     } catch (error) {
         alert('Failed to load logs: ' + error.message);
     }
+}
+
+document.getElementById('btnLoadLogs').addEventListener('click', () => {
+    stopLogsStream();
+    loadLogs(false);
+});
+
+document.getElementById('btnOlderLogs').addEventListener('click', () => loadLogs(true));
+
+document.getElementById('btnFollowLogs').addEventListener('click', () => {
+    if (logsStream) {
+        stopLogsStream();
+        return;
+    }
+    const output = document.getElementById('logsOutput');
+    logsStream = new EventSource(`/api/logs/stream?${logsParams()}`);
+    logsStream.onmessage = (event) => {
+        const entry = JSON.parse(event.data);
+        output.textContent += (output.textContent ? '\n' : '') + formatLogEntry(entry);
+        output.scrollTop = output.scrollHeight;
+    };
+    logsStream.onerror = () => stopLogsStream();
+    document.getElementById('btnFollowLogs').textContent = 'Stop';
 });
 
 // Utility functions